@@ -7,107 +7,1565 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
+	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaaan/games/deckcount"
 )
 
-type Card struct {
-	Name       string
-	Type       string
-	Legalities map[string]string
+// aliasFlag is the value of -alias: old=new pairs given to
+// deckcount.AddFormatAlias, in the order given.
+type aliasFlag []string
+
+func (*aliasFlag) String() string { return "" }
+
+func (f *aliasFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("want old=new; got %q", s)
+	}
+	deckcount.AddFormatAlias(s[:i], s[i+1:])
+	*f = append(*f, s)
+	return nil
+}
+
+// key returns f's pairs, sorted and comma-separated, for the key of a cached
+// count, since an alias changes which cards a format has.
+func (f aliasFlag) key() string {
+	pairs := append([]string{}, f...)
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// aliases is the value of -alias.
+var aliases aliasFlag
+
+// includeFlag is the value of -must-include: the copies of each card, given
+// like "4 Lightning Strike" or just "Lightning Strike" for one, that the
+// counted main decks must have.
+type includeFlag map[string]int
+
+func (includeFlag) String() string { return "" }
+
+func (f includeFlag) Set(s string) error {
+	copies, name := 1, strings.TrimSpace(s)
+	if fields := strings.SplitN(name, " ", 2); len(fields) == 2 {
+		if n, err := strconv.Atoi(strings.TrimSuffix(fields[0], "x")); err == nil {
+			copies, name = n, strings.TrimSpace(fields[1])
+		}
+	}
+	if copies < 1 || name == "" {
+		return fmt.Errorf("want \"<copies> <card name>\"; got %q", s)
+	}
+	f[name] += copies
+	return nil
+}
+
+// mustInclude is the value of -must-include.
+var mustInclude = includeFlag{}
+
+// typeFlag is the value of -type: ranges like "Land:20-26", "Creature:-20"
+// (at most 20), "Land:20-" (at least 20), or "Land:24" (exactly 24), in the
+// order given.  A range's Max of -1 stands for the whole main deck.
+type typeFlag []deckcount.TypeRange
+
+func (*typeFlag) String() string { return "" }
+
+func (f *typeFlag) Set(s string) error {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return fmt.Errorf("want type:min-max; got %q", s)
+	}
+	r := deckcount.TypeRange{Type: strings.TrimSpace(s[:i])}
+	var ok bool
+	if r.Min, r.Max, ok = parseRange(s[i+1:]); !ok {
+		return fmt.Errorf("want type:min-max; got %q", s)
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// parseRange parses "min-max", "-max", "min-", or "n", returning a missing
+// min as 0 and a missing max as -1.
+func parseRange(s string) (low, high int, ok bool) {
+	high = -1
+	lo, hi := s, s
+	if j := strings.Index(lo, "-"); j >= 0 {
+		lo, hi = lo[:j], lo[j+1:]
+	}
+	var err error
+	if lo != "" {
+		low, err = strconv.Atoi(lo)
+	}
+	if hi != "" && err == nil {
+		high, err = strconv.Atoi(hi)
+	}
+	return low, high, err == nil && (lo != "" || hi != "")
+}
+
+// typeRanges is the value of -type.
+var typeRanges typeFlag
+
+// curveFlag is the value of -curve: ranges like "1:8-" (at least 8 nonland
+// cards of mana value 1), "5+:-4" (at most 4 of mana value 5 or more), or
+// "2-3:10-14".  As for typeFlag, a Max of -1 stands for the whole main deck.
+type curveFlag []deckcount.CurveRange
+
+func (*curveFlag) String() string { return "" }
+
+func (f *curveFlag) Set(s string) error {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return fmt.Errorf("want value:min-max; got %q", s)
+	}
+	var r deckcount.CurveRange
+	values := strings.TrimSpace(s[:i])
+	ok := true
+	if strings.HasSuffix(values, "+") {
+		var err error
+		r.Low, err = strconv.Atoi(values[:len(values)-1])
+		r.High, ok = -1, err == nil
+	} else if r.Low, r.High, ok = parseRange(values); r.High < 0 {
+		ok = false
+	}
+	if !ok {
+		return fmt.Errorf("want a mana value like 2, 2-3, or 5+; got %q", s)
+	}
+	if r.Min, r.Max, ok = parseRange(s[i+1:]); !ok {
+		return fmt.Errorf("want value:min-max; got %q", s)
+	}
+	*f = append(*f, r)
+	return nil
 }
 
+// curveRanges is the value of -curve.
+var curveRanges curveFlag
+
+var (
+	grid     = flag.Bool("grid", false, "print size,count,log10 for each main deck size from 0 to -grid-max in -format")
+	gridMax  = flag.Int("grid-max", 75, "the largest main deck size printed by -grid")
+	format   = flag.String("format", "standard", "the format used by -grid")
+	formats  = flag.String("formats", "", "the comma-separated formats to count, e.g. pioneer,pauper; default "+strings.Join(defaultFormats, ","))
+	mainSize = flag.Int("main", 60, "the number of cards in the main deck")
+	sideSize = flag.Int("side", 15, "the number of cards in the sideboard")
+	validate = flag.Bool("validate", false, "audit the card data and print a report instead of counting; with -deck, print a JSON report of the decklist's problems in -format instead, exiting with status 2 if it isn't legal")
+	future   = flag.Bool("future", false, "count cards with Future legality (from unreleased sets) as Legal")
+	exact    = flag.Bool("exact", false, "print each count's decimal digits and bit length with the exact integer")
+	cache    = flag.String("cache", "", "a file in which to remember counts between runs on the same data")
+	memoPath = flag.String("memo", "", "a file in which to remember counts by the formats' card limits, so a run after a banlist change recounts only the formats it changed")
+	selftest = flag.Bool("selftest", false, "check the documented CountDecks examples and exit; needs no data file")
+	explain  = flag.Bool("explain", false, "list every deck in -format, if there are only a few")
+	list     = flag.Int("list", 0, "print this many decks of -format, in the order of their numbers as -sample labels them")
+	skip     = flag.String("skip", "0", "the number of the first deck -list prints")
+	sample   = flag.Int("sample", 0, "print this many decks of -format, each drawn uniformly at random from those counted and labeled with its number among them; see -seed")
+	progress = flag.Bool("progress", true, "show each count's progress on stderr")
+	dump     = flag.String("dump-limits", "", "print a histogram of the given format's card limits")
+	summary  = flag.Bool("summary", false, "print the data's version and the number of cards legal in each format")
+	compare  = flag.Bool("compare", false, "given two data files, old and new, show how -format's count changed")
+	report   = flag.Bool("report", false, "count every format in the data and write a JSON report")
+	csvOut   = flag.Bool("csv", false, "like -report, but write CSV rows")
+	capBasic = flag.Int("basic-cap", 0, "if positive, allow at most this many copies of each basic land; counts are then not of all legal decks")
+	cpuprof  = flag.String("cpuprofile", "", "write a CPU profile to this file")
+	memprof  = flag.String("memprofile", "", "write a heap profile to this file on exit")
+	warnBig  = flag.Bool("warn-on-large", true, "refuse to start counts that look very expensive, unless -yes is given")
+	yes      = flag.Bool("yes", false, "go ahead with expensive counts; see -warn-on-large")
+	serve    = flag.String("http", "", "serve counts over HTTP on this address, e.g. :8080, at POST /batch")
+	sig      = flag.Int("sig", 3, "the number of significant digits in each count's approximation; -exact is unaffected")
+	maxAge   = flag.Int("check-freshness", 0, "warn if the data's mtgjson date is more than this many days old")
+	cmdZone  = flag.String("commander", "", "count 100-card Commander decks led by this commander, or two joined by + (partners, friends forever, or a commander and its Background), or \"all\" for every command zone")
+	seed     = flag.Int64("seed", 1, "the seed for the randomized modes; the same seed gives the same output")
+	override = flag.String("override", "", "a file of bans, restrictions, and unbans, e.g. \"modern: unban Splinter Twin\", to apply to the data before counting")
+	asOf     = flag.String("as-of", "", "count with the legalities of this date, e.g. 2015-01-23, reconstructed from -history")
+	history  = flag.String("history", "", "a banlist history file for -as-of, with lines like \"2015-01-19 modern: ban Birthing Pod\"")
+	jobs     = flag.Int("j", runtime.NumCPU(), "count up to this many formats at once, and use up to this many goroutines within a count")
+	identity = flag.String("identity", "", "count only cards whose color identity is within this one, e.g. RW, boros, or mono-red")
+	byIdent  = flag.Bool("by-identity", false, "print the number of decks in -format of each exact color identity")
+	distinct = flag.Bool("by-distinct", false, "print the number of decks in -format with each number of distinct card names")
+	sealed   = flag.String("sealed", "", "count the limited main decks, of 40 cards unless -main is given, buildable from the pool in this decklist file and any number of basic lands")
+	compName = flag.String("companion", "", "count the decks of -format whose sideboards have this companion, e.g. Lurrus, and whose main decks keep to its restriction, or \"all\" for each companion")
+	odds     = flag.String("odds", "", "print the exact chance of a hand from -deck's main deck, e.g. \"at least 2 lands and 1 one-drop in opening 7\"")
+	deckPath = flag.String("deck", "", "the decklist file, with lines like \"4 Lightning Bolt\", for -odds, -mulligan, and -validate")
+	mullKeep = flag.String("mulligan", "", "simulate London mulligans with -deck, keeping a hand that, after putting cards on the bottom, meets this query, e.g. \"2-4 lands and 1 two-drop\"")
+	goal     = flag.String("goal", "", "with -mulligan, the query the kept hand and draws must meet by -turn; default the -mulligan query")
+	turn     = flag.Int("turn", 0, "with -mulligan, the turn by which to meet -goal, or 0 for the opening hand")
+	onDraw   = flag.Bool("on-draw", false, "with -mulligan, draw a card on turn 1")
+	trials   = flag.Int("trials", 1000000, "the number of games -mulligan simulates; see -seed")
+	maxMulls = flag.Int("max-mulligans", 2, "with -mulligan, keep whatever hand comes after this many mulligans")
+	booster  = flag.String("booster", "", "given mtgjson's AllPrintings.json, count the distinct draft boosters of the set with this code, e.g. DOM")
+	collate  = flag.String("collation", "10,3,1,8", "the `commons,uncommons,rares,mythic odds` of a -booster pack, where a rare is a mythic one time in mythic odds")
+	pull     = flag.String("pull", "", "with -booster, also print the chance of opening the card with this name")
+	fetch    = flag.Bool("fetch", false, "download mtgjson's current AtomicCards.json, or reuse a fresh cached copy, instead of naming a data file")
+)
+
 func main() {
-	if len(os.Args) != 2 || (len(os.Args) >= 2 && os.Args[1] == "-h" || os.Args[1] == "--help") {
-		fmt.Fprintf(os.Stderr, "usage: %s path/to/AllCards.json  # from https://mtgjson.com/json/AllCards.json\n", os.Args[0])
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] path/to/AllCards.json  # from https://mtgjson.com/json/AllCards.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -fetch\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -booster SET path/to/AllPrintings.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -validate -deck path/to/decklist.txt path/to/AllCards.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Var(&aliases, "alias", "treat the format `old=new` as the format new, in the data and in -format; may be repeated")
+	flag.Var(&curveRanges, "curve", "count only decks of -format whose main decks have a `value:min-max` of nonland cards of each mana value, e.g. 1:8- or 5+:-4; may be repeated, with mana values that don't overlap")
+	flag.Var(&typeRanges, "type", "count only decks of -format whose main decks have a `type:min-max` of cards, e.g. Land:20-26 or Creature:-20; may be repeated, and a card counts toward the first type given that it has")
+	flag.Var(mustInclude, "must-include", "count only decks of -format whose main decks have these `copies name`, e.g. \"4 Lightning Strike\"; may be repeated")
+	flag.Parse()
+	if *jobs < 1 {
+		fmt.Fprintf(os.Stderr, "error: -j must be at least 1\n")
+		os.Exit(1)
+	}
+	if *future {
+		deckcount.SetDefaults(deckcount.WithFuture())
+	}
+	deckcount.SetDefaults(deckcount.WithBasicCap(*capBasic), deckcount.WithParallelism(*jobs))
+	*format = deckcount.CanonicalFormat(*format)
+	rng = rand.New(rand.NewSource(*seed))
+	stopProfiles, err := startProfiles(*cpuprof, *memprof)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+	defer stopProfiles()
+	if *selftest {
+		if !deckcount.SelfTest(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if *compare {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		before, err := loadLimits(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		after, err := loadLimits(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		compareCounts(os.Stdout, before, after, *format, *mainSize, *sideSize)
+		return
+	}
+	if *fetch && flag.NArg() != 0 || !*fetch && flag.NArg() != 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
-	allCardsPath := os.Args[1]
+	allCardsPath := flag.Arg(0)
+	if *fetch {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		allCardsPath, err = fetchCards(http.DefaultClient, atomicCardsURL, filepath.Join(dir, "count_legal_mtg_decks"), fetchFresh, time.Now())
+		if err != nil && allCardsPath == "" {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s; using the cached %s\n", err, allCardsPath)
+		}
+	}
 	mtgJSON, err := ioutil.ReadFile(allCardsPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
 	}
-	limits := FormatLimits(mtgJSON)
-	for _, f := range []string{"standard", "modern", "legacy", "vintage"} {
-		c := CountDecks(60, 15, limits[f])
-		fmt.Printf("%8s: %.3g (%v)\n", f, new(big.Float).SetInt(c), c)
+	if *booster != "" {
+		if err := countBoosters(os.Stdout, mtgJSON, *booster, *collate, *pull, *sig); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", allCardsPath, err)
+			os.Exit(1)
+		}
+		return
+	}
+	data, err := deckcount.ParseCardData(mtgJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %s\n", allCardsPath, err)
+		os.Exit(1)
+	}
+	if *maxAge > 0 {
+		if warning := staleWarning(data.Meta, time.Now(), *maxAge); warning != "" {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+	}
+	var historyData []byte
+	if *asOf != "" {
+		if *history == "" {
+			fmt.Fprintf(os.Stderr, "error: -as-of needs a -history file\n")
+			os.Exit(1)
+		}
+		historyData, err = ioutil.ReadFile(*history)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		h, err := deckcount.ParseBanHistory(historyData)
+		if err == nil {
+			data.Cards, err = h.AsOf(data.Cards, *asOf)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", *history, err)
+			os.Exit(1)
+		}
+	}
+	var overrideData []byte
+	if *override != "" {
+		overrideData, err = ioutil.ReadFile(*override)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		overrides, err := deckcount.ParseOverrides(overrideData)
+		if err == nil {
+			data.Cards, err = deckcount.ApplyOverrides(data.Cards, overrides)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", *override, err)
+			os.Exit(1)
+		}
+	}
+	cards := data.Cards
+	if *sealed != "" {
+		c, err := countSealed(*sealed, cards)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(countLine("sealed", c, *sig))
+		return
+	}
+	if *odds != "" {
+		if *deckPath == "" {
+			fmt.Fprintf(os.Stderr, "error: -odds needs a -deck file\n")
+			os.Exit(1)
+		}
+		q, p, err := handOdds(*deckPath, *odds, cards)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(oddsLine(q, p))
+		return
+	}
+	if *mullKeep != "" {
+		if *deckPath == "" {
+			fmt.Fprintf(os.Stderr, "error: -mulligan needs a -deck file\n")
+			os.Exit(1)
+		}
+		if err := simulateMulligans(os.Stdout, *deckPath, *mullKeep, *goal, cards); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *identity != "" {
+		id, err := deckcount.ParseIdentity(*identity)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		cards = deckcount.WithinIdentity(cards, id)
+	}
+	if *summary {
+		writeSummary(os.Stdout, data)
+		return
+	}
+	if *validate && *deckPath != "" {
+		if _, err := deckcount.LegalLimits(cards, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		legal, err := validateDeck(os.Stdout, *deckPath, cards, *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		if !legal {
+			os.Exit(2)
+		}
+		return
+	}
+	if *validate {
+		deckcount.ValidateData(cards).Print(os.Stdout)
+		return
+	}
+	if *dump != "" {
+		if _, err := deckcount.LegalLimits(cards, *dump); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		writeLimitHistogram(os.Stdout, deckcount.NamedLimits(cards, *dump))
+		return
+	}
+	if *cmdZone != "" {
+		var c *big.Int
+		if *cmdZone == "all" {
+			pairs := deckcount.CommandZonePairs(cards, "commander")
+			fmt.Println(countLine("pairs", big.NewInt(int64(len(pairs))), *sig))
+			c = deckcount.CountAllCommanderDecks(cards, "commander")
+		} else {
+			c, err = deckcount.CountDecksForCommander(cards, "commander", strings.Split(*cmdZone, "+")...)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(countLine("commander", c, *sig))
+		return
+	}
+	limits := deckcount.LimitsByFormat(cards)
+	if *serve != "" {
+		http.Handle("/batch", BatchHandler(limits, *jobs))
+		fmt.Fprintf(os.Stderr, "serving on %s\n", *serve)
+		if err := http.ListenAndServe(*serve, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *grid || *explain || *sample > 0 || *list > 0 || *byIdent || *distinct || *compName != "" || len(mustInclude) > 0 || len(typeRanges) > 0 || len(curveRanges) > 0 {
+		if _, err := deckcount.LegalLimits(cards, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if *grid {
+		writeGrid(os.Stdout, limits[*format], *gridMax)
+		return
+	}
+	if len(typeRanges) > 0 {
+		for i := range typeRanges {
+			if typeRanges[i].Max < 0 {
+				typeRanges[i].Max = *mainSize
+			}
+		}
+		c, err := deckcount.CountDecksByTypes(*mainSize, *sideSize, cards, *format, typeRanges)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -type: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(countLine(*format, c, *sig))
+		return
+	}
+	if len(curveRanges) > 0 {
+		for i := range curveRanges {
+			if curveRanges[i].Max < 0 {
+				curveRanges[i].Max = *mainSize
+			}
+		}
+		c, err := deckcount.CountDecksByCurve(*mainSize, *sideSize, cards, *format, curveRanges)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -curve: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(countLine(*format, c, *sig))
+		return
+	}
+	if len(mustInclude) > 0 {
+		c, err := deckcount.CountDecksIncluding(*mainSize, *sideSize, cards, *format, mustInclude)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -must-include: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(countLine(*format, c, *sig))
+		return
+	}
+	if *distinct {
+		writeDistinctCounts(os.Stdout, deckcount.CountDecksByDistinct(*mainSize, *sideSize, limits[*format]), *sig)
+		return
+	}
+	if *compName != "" {
+		if err := writeCompanionCounts(os.Stdout, *mainSize, *sideSize, cards, *format, *compName, *sig); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *byIdent {
+		writeIdentityCounts(os.Stdout, deckcount.CountDecksByIdentity(*mainSize, *sideSize, cards, *format), *sig)
+		return
+	}
+	if *list > 0 {
+		first, ok := new(big.Int).SetString(*skip, 10)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: -skip %q isn't a number\n", *skip)
+			os.Exit(1)
+		}
+		sp, err := deckcount.NewSampler(*mainSize, *sideSize, deckcount.NamedLimits(cards, *format))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		it := sp.Decks()
+		it.Skip(first)
+		for i := 0; i < *list; i++ {
+			n := it.Rank()
+			deck, ok := it.Next()
+			if !ok {
+				break
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("// %s deck %v of %v\n", *format, n, sp.Count())
+			writeDeck(os.Stdout, deck)
+		}
+		return
+	}
+	if *sample > 0 {
+		sp, err := deckcount.NewSampler(*mainSize, *sideSize, deckcount.NamedLimits(cards, *format))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		// Drawing the deck's number, as Sample does, lets the list say it.
+		for i := 0; i < *sample; i++ {
+			if i > 0 {
+				fmt.Println()
+			}
+			n := new(big.Int).Rand(rng, sp.Count())
+			deck, err := sp.UnrankDeck(n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("// %s deck %v of %v\n", *format, n, sp.Count())
+			writeDeck(os.Stdout, deck)
+		}
+		return
+	}
+	if *report || *csvOut {
+		r := BuildReport(limits, DataHash(mtgJSON), time.Now().UTC(), *mainSize, *sideSize, *jobs)
+		r.DataDate = data.Meta.Date
+		write := r.Write
+		if *csvOut {
+			write = r.WriteCSV
+		}
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *explain {
+		if err := explainDecks(os.Stdout, *mainSize, *sideSize, limits[*format], maxExplained); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	counted, err := selectFormats(*formats, limits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d cards\n", len(cards))
+	counts := &CountCache{Counts: map[string]string{}}
+	if *cache != "" {
+		counts = LoadCache(*cache, DataHash(mtgJSON))
+	}
+	cacheKey := func(f string) string {
+		key := fmt.Sprintf("%s/%d/%d/future=%v", f, *mainSize, *sideSize, *future)
+		if *capBasic > 0 {
+			key += fmt.Sprintf("/basic-cap=%d", *capBasic)
+		}
+		if historyData != nil {
+			key += "/as-of=" + *asOf + "/history=" + DataHash(historyData)
+		}
+		if overrideData != nil {
+			key += "/override=" + DataHash(overrideData)
+		}
+		if *identity != "" {
+			key += "/identity=" + *identity
+		}
+		if len(aliases) > 0 {
+			key += "/alias=" + aliases.key()
+		}
+		return key
+	}
+	var memo *deckcount.Memo
+	if *memoPath != "" {
+		if memo, err = loadMemo(*memoPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		deckcount.SetDefaults(deckcount.WithMemo(memo))
+	}
+	memoized := func(f string) bool {
+		_, ok := memo.Get(deckcount.Fingerprint(*mainSize, *sideSize, deckcount.LimitClasses(*mainSize, *sideSize, limits[f])))
+		return ok
+	}
+	if *warnBig && !*yes {
+		for _, f := range counted {
+			if _, ok := counts.Get(cacheKey(f)); !ok && !memoized(f) && deckcount.IsLargeCount(*mainSize, *sideSize, limits[f]) {
+				fmt.Fprintf(os.Stderr, "warning: counting %s (%d cards) may take minutes and gigabytes of memory; rerun with -yes to go ahead\n", f, len(limits[f]))
+				os.Exit(1)
+			}
+		}
+	}
+	// Up to -j formats are counted at once, and printed in order as they're
+	// done.
+	results := make([]chan *big.Int, len(counted))
+	sem := make(chan struct{}, *jobs)
+	for i, f := range counted {
+		results[i] = make(chan *big.Int, 1)
+		if c, ok := counts.Get(cacheKey(f)); ok {
+			results[i] <- c
+			continue
+		}
+		go func(f string, result chan<- *big.Int) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if !*progress {
+				result <- deckcount.CountDecks(*mainSize, *sideSize, limits[f])
+				return
+			}
+			update := newProgressBar(os.Stderr, f).update
+			result <- deckcount.CountDecksProgress(*mainSize, *sideSize, limits[f], update)
+		}(f, results[i])
+	}
+	for i, f := range counted {
+		c := <-results[i]
+		counts.Put(cacheKey(f), c)
+		if *exact {
+			fmt.Println(exactLine(f, c))
+			continue
+		}
+		fmt.Println(countLine(f, c, *sig))
+	}
+	if *cache != "" {
+		if err := counts.Save(*cache); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if memo != nil {
+		if err := saveMemo(*memoPath, memo); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
 	}
 }
 
-func FormatLimits(mtgJSON []byte) map[string][]int {
-	var cards map[string]Card
-	if err := json.Unmarshal(mtgJSON, &cards); err != nil {
-		panic(err)
+// startProfiles starts a CPU profile written to cpuPath, if it isn't empty.
+// The returned function stops it and writes a heap profile to memPath, if
+// that isn't empty, reporting any error on stderr.
+func startProfiles(cpuPath, memPath string) (func(), error) {
+	var cpu *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpu = f
 	}
-	limits := map[string][]int{}
-	fmt.Printf("%d cards\n", len(cards))
-	for _, c := range cards {
-		for f, leg := range c.Legalities {
-			if _, ok := limits[f]; !ok {
-				limits[f] = []int{}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
 			}
-			lim := 0
-			if leg == "Legal" {
-				if strings.HasPrefix(c.Type, "Basic Land") ||
-					c.Name == "Relentless Rats" || c.Name == "Shadowborn Apostle" {
-					lim = 1000
-				} else {
-					lim = 4
-				}
-			} else if leg == "Restricted" {
-				lim = 1
+		}
+		if memPath == "" {
+			return
+		}
+		f, err := os.Create(memPath)
+		if err == nil {
+			runtime.GC() // Up-to-date statistics.
+			err = pprof.WriteHeapProfile(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
 			}
-			if lim > 0 {
-				limits[f] = append(limits[f], lim)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		}
+	}, nil
+}
+
+// BatchQuery is one count requested from POST /batch.
+type BatchQuery struct {
+	Format string `json:"format"`
+	Main   int    `json:"main"`
+	Side   int    `json:"side"`
+}
+
+// BatchResult is the answer to a BatchQuery: its count, or why there isn't
+// one.
+type BatchResult struct {
+	BatchQuery
+	Count *big.Int `json:"count,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// maxBatchDeck is the largest main deck plus sideboard a batch query may ask
+// for, to keep any one query from tying up the server.
+const maxBatchDeck = 250
+
+// BatchHandler serves POST /batch: given a JSON array of BatchQuery, it
+// counts them concurrently, at most maxConcurrent at a time across all
+// requests, and responds with a BatchResult for each, in order.  A bad query
+// gets an error in its result rather than failing the batch.  If the client
+// goes away, the remaining counts are abandoned.
+func BatchHandler(limits map[string][]int, maxConcurrent int) http.Handler {
+	sem := make(chan struct{}, maxConcurrent)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var queries []BatchQuery
+		if err := json.NewDecoder(r.Body).Decode(&queries); err != nil {
+			http.Error(w, fmt.Sprintf("want a JSON array of {format, main, side}: %v", err), http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		results := make([]BatchResult, len(queries))
+		var wg sync.WaitGroup
+		for i, q := range queries {
+			results[i].BatchQuery = q
+			limit, ok := limits[deckcount.CanonicalFormat(q.Format)]
+			switch {
+			case !ok:
+				results[i].Error = fmt.Sprintf("%v %q", deckcount.ErrUnknownFormat, q.Format)
+				continue
+			case q.Main < 0 || q.Side < 0 || q.Main+q.Side > maxBatchDeck:
+				results[i].Error = fmt.Sprintf("deck sizes must be nonnegative, with at most %d cards in all", maxBatchDeck)
+				continue
 			}
+			wg.Add(1)
+			go func(res *BatchResult, limit []int) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+					res.Error = ctx.Err().Error()
+					return
+				}
+				spec := deckcount.DeckSpec{Main: res.Main, Side: res.Side}
+				count, err := deckcount.CountLimits(limit, spec, deckcount.WithContext(ctx))
+				if err != nil {
+					res.Error = err.Error()
+					return
+				}
+				res.Count = count
+			}(&results[i], limit)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return // No one to answer.
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+}
+
+// Report is the result of counting every format in a data file.
+type Report struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	DataHash    string         `json:"dataHash"`           // The DataHash of the card data.
+	DataDate    string         `json:"dataDate,omitempty"` // The card data's Meta.Date, if any.
+	Formats     []FormatReport `json:"formats"`
+}
+
+type FormatReport struct {
+	Name       string   `json:"name"`
+	LegalCards int      `json:"legalCards"`
+	Count      *big.Int `json:"count"`
+	Log10      *float64 `json:"log10"` // Null if Count is 0.
+
+	Elapsed time.Duration `json:"-"` // How long counting took.
+}
+
+// BuildReport counts numMain+numSide decks in each format of limits, up to
+// jobs formats at once, as -j does for the main counts, and reports them in
+// order of format name.
+func BuildReport(limits map[string][]int, dataHash string, now time.Time, numMain, numSide, jobs int) Report {
+	r := Report{GeneratedAt: now, DataHash: dataHash, Formats: []FormatReport{}}
+	for f, limit := range limits {
+		r.Formats = append(r.Formats, FormatReport{Name: f, LegalCards: len(limit)})
 	}
-	return limits
+	sort.Slice(r.Formats, func(a, b int) bool { return r.Formats[a].Name < r.Formats[b].Name })
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, jobs)
+	for i := range r.Formats {
+		wg.Add(1)
+		go func(fr *FormatReport) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			fr.Count = deckcount.CountDecks(numMain, numSide, limits[fr.Name])
+			fr.Elapsed = time.Since(start)
+			if fr.Count.Sign() > 0 {
+				lg := deckcount.Log10(fr.Count)
+				fr.Log10 = &lg
+			}
+		}(&r.Formats[i])
+	}
+	wg.Wait()
+	return r
 }
 
-// Cache key, used to speed up LimitedMultiChooose.
-type key struct {
-	main, side, numCards int
+func (r Report) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
 }
 
-// CountDecks(M, S, L) returns the number of ways to make a deck with M
-// cards in the main deck and S cards in the sideboard where there are len(L)
-// cards to choose from, and there can be at most L[I] copies of card I in your
-// mainboard and sideboard combined (0 < I < len(L)).
-// Examples (mainboard/sideboard):
-//   CountDecks(3, 0, []int{1,2,3})=6 (abb abc acc bbc bcc ccd)
-//   CountDecks(3, 3, []int{1,2,3})=6 (abb/ccc abc/bcc acc/bbc bbc/acc bcc/abc ccc/abb)
-//   CountDecks(3, 1, []int{1,2,3})=12 (abb/c abc/b abc/c acc/b acc/c bbc/a bbc/c bcc/a bcc/b bcc/c ccc/a ccc/b)
-//   CountDecks(4, 0, []int{1,2,3})=5 (abbc abcc accc bbcc bccc)
-//   CountDecks(4, 1, []int{1,2,3})=8 (abbc/c abcc/b abcc/b accc/b bbcc/a bbcc/c bccc/a bccc/b)
-//   CountDecks(4, 2, []int{1,2,3})=5 (abbc/cc abcc/bc accc/bb bbcc/ac bccc/ab)
-//   CountDecks(60, 15, []int{75})=1 (the "all islands" example)
-func CountDecks(numMain, numSide int, limit []int) *big.Int {
-	return _countDecks(numMain, numSide, limit, map[key]*big.Int{})
+// WriteCSV writes r's formats as CSV rows of name, legal cards, count, log10
+// (empty if the count is 0), and milliseconds spent counting, after a header.
+// The default formats come first, in their usual order, then the rest by name.
+func (r Report) WriteCSV(w io.Writer) error {
+	rank := map[string]int{}
+	for i, f := range defaultFormats {
+		rank[f] = i + 1
+	}
+	formats := append([]FormatReport{}, r.Formats...)
+	sort.SliceStable(formats, func(a, b int) bool {
+		ra, rb := rank[formats[a].Name], rank[formats[b].Name]
+		if ra == 0 || rb == 0 {
+			return ra > rb || (ra == rb && formats[a].Name < formats[b].Name)
+		}
+		return ra < rb
+	})
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"format", "legalCards", "count", "log10", "elapsedMs"})
+	for _, fr := range formats {
+		lg := ""
+		if fr.Log10 != nil {
+			lg = strconv.FormatFloat(*fr.Log10, 'g', -1, 64)
+		}
+		cw.Write([]string{fr.Name, strconv.Itoa(fr.LegalCards), fr.Count.String(), lg,
+			strconv.FormatInt(fr.Elapsed.Milliseconds(), 10)})
+	}
+	cw.Flush()
+	return cw.Error()
 }
 
-func _countDecks(numMain, numSide int, limit []int, cache map[key]*big.Int) *big.Int {
-	if numMain+numSide == 0 {
-		return big.NewInt(1)
+// maxExplained is the largest number of decks -explain will list.
+const maxExplained = 1000
+
+// explainDecks lists each of the decks counted by CountDecks(numMain,
+// numSide, limit), writing card I as the I'th letter of the alphabet to match
+// the examples in the CountDecks doc comment, then the total.  It refuses if
+// there are more than max decks.
+func explainDecks(w io.Writer, numMain, numSide int, limit []int, max int64) error {
+	if len(limit) > 26 {
+		return fmt.Errorf("can't explain a pool of %d cards: at most 26 can be lettered", len(limit))
 	}
-	if len(limit) == 0 {
-		return big.NewInt(0)
+	total := deckcount.CountDecks(numMain, numSide, limit)
+	if total.Cmp(big.NewInt(max)) > 0 {
+		return fmt.Errorf("there are %v decks; -explain lists at most %d", total, max)
+	}
+	deckcount.EnumerateDecks(numMain, numSide, limit, func(main, side []int) {
+		fmt.Fprint(w, deckLetters(main))
+		if numSide > 0 {
+			fmt.Fprintf(w, "/%s", deckLetters(side))
+		}
+		fmt.Fprintln(w)
+	})
+	fmt.Fprintf(w, "total: %v\n", total)
+	return nil
+}
+
+// deckLetters writes copies as a string like "abb", where card I is the I'th
+// letter of the alphabet.
+func deckLetters(copies []int) string {
+	var b strings.Builder
+	for i, k := range copies {
+		b.WriteString(strings.Repeat(string(rune('a'+i)), k))
 	}
-	key := key{numMain, numSide, len(limit)}
-	if val, ok := cache[key]; ok {
-		return val
+	return b.String()
+}
+
+// DataHash returns the hex SHA-256 of a card data file.
+func DataHash(mtgJSON []byte) string {
+	sum := sha256.Sum256(mtgJSON)
+	return hex.EncodeToString(sum[:])
+}
+
+// CountCache remembers counts between runs.  It's only valid for the data
+// whose DataHash it records.
+type CountCache struct {
+	DataHash string
+	Counts   map[string]string // Decimal counts, by a key describing the query.
+}
+
+// LoadCache reads the cache in path.  If the file is missing, unreadable, or
+// was made from data other than that with hash dataHash, LoadCache returns an
+// empty cache for dataHash, so stale counts are recomputed rather than served.
+func LoadCache(path, dataHash string) *CountCache {
+	empty := &CountCache{DataHash: dataHash, Counts: map[string]string{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return empty
+	}
+	var c CountCache
+	if err := json.Unmarshal(data, &c); err != nil || c.DataHash != dataHash || c.Counts == nil {
+		return empty
+	}
+	return &c
+}
+
+func (c *CountCache) Get(key string) (*big.Int, bool) {
+	s, ok := c.Counts[key]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func (c *CountCache) Put(key string, count *big.Int) {
+	c.Counts[key] = count.String()
+}
+
+func (c *CountCache) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// limitedDeck is the main deck size of a limited event.
+const limitedDeck = 40
+
+// countSealed counts the limited decks buildable from the pool in the
+// decklist file path, with -main's size if it was given and limitedDeck's
+// otherwise.
+func countSealed(path string, cards map[string]deckcount.Card) (*big.Int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pool, err := deckcount.ParseCollection(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	numMain := limitedDeck
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "main" {
+			numMain = *mainSize
+		}
+	})
+	c, err := deckcount.CountSealedDecks(numMain, cards, pool)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// boxPacks is the number of packs in a booster box.
+const boxPacks = 36
+
+// countBoosters writes the number of distinct boosters of the set setCode in
+// the AllPrintings data mtgJSON, with the collation col, and, if pull isn't
+// empty, the chance of opening the card named pull in a pack and in a box.
+func countBoosters(w io.Writer, mtgJSON []byte, setCode, col, pull string, sig int) error {
+	c, err := deckcount.ParseCollation(col)
+	if err != nil {
+		return err
+	}
+	set, err := deckcount.ParseSetData(mtgJSON, setCode)
+	if err != nil {
+		return err
+	}
+	b, err := deckcount.NewBooster(set, c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s: %d of %d commons, %d of %d uncommons, %d of %d rares and %d mythics (mythic 1 in %d)\n",
+		set.Code, c.Commons, len(b.Commons), c.Uncommons, len(b.Uncommons), c.Rares, len(b.Rares), len(b.Mythic), c.MythicOdds)
+	fmt.Fprintln(w, countLine("packs", b.CountPacks(), sig))
+	if pull == "" {
+		return nil
+	}
+	p, rarity, err := b.PullChance(pull)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, pullLine(pull, rarity, p))
+	return nil
+}
+
+// pullLine formats the chance p of opening the card name of rarity rarity,
+// e.g. "Mythic 0 (mythic): 6.25% a pack (1 in 16), 90.19% a box of 36".
+func pullLine(name, rarity string, p *big.Rat) string {
+	f, _ := p.Float64()
+	return fmt.Sprintf("%s (%s): %s a pack (1 in %.4g), %s a box of %d", name, rarity, percent(p), 1/f, percent(deckcount.ChanceInPacks(p, boxPacks)), boxPacks)
+}
+
+// percent formats the chance p as a percentage, e.g. "6.25%".
+func percent(p *big.Rat) string {
+	return new(big.Rat).Mul(p, big.NewRat(100, 1)).FloatString(2) + "%"
+}
+
+// oddsLine formats the chance p of a hand that q asks for, e.g. "at least 2
+// lands in opening 7: 92.59% (25/27)".
+func oddsLine(q deckcount.HandQuery, p *big.Rat) string {
+	return fmt.Sprintf("%s: %s (%s)", q, percent(p), p.RatString())
+}
+
+// simulateMulligans writes the chances of keeping a hand that meets the
+// query keep after each number of mulligans, from the main deck of the
+// decklist file path, both simulated and exact, and the simulated chance of
+// meeting the query goal (or keep, if goal is empty) by -turn.
+func simulateMulligans(w io.Writer, path, keep, goal string, cards map[string]deckcount.Card) error {
+	if goal == "" {
+		goal = keep
+	}
+	m := deckcount.Mulligan{MaxMulligans: *maxMulls, Turn: *turn, OnDraw: *onDraw}
+	var err error
+	if m.Keep, err = deckcount.ParseHandQuery(keep); err != nil {
+		return err
+	}
+	if m.Goal, err = deckcount.ParseHandQuery(goal); err != nil {
+		return err
+	}
+	deck, err := readDeck(path)
+	if err != nil {
+		return err
+	}
+	exact, err := deckcount.KeepChances(deck, cards, m.Keep, m.MaxMulligans)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	r, err := deckcount.SimulateMulligans(deck, cards, m, *trials, *seed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	writeMulligans(w, m, r, exact)
+	return nil
+}
+
+// writeMulligans writes, for each number of mulligans, the fraction of r's
+// trials that kept a hand of that size by m.Keep, with the exact chance, then
+// the fraction of trials that kept whatever they had, and the fraction that
+// met m.Goal.
+func writeMulligans(w io.Writer, m deckcount.Mulligan, r deckcount.MulliganResult, exact []*big.Rat) {
+	fmt.Fprintf(w, "keep %s:\n", conditions(m.Keep))
+	frac := func(n int) *big.Rat { return big.NewRat(int64(n), int64(r.Trials)) }
+	forced := new(big.Rat).SetInt64(1)
+	kept := 0
+	for k, n := range r.Kept {
+		fmt.Fprintf(w, "%8s: %s (exactly %s)\n", fmt.Sprintf("%d cards", 7-k), percent(frac(n)), percent(exact[k]))
+		forced.Sub(forced, exact[k])
+		kept += n
+	}
+	fmt.Fprintf(w, "%8s: %s (exactly %s)\n", "forced", percent(frac(r.Trials-kept)), percent(forced))
+	by := "in the opening hand"
+	if m.Turn > 0 {
+		by = fmt.Sprintf("by turn %d on the play", m.Turn)
+		if m.OnDraw {
+			by = fmt.Sprintf("by turn %d on the draw", m.Turn)
+		}
+	}
+	fmt.Fprintf(w, "goal %s %s: %s of %d trials\n", conditions(m.Goal), by, percent(frac(r.Goal)), r.Trials)
+}
+
+// conditions returns q's conditions joined by "and", without its hand size.
+func conditions(q deckcount.HandQuery) string {
+	parts := []string{}
+	for _, c := range q.Conditions {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " and ")
+}
+
+// readDeck reads the decklist file path, as for deckcount.ParseDeck.
+func readDeck(path string) (deckcount.Deck, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return deckcount.Deck{}, err
+	}
+	defer f.Close()
+	deck, err := deckcount.ParseDeck(f)
+	if err != nil {
+		return deckcount.Deck{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return deck, nil
+}
+
+// validateDeck writes the deckcount.ValidateJSON report of the decklist file
+// path in format to w, as a line of JSON, and reports whether the deck is
+// legal.
+func validateDeck(w io.Writer, path string, cards map[string]deckcount.Card, format string) (bool, error) {
+	deck, err := readDeck(path)
+	if err != nil {
+		return false, err
+	}
+	r := deckcount.ValidateJSON(deck, cards, format)
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		return false, err
+	}
+	return len(r.Issues) == 0, nil
+}
+
+// handOdds returns the chance of a hand that query asks for, from the main
+// deck of the decklist file path.
+func handOdds(path, query string, cards map[string]deckcount.Card) (deckcount.HandQuery, *big.Rat, error) {
+	q, err := deckcount.ParseHandQuery(query)
+	if err != nil {
+		return q, nil, err
+	}
+	deck, err := readDeck(path)
+	if err != nil {
+		return q, nil, err
+	}
+	p, err := deckcount.HandOdds(deck, cards, q)
+	if err != nil {
+		return q, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return q, p, nil
+}
+
+// writeIdentityCounts writes a countLine for each color identity in counts,
+// fewest colors first and then in WUBRG order, with "C" for colorless, then
+// the total.
+func writeIdentityCounts(w io.Writer, counts map[string]*big.Int, sig int) {
+	identities := []string{}
+	total := new(big.Int)
+	for id, c := range counts {
+		identities = append(identities, id)
+		total.Add(total, c)
+	}
+	// key spells an identity in letters that sort in WUBRG order.
+	key := func(id string) string {
+		return strings.Map(func(r rune) rune { return 'a' + rune(strings.IndexRune("WUBRG", r)) }, id)
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		a, b := identities[i], identities[j]
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return key(a) < key(b)
+	})
+	for _, id := range identities {
+		label := id
+		if label == "" {
+			label = "C"
+		}
+		fmt.Fprintln(w, countLine(label, counts[id], sig))
+	}
+	fmt.Fprintln(w, countLine("total", total, sig))
+}
+
+// writeCompanionCounts writes a countLine, like "  Lurrus: ...", for the
+// numMain+numSide-card decks in format with the companion named name, or
+// with each companion legal in format if name is "all".
+func writeCompanionCounts(w io.Writer, numMain, numSide int, cards map[string]deckcount.Card, format, name string, sig int) error {
+	names := []string{name}
+	if name == "all" {
+		names = deckcount.Companions()
+	}
+	for _, name := range names {
+		full, _, err := deckcount.CompanionRestriction(name)
+		if err != nil {
+			return err
+		}
+		if len(names) > 1 && cards[full].Limit(format) == 0 {
+			continue
+		}
+		c, err := deckcount.CountCompanionDecks(numMain, numSide, cards, format, full)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, countLine(strings.TrimSuffix(strings.Fields(full)[0], ","), c, sig))
+	}
+	return nil
+}
+
+// writeDistinctCounts writes a countLine, like "15 names: ...", for each
+// number of distinct names that some decks have, then the total.
+func writeDistinctCounts(w io.Writer, counts []*big.Int, sig int) {
+	total := new(big.Int)
+	for k, c := range counts {
+		if c.Sign() == 0 {
+			continue
+		}
+		total.Add(total, c)
+		label := fmt.Sprintf("%d names", k)
+		if k == 1 {
+			label = "1 name"
+		}
+		fmt.Fprintln(w, countLine(label, c, sig))
+	}
+	fmt.Fprintln(w, countLine("total", total, sig))
+}
+
+// writeDeck writes deck as a decklist that deckcount.ParseDeck reads: a
+// line like "4 Lightning Bolt" per card, by name, with the sideboard's after
+// a "Sideboard" line.
+func writeDeck(w io.Writer, deck deckcount.Deck) {
+	zone := func(copies map[string]int) {
+		names := []string{}
+		for name := range copies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%d %s\n", copies[name], name)
+		}
+	}
+	zone(deck.Main)
+	if len(deck.Side) > 0 {
+		fmt.Fprintln(w, "Sideboard")
+		zone(deck.Side)
+	}
+}
+
+// loadMemo reads the memo file in path, or returns an empty Memo if there
+// isn't one yet.
+func loadMemo(path string) (*deckcount.Memo, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return deckcount.NewMemo(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	memo, err := deckcount.ReadMemo(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return memo, nil
+}
+
+// saveMemo writes memo to path.
+func saveMemo(path string, memo *deckcount.Memo) error {
+	var buf bytes.Buffer
+	if err := deckcount.WriteMemo(&buf, memo); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// progressBar shows a count's progress.  On a terminal it redraws a bar in
+// place; otherwise (say, when stderr is a log file) it writes a line every
+// progressInterval.
+type progressBar struct {
+	w       io.Writer
+	tty     bool
+	format  string
+	start   time.Time
+	lastLog time.Time
+}
+
+const progressInterval = 10 * time.Second
+
+func newProgressBar(f *os.File, format string) *progressBar {
+	tty := false
+	if fi, err := f.Stat(); err == nil {
+		tty = fi.Mode()&os.ModeCharDevice != 0
+	}
+	now := time.Now()
+	return &progressBar{w: f, tty: tty, format: format, start: now, lastLog: now}
+}
+
+func (p *progressBar) update(done, total int) {
+	now := time.Now()
+	elapsed := now.Sub(p.start)
+	if p.tty {
+		fmt.Fprintf(p.w, "\r%s", renderProgress(p.format, done, total, elapsed))
+		if done == total {
+			fmt.Fprintf(p.w, "\r%s\r", strings.Repeat(" ", 80))
+		}
+		return
+	}
+	if now.Sub(p.lastLog) >= progressInterval && done < total {
+		fmt.Fprintf(p.w, "%s: %d%% (ETA %v)\n", p.format, 100*done/total, eta(done, total, elapsed))
+		p.lastLog = now
+	}
+}
+
+// renderProgress returns one line of a progress bar, like
+// "  modern [=========>          ]  45% ETA 3s".
+func renderProgress(format string, done, total int, elapsed time.Duration) string {
+	const width = 40
+	filled := width * done / total
+	bar := strings.Repeat("=", filled)
+	if filled < width {
+		bar += ">" + strings.Repeat(" ", width-filled-1)
+	}
+	return fmt.Sprintf("%8s [%s] %3d%% ETA %v", format, bar, 100*done/total, eta(done, total, elapsed))
+}
+
+// eta estimates the time left, assuming each card takes as long as the
+// average so far.
+func eta(done, total int, elapsed time.Duration) time.Duration {
+	if done == 0 {
+		return 0
+	}
+	return (elapsed * time.Duration(total-done) / time.Duration(done)).Round(time.Second)
+}
+
+// loadLimits reads the card data file in path and returns its FormatLimits.
+func loadLimits(path string) (map[string][]int, error) {
+	mtgJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := deckcount.FormatLimits(mtgJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return limits, nil
+}
+
+// compareCounts writes how the number of decks in format changed from the
+// limits before to those after, e.g.
+// "vintage: 3.99e+228 -> 4e+228 (+0.25%, log10 +0.0011)".
+func compareCounts(w io.Writer, before, after map[string][]int, format string, numMain, numSide int) {
+	oldLimit, inOld := before[format]
+	newLimit, inNew := after[format]
+	switch {
+	case !inOld && !inNew:
+		fmt.Fprintf(w, "%s: in neither file\n", format)
+	case !inOld:
+		c := deckcount.CountDecks(numMain, numSide, newLimit)
+		fmt.Fprintf(w, "%s: new: %.3g\n", format, new(big.Float).SetInt(c))
+	case !inNew:
+		c := deckcount.CountDecks(numMain, numSide, oldLimit)
+		fmt.Fprintf(w, "%s: removed: was %.3g\n", format, new(big.Float).SetInt(c))
+	default:
+		a := deckcount.CountDecks(numMain, numSide, oldLimit)
+		b := deckcount.CountDecks(numMain, numSide, newLimit)
+		fmt.Fprintf(w, "%s: %.3g -> %.3g (%+.4g%%, log10 %+.4g)\n", format,
+			new(big.Float).SetInt(a), new(big.Float).SetInt(b), 100*(Ratio(b, a)-1), deckcount.Log10(b)-deckcount.Log10(a))
+	}
+}
+
+// Ratio returns a/b.
+func Ratio(a, b *big.Int) float64 {
+	r, _ := new(big.Float).Quo(new(big.Float).SetInt(a), new(big.Float).SetInt(b)).Float64()
+	return r
+}
+
+// FormatSci renders count in scientific notation with sig significant
+// digits, like "3.96 × 10^152".  Counts below 10 are written exactly.
+func FormatSci(count *big.Int, sig int) string {
+	if count.CmpAbs(big.NewInt(10)) < 0 {
+		return count.String()
+	}
+	if sig < 1 {
+		sig = 1
+	}
+	f := new(big.Float).SetPrec(uint(4*sig + 64)).SetInt(count)
+	text := f.Text('e', sig-1) // E.g. "3.96e+152".
+	i := strings.IndexByte(text, 'e')
+	exp, _ := strconv.Atoi(text[i+1:])
+	return fmt.Sprintf("%s × 10^%d", text[:i], exp)
+}
+
+// countLine formats c for the default table, approximated to sig
+// significant digits and then exactly, e.g. "standard: 3.96 × 10^152 (3957...)".
+func countLine(format string, c *big.Int, sig int) string {
+	return fmt.Sprintf("%8s: %s (%v)", format, FormatSci(c, sig), c)
+}
+
+// exactLine formats c for checking against other calculators, e.g.
+// "Modern: 217 digits, 720 bits, 5303...".
+func exactLine(format string, c *big.Int) string {
+	digits := c.String()
+	return fmt.Sprintf("%s%s: %d digits, %d bits, %s", strings.ToUpper(format[:1]), format[1:], len(digits), c.BitLen(), digits)
+}
+
+// writeGrid writes a CSV line "size,count,log10" for each main deck size from
+// 0 to max (with no sideboard).
+func writeGrid(w io.Writer, limit []int, max int) {
+	for size, c := range deckcount.DeckCountsBySize(limit, max) {
+		fmt.Fprintf(w, "%d,%v,%.6f\n", size, c, deckcount.Log10(c))
+	}
+}
+
+// staleWarning describes how old the data described by meta is, if its date
+// is more than maxDays before now, or if its date can't be read.  Otherwise
+// it returns "".
+func staleWarning(meta deckcount.Meta, now time.Time, maxDays int) string {
+	if meta.Date == "" {
+		return "the card data has no date; it may be out of date"
+	}
+	date, err := time.Parse("2006-01-02", meta.Date)
+	if err != nil {
+		return fmt.Sprintf("can't read the card data's date: %v", err)
+	}
+	days := int(now.Sub(date).Hours() / 24)
+	if days <= maxDays {
+		return ""
+	}
+	return fmt.Sprintf("the card data is from %s, %d days ago; newer sets and bans won't be counted", meta.Date, days)
+}
+
+// atomicCardsURL is where -fetch downloads the card data from.  mtgjson
+// publishes each file's SHA256, in hex, at the same URL plus ".sha256".
+const atomicCardsURL = "https://mtgjson.com/api/v5/AtomicCards.json"
+
+// fetchFresh is how long -fetch reuses its cached download without checking
+// for a new one.
+const fetchFresh = 24 * time.Hour
+
+// fetchCards returns the path of a copy of the card data at url in dir,
+// downloading it if the cached copy is missing or older than maxAge.  The
+// download is checked against the published SHA256 before it replaces the
+// cached copy.  If the download fails but an older copy is cached, fetchCards
+// returns that copy's path along with the error, so offline runs can go on.
+func fetchCards(client *http.Client, url, dir string, maxAge time.Duration, now time.Time) (string, error) {
+	path := filepath.Join(dir, "AtomicCards.json")
+	info, statErr := os.Stat(path)
+	if statErr == nil && now.Sub(info.ModTime()) < maxAge {
+		return path, nil
+	}
+	if err := download(client, url, path); err != nil {
+		if statErr == nil {
+			return path, err
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// download saves url at path if its contents match url's published SHA256.
+func download(client *http.Client, url, path string) error {
+	sumText, err := get(client, url+".sha256")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(sumText))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s.sha256 is empty", url)
+	}
+	want, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return fmt.Errorf("%s.sha256: %v", url, err)
+	}
+	body, err := get(client, url)
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(body); !bytes.Equal(got[:], want) {
+		return fmt.Errorf("%s: SHA256 is %x; want %x", url, got, want)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// get returns the body of url, or an error if it can't be fetched.
+func get(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// writeSummary describes d: its version, if known, and how many cards are
+// legal in each format.
+func writeSummary(w io.Writer, d deckcount.CardData) {
+	if d.Meta.Version != "" || d.Meta.Date != "" {
+		fmt.Fprintf(w, "mtgjson version %s (%s)\n", d.Meta.Version, d.Meta.Date)
+	}
+	fmt.Fprintf(w, "%d cards\n", len(d.Cards))
+	limits := deckcount.LimitsByFormat(d.Cards)
+	formats := []string{}
+	for f := range limits {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	for _, f := range formats {
+		fmt.Fprintf(w, "%8s: %d legal cards\n", f, len(limits[f]))
+	}
+}
+
+// selectFormats returns the formats named in spec, a comma-separated list
+// like "pioneer,pauper", or defaultFormats if spec is empty.  It's an error to
+// name a format that isn't in limits; the error lists the ones that are.
+func selectFormats(spec string, limits map[string][]int) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return defaultFormats, nil
+	}
+	selected := []string{}
+	for _, f := range strings.Split(spec, ",") {
+		f = deckcount.CanonicalFormat(strings.TrimSpace(f))
+		if _, ok := limits[f]; !ok {
+			known := []string{}
+			for k := range limits {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("%w %q; the data has %s", deckcount.ErrUnknownFormat, f, strings.Join(known, ", "))
+		}
+		selected = append(selected, f)
+	}
+	return selected, nil
+}
+
+// defaultFormats are the formats counted when no other mode is chosen.
+var defaultFormats = []string{"standard", "pioneer", "modern", "legacy", "vintage", "historic"}
+
+// rng is the random source for the randomized modes, so that they never use
+// math/rand's global source.  main seeds it from -seed; math/rand's
+// generator gives the same sequence for a seed on every platform.
+var rng = rand.New(rand.NewSource(1))
+
+// writeLimitHistogram writes a line per limit, smallest first, like
+// "3920 cards at limit 4", then the total.
+func writeLimitHistogram(w io.Writer, named []deckcount.NamedLimit) {
+	hist := deckcount.LimitHistogram(named)
+	lims := []int{}
+	for lim := range hist {
+		lims = append(lims, lim)
 	}
-	sum := big.NewInt(0)
-	for m := 0; m <= numMain && m <= limit[0]; m++ {
-		for s := 0; s <= numSide && m+s <= limit[0]; s++ {
-			sum.Add(sum, _countDecks(numMain-m, numSide-s, limit[1:], cache))
+	sort.Ints(lims)
+	for _, lim := range lims {
+		note := ""
+		if lim >= 1000 {
+			note = " (unlimited)"
 		}
+		fmt.Fprintf(w, "%d cards at limit %d%s\n", hist[lim], lim, note)
 	}
-	cache[key] = sum
-	return sum
+	fmt.Fprintf(w, "%d cards\n", len(named))
 }
@@ -0,0 +1,747 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaaan/games/deckcount"
+)
+
+var sampleJSON = []byte(`{
+	"Llanowar Elves": {
+		"name": "Llanowar Elves",
+		"type": "Creature — Elf Druid",
+		"text": "{T}: Add {G}.",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	},
+	"Thalia, Guardian of Thraben": {
+		"name": "Thalia, Guardian of Thraben",
+		"type": "Legendary Creature — Human Soldier",
+		"supertypes": ["Legendary"],
+		"keywords": ["First strike"],
+		"text": "First strike\nNoncreature spells cost {1} more to cast.",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	},
+	"Island": {
+		"name": "Island",
+		"type": "Basic Land — Island",
+		"supertypes": ["Basic"],
+		"text": "({T}: Add {U}.)",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	}
+}`)
+
+func TestWriteGrid(t *testing.T) {
+	var buf bytes.Buffer
+	writeGrid(&buf, []int{1, 2, 3}, 4)
+	want := "0,1,0.000000\n1,3,0.477121\n2,5,0.698970\n3,6,0.778151\n4,5,0.698970\n"
+	if buf.String() != want {
+		t.Errorf("writeGrid([1 2 3], 4)=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestFormatSci(t *testing.T) {
+	standard, _ := new(big.Int).SetString("395697481306288315500482412588185550997575949463159607457342791398956402454575201937306830423839076258993204642893660863880836081092733403218174252555980", 10)
+	vintage, _ := new(big.Int).SetString("3985786980972339470046639745982013864174118310772370078099163128634390654656416392559271326021684859840974539535937081683655324261736494594244708112735908815730951142524698843844153661953325858096236390658578097533754643413523536", 10)
+	cases := []struct {
+		count *big.Int
+		sig   int
+		want  string
+	}{
+		{big.NewInt(0), 3, "0"},
+		{big.NewInt(1), 3, "1"},
+		{big.NewInt(9), 3, "9"},
+		{big.NewInt(10), 3, "1.00 × 10^1"},
+		{big.NewInt(33), 2, "3.3 × 10^1"},
+		{big.NewInt(99999), 3, "1.00 × 10^5"},
+		{big.NewInt(123456789), 1, "1 × 10^8"},
+		{standard, 3, "3.96 × 10^152"},
+		{standard, 6, "3.95697 × 10^152"},
+		{vintage, 3, "3.99 × 10^228"},
+	}
+	for _, c := range cases {
+		if got := FormatSci(c.count, c.sig); got != c.want {
+			t.Errorf("FormatSci(%.3g, %d)=%q; want %q", new(big.Float).SetInt(c.count), c.sig, got, c.want)
+		}
+	}
+}
+
+func TestCountLine(t *testing.T) {
+	modern, _ := new(big.Int).SetString("5303212499185418908525344852772915685049773837590652362658065020537815355432286385564909790828480055390241936299604049862939115284195644153207212076681276012055210262431562606172865537079398006755301921727478706141752", 10)
+	cases := []struct {
+		sig  int
+		want string
+	}{
+		{3, "5.30 × 10^216"},
+		{5, "5.3032 × 10^216"},
+		{1, "5 × 10^216"},
+	}
+	for _, c := range cases {
+		want := "  modern: " + c.want + " (" + modern.String() + ")"
+		if got := countLine("modern", modern, c.sig); got != want {
+			t.Errorf("countLine(modern, %d)=%q; want %q", c.sig, got, want)
+		}
+	}
+}
+
+func TestExactLine(t *testing.T) {
+	big100, _ := new(big.Int).SetString("1"+strings.Repeat("0", 100), 10)
+	cases := []struct {
+		format string
+		c      *big.Int
+		want   string
+	}{
+		{"modern", big.NewInt(1), "Modern: 1 digits, 1 bits, 1"},
+		{"legacy", big.NewInt(255), "Legacy: 3 digits, 8 bits, 255"},
+		{"vintage", big100, "Vintage: 101 digits, 333 bits, " + big100.String()},
+	}
+	for _, c := range cases {
+		got := exactLine(c.format, c.c)
+		if got != c.want {
+			t.Errorf("exactLine(%s, %v)=%q; want %q", c.format, c.c, got, c.want)
+		}
+	}
+}
+
+func TestLoadCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c := LoadCache(path, DataHash(sampleJSON))
+	if len(c.Counts) != 0 {
+		t.Fatalf("LoadCache(missing file) has counts %v", c.Counts)
+	}
+	c.Put("modern/60/15", big.NewInt(12345))
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := LoadCache(path, DataHash(sampleJSON)).Get("modern/60/15"); !ok || got.Cmp(big.NewInt(12345)) != 0 {
+		t.Errorf("LoadCache(same data).Get()=%v, %v; want 12345, true", got, ok)
+	}
+	// Banning one card changes the data, so the cached count is stale.
+	changed := bytes.Replace(sampleJSON, []byte(`"modern": "Legal", "legacy": "Legal"}
+	},
+	"Thalia`), []byte(`"modern": "Banned", "legacy": "Legal"}
+	},
+	"Thalia`), 1)
+	if bytes.Equal(changed, sampleJSON) {
+		t.Fatal("failed to change sampleJSON")
+	}
+	if got, ok := LoadCache(path, DataHash(changed)).Get("modern/60/15"); ok {
+		t.Errorf("LoadCache(changed data).Get()=%v; want no entry", got)
+	}
+}
+
+func TestLoadMemo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memo.json")
+	memo, err := loadMemo(path)
+	if err != nil || memo.Len() != 0 {
+		t.Fatalf("loadMemo(missing file) has %d counts, %v; want none", memo.Len(), err)
+	}
+	fingerprints := func(mtgJSON []byte) map[string]string {
+		d, err := deckcount.ParseCardData(mtgJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps := map[string]string{}
+		for f, limit := range deckcount.LimitsByFormat(d.Cards) {
+			fps[f] = deckcount.Fingerprint(60, 15, deckcount.LimitClasses(60, 15, limit))
+		}
+		return fps
+	}
+	before := fingerprints(sampleJSON)
+	for f, fp := range before {
+		memo.Put(fp, big.NewInt(int64(len(f))))
+	}
+	if err := saveMemo(path, memo); err != nil {
+		t.Fatal(err)
+	}
+	// Banning a card in Modern leaves Legacy's count in the memo.
+	after := fingerprints(bytes.Replace(sampleJSON, []byte(`"modern": "Legal", "legacy": "Legal"}
+	},
+	"Thalia`), []byte(`"modern": "Banned", "legacy": "Legal"}
+	},
+	"Thalia`), 1))
+	memo, err = loadMemo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := memo.Get(after["legacy"]); !ok || got.Int64() != int64(len("legacy")) {
+		t.Errorf("loadMemo().Get(legacy)=%v, %v; want %d, true", got, ok, len("legacy"))
+	}
+	if got, ok := memo.Get(after["modern"]); ok {
+		t.Errorf("loadMemo().Get(modern after a ban)=%v; want no entry", got)
+	}
+}
+
+func TestWriteIdentityCounts(t *testing.T) {
+	counts := map[string]*big.Int{"UR": big.NewInt(44), "WR": big.NewInt(14), "": big.NewInt(1), "R": big.NewInt(4), "U": big.NewInt(4)}
+	var buf bytes.Buffer
+	writeIdentityCounts(&buf, counts, 2)
+	want := "       C: 1 (1)\n       U: 4 (4)\n       R: 4 (4)\n      WR: 1.4 × 10^1 (14)\n      UR: 4.4 × 10^1 (44)\n   total: 6.7 × 10^1 (67)\n"
+	if buf.String() != want {
+		t.Errorf("writeIdentityCounts()=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestWriteDistinctCounts(t *testing.T) {
+	var buf bytes.Buffer
+	writeDistinctCounts(&buf, []*big.Int{big.NewInt(0), big.NewInt(3), big.NewInt(0), big.NewInt(1200)}, 2)
+	want := "  1 name: 3 (3)\n 3 names: 1.2 × 10^3 (1200)\n   total: 1.2 × 10^3 (1203)\n"
+	if buf.String() != want {
+		t.Errorf("writeDistinctCounts()=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestWriteDeck(t *testing.T) {
+	deck := deckcount.Deck{
+		Main: map[string]int{"Island": 56, "Snapcaster Mage": 4},
+		Side: map[string]int{"Negate": 3},
+	}
+	var buf bytes.Buffer
+	writeDeck(&buf, deck)
+	want := "56 Island\n4 Snapcaster Mage\nSideboard\n3 Negate\n"
+	if buf.String() != want {
+		t.Errorf("writeDeck()=%q; want %q", buf.String(), want)
+	}
+	got, err := deckcount.ParseDeck(&buf)
+	if err != nil || !reflect.DeepEqual(got, deck) {
+		t.Errorf("ParseDeck(writeDeck(%v))=%v, %v; want the same deck", deck, got, err)
+	}
+}
+
+func TestExplainDecks(t *testing.T) {
+	cases := []struct {
+		numMain, numSide int
+		want             string
+	}{
+		{3, 0, "abb\nabc\nacc\nbbc\nbcc\nccc\ntotal: 6\n"},
+		{3, 1, "abb/c\nabc/b\nabc/c\nacc/b\nacc/c\nbbc/a\nbbc/c\nbcc/a\nbcc/b\nbcc/c\nccc/a\nccc/b\ntotal: 12\n"},
+		{4, 2, "abbc/cc\nabcc/bc\naccc/bb\nbbcc/ac\nbccc/ab\ntotal: 5\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := explainDecks(&buf, c.numMain, c.numSide, []int{1, 2, 3}, 100); err != nil {
+			t.Errorf("explainDecks(%d, %d) error: %v", c.numMain, c.numSide, err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("explainDecks(%d, %d)=%q; want %q", c.numMain, c.numSide, buf.String(), c.want)
+		}
+	}
+	var buf bytes.Buffer
+	if err := explainDecks(&buf, 3, 1, []int{1, 2, 3}, 11); err == nil {
+		t.Errorf("explainDecks(12 decks, max 11) succeeded; want error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("explainDecks(12 decks, max 11) wrote %q", buf.String())
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got to the contents of testdata/name, or with -update,
+// rewrites the file.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output doesn't match %s:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestStaleWarning(t *testing.T) {
+	meta := deckcount.Meta{Version: "4.6.3+20200508", Date: "2020-05-08"}
+	cases := []struct {
+		meta    deckcount.Meta
+		now     time.Time
+		maxDays int
+		want    string
+	}{
+		{meta, time.Date(2020, 5, 8, 12, 0, 0, 0, time.UTC), 30, ""},
+		{meta, time.Date(2020, 6, 7, 0, 0, 0, 0, time.UTC), 30, ""},
+		{meta, time.Date(2020, 6, 8, 0, 0, 0, 0, time.UTC), 30, "the card data is from 2020-05-08, 31 days ago; newer sets and bans won't be counted"},
+		{meta, time.Date(2021, 5, 8, 0, 0, 0, 0, time.UTC), 365, ""},
+		{deckcount.Meta{}, time.Date(2020, 5, 8, 0, 0, 0, 0, time.UTC), 30, "the card data has no date; it may be out of date"},
+	}
+	for _, c := range cases {
+		if got := staleWarning(c.meta, c.now, c.maxDays); got != c.want {
+			t.Errorf("staleWarning(%s, %s, %d)=%q; want %q", c.meta.Date, c.now.Format("2006-01-02"), c.maxDays, got, c.want)
+		}
+	}
+	if got := staleWarning(deckcount.Meta{Date: "May 8"}, time.Now(), 30); !strings.HasPrefix(got, "can't read") {
+		t.Errorf("staleWarning(May 8)=%q; want an error", got)
+	}
+}
+
+func TestFetchCards(t *testing.T) {
+	body := []byte(`{"meta": {"version": "5.2.0"}, "data": {}}`)
+	sum := sha256.Sum256(body)
+	published := hex.EncodeToString(sum[:]) + "  AtomicCards.json\n"
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.HasSuffix(r.URL.Path, ".sha256") {
+			w.Write([]byte(published))
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+	url := ts.URL + "/AtomicCards.json"
+	dir := t.TempDir()
+	now := time.Now()
+
+	path, err := fetchCards(ts.Client(), url, dir, time.Hour, now)
+	if err != nil {
+		t.Fatalf("fetchCards() error: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, body) {
+		t.Errorf("fetchCards() saved %q; want %q", got, body)
+	}
+	if requests != 2 {
+		t.Errorf("fetchCards() made %d requests; want 2", requests)
+	}
+
+	// A fresh cache is reused without asking the server.
+	if _, err := fetchCards(ts.Client(), url, dir, time.Hour, now.Add(time.Minute)); err != nil || requests != 2 {
+		t.Errorf("fetchCards(fresh cache): err=%v, %d requests; want no error, 2 requests", err, requests)
+	}
+
+	// A stale cache is replaced only by a download with the right checksum.
+	published = strings.Repeat("0", 64)
+	path, err = fetchCards(ts.Client(), url, dir, time.Hour, now.Add(2*time.Hour))
+	if err == nil || path == "" {
+		t.Errorf("fetchCards(bad checksum)=%q, %v; want the cached path and an error", path, err)
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, body) {
+		t.Errorf("fetchCards(bad checksum) left %q in the cache; want %q", got, body)
+	}
+
+	// Offline, with nothing cached, there is no path to use.
+	ts.Close()
+	if path, err := fetchCards(ts.Client(), url, t.TempDir(), time.Hour, now); err == nil || path != "" {
+		t.Errorf("fetchCards(offline, empty cache)=%q, %v; want an error", path, err)
+	}
+}
+
+func TestReport(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/suspended.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := deckcount.FormatLimits(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 5, 8, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := BuildReport(limits, DataHash(data), now, 6, 2, 1).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.golden", buf.Bytes())
+}
+
+func TestReportCSV(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/suspended.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := deckcount.FormatLimits(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits["alchemy"] = []int{}
+	r := BuildReport(limits, DataHash(data), time.Time{}, 6, 2, 3)
+	for i := range r.Formats {
+		r.Formats[i].Elapsed = time.Duration(i) * time.Millisecond
+	}
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.csv.golden", buf.Bytes())
+}
+
+func TestSelectFormats(t *testing.T) {
+	limits := map[string][]int{"pauper": {4}, "pioneer": {4, 4}, "modern": {4, 4, 4}}
+	cases := []struct {
+		spec string
+		want []string
+	}{
+		{"", defaultFormats},
+		{"pioneer", []string{"pioneer"}},
+		{"Pauper, modern", []string{"pauper", "modern"}},
+	}
+	for _, c := range cases {
+		got, err := selectFormats(c.spec, limits)
+		if err != nil {
+			t.Errorf("selectFormats(%q): %v", c.spec, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("selectFormats(%q)=%v; want %v", c.spec, got, c.want)
+		}
+	}
+	_, err := selectFormats("pioneer,premodern", limits)
+	if want := `unknown format "premodern"; the data has modern, pauper, pioneer`; err == nil || err.Error() != want || !errors.Is(err, deckcount.ErrUnknownFormat) {
+		t.Errorf("selectFormats(premodern) error %v; want %s", err, want)
+	}
+}
+
+func TestAliasFlag(t *testing.T) {
+	var f aliasFlag
+	if err := f.Set("Alias Flag Test=Pauper"); err != nil {
+		t.Fatal(err)
+	}
+	if got := deckcount.CanonicalFormat("aliasflagtest"); got != "pauper" {
+		t.Errorf("after -alias, CanonicalFormat(aliasflagtest)=%q; want pauper", got)
+	}
+	for _, s := range []string{"pdh", "=pauper", "pdh="} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("-alias %s: no error", s)
+		}
+	}
+	// The cache key has the pairs whatever their order.
+	if err := f.Set("Alias Flag Test 2=Modern"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.key(), "Alias Flag Test 2=Modern,Alias Flag Test=Pauper"; got != want {
+		t.Errorf("aliasFlag.key()=%q; want %q", got, want)
+	}
+}
+
+func TestIncludeFlag(t *testing.T) {
+	f := includeFlag{}
+	for _, s := range []string{"4 Lightning Strike", "Shock", "2x Fire // Ice", "1 Shock"} {
+		if err := f.Set(s); err != nil {
+			t.Errorf("-must-include %q: %v", s, err)
+		}
+	}
+	want := includeFlag{"Lightning Strike": 4, "Shock": 2, "Fire // Ice": 2}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("-must-include gave %v; want %v", f, want)
+	}
+	for _, s := range []string{"", "0 Shock", "-1 Shock"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("-must-include %q: no error", s)
+		}
+	}
+}
+
+func TestTypeFlag(t *testing.T) {
+	var f typeFlag
+	for _, s := range []string{"Land:20-26", "Creature:-20", "Artifact:3-", "Enchantment:0"} {
+		if err := f.Set(s); err != nil {
+			t.Errorf("-type %q: %v", s, err)
+		}
+	}
+	want := typeFlag{{Type: "Land", Min: 20, Max: 26}, {Type: "Creature", Min: 0, Max: 20}, {Type: "Artifact", Min: 3, Max: -1}, {Type: "Enchantment", Min: 0, Max: 0}}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("-type gave %v; want %v", f, want)
+	}
+	for _, s := range []string{"Land", "Land:", "Land:-", ":20-26", "Land:x-3"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("-type %q: no error", s)
+		}
+	}
+}
+
+func TestWriteLimitHistogram(t *testing.T) {
+	legal := map[string]string{"vintage": "Legal"}
+	cards := map[string]deckcount.Card{
+		"Island":      {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Swamp":       {Name: "Swamp", Type: "Basic Land — Swamp", Legalities: legal},
+		"Black Lotus": {Name: "Black Lotus", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Opt":         {Name: "Opt", Legalities: legal},
+		"Brainstorm":  {Name: "Brainstorm", Legalities: legal},
+		"Ponder":      {Name: "Ponder", Legalities: legal},
+	}
+	named := deckcount.NamedLimits(cards, "vintage")
+	var buf bytes.Buffer
+	writeLimitHistogram(&buf, named)
+	want := "1 cards at limit 1\n3 cards at limit 4\n2 cards at limit 1000 (unlimited)\n6 cards\n"
+	if buf.String() != want {
+		t.Errorf("writeLimitHistogram()=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestRenderProgress(t *testing.T) {
+	cases := []struct {
+		done, total int
+		elapsed     time.Duration
+		want        string
+	}{
+		{0, 10, 0, "  modern [>                                       ]   0% ETA 0s"},
+		{5, 10, 3 * time.Second, "  modern [====================>                   ]  50% ETA 3s"},
+		{10, 10, 6 * time.Second, "  modern [========================================] 100% ETA 0s"},
+	}
+	for _, c := range cases {
+		got := renderProgress("modern", c.done, c.total, c.elapsed)
+		if got != c.want {
+			t.Errorf("renderProgress(%d, %d, %v)=%q; want %q", c.done, c.total, c.elapsed, got, c.want)
+		}
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/wrapped.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := deckcount.ParseCardData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeSummary(&buf, d)
+	want := "mtgjson version 4.6.3+20200508 (2020-05-08)\n3 cards\n  modern: 2 legal cards\n vintage: 3 legal cards\n"
+	if buf.String() != want {
+		t.Errorf("writeSummary()=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestCompareCounts(t *testing.T) {
+	before, err := loadLimits("testdata/compare_old.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := loadLimits("testdata/compare_new.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		format string
+		want   string
+	}{
+		// Adding Consider takes the 6+2 card Vintage decks from 33 to 262.
+		{"vintage", "vintage: 33 -> 262 (+693.9%, log10 +0.8998)\n"},
+		{"pioneer", "pioneer: new: 106\n"},
+		// Opt at (main, side) = (0-4, 0), (0-3, 1), or (0-2, 2).
+		{"legacy", "legacy: removed: was 12\n"},
+		{"modern", "modern: in neither file\n"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		compareCounts(&buf, before, after, c.format, 6, 2)
+		if buf.String() != c.want {
+			t.Errorf("compareCounts(%s)=%q; want %q", c.format, buf.String(), c.want)
+		}
+	}
+	if got := Ratio(big.NewInt(3), big.NewInt(2)); got != 1.5 {
+		t.Errorf("Ratio(3, 2)=%v; want 1.5", got)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cpuPath, memPath := filepath.Join(dir, "cpu.prof"), filepath.Join(dir, "mem.prof")
+	stop, err := startProfiles(cpuPath, memPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := deckcount.CountDecks(60, 15, []int{1, 4, 4, 4, 1000, 1000})
+	stop()
+	// Profiling doesn't change the count.
+	if want := deckcount.CountDecksProgress(60, 15, []int{1, 4, 4, 4, 1000, 1000}, func(int, int) {}); got.Cmp(want) != 0 {
+		t.Errorf("CountDecks while profiling=%v; want %v", got, want)
+	}
+	for _, path := range []string{cpuPath, memPath} {
+		if fi, err := os.Stat(path); err != nil {
+			t.Error(err)
+		} else if fi.Size() == 0 {
+			t.Errorf("%s is empty", path)
+		}
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	limits := map[string][]int{"modern": {1, 2, 3}, "vintage": {75}}
+	srv := httptest.NewServer(BatchHandler(limits, 2))
+	defer srv.Close()
+	body := `[{"format": "modern", "main": 3, "side": 1}, {"format": "pauper", "main": 60, "side": 15},
+		{"format": "Vintage", "main": 60, "side": 15}, {"format": "modern", "main": -1}]`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /batch status %s", resp.Status)
+	}
+	var got []BatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchResult{
+		{BatchQuery: BatchQuery{"modern", 3, 1}, Count: big.NewInt(12)},
+		{BatchQuery: BatchQuery{"pauper", 60, 15}, Error: `unknown format "pauper"`},
+		{BatchQuery: BatchQuery{"Vintage", 60, 15}, Count: big.NewInt(1)},
+		{BatchQuery: BatchQuery{"modern", -1, 0}, Error: "deck sizes must be nonnegative, with at most 250 cards in all"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("POST /batch=%+v; want %+v", got, want)
+	}
+
+	resp, err = http.Post(srv.URL, "application/json", strings.NewReader(`{"format": "modern"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /batch with an object: status %s; want 400", resp.Status)
+	}
+}
+
+func TestBatchHandlerCancel(t *testing.T) {
+	// A count far too big to finish unless it's abandoned.
+	limit := make([]int, 100000)
+	for i := range limit {
+		limit[i] = 4
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"format": "vintage", "main": 200, "side": 50}]`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		BatchHandler(map[string][]int{"vintage": limit}, 1).ServeHTTP(w, req)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("POST /batch didn't stop when the client went away")
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("POST /batch answered a cancelled request: %s", w.Body)
+	}
+}
+
+func TestPullLine(t *testing.T) {
+	got := pullLine("Mythic 0", "mythic", big.NewRat(1, 16))
+	want := "Mythic 0 (mythic): 6.25% a pack (1 in 16), 90.21% a box of 36"
+	if got != want {
+		t.Errorf("pullLine()=%q; want %q", got, want)
+	}
+}
+
+func TestWriteCompanionCounts(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]deckcount.Card{
+		"Island":                  {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Fact or Fiction":         {Name: "Fact or Fiction", Type: "Instant", ConvertedManaCost: 4, Legalities: legal},
+		"Keruga, the Macrosage":   {Name: "Keruga, the Macrosage", Type: "Legendary Creature — Dinosaur Hippo", ConvertedManaCost: 5, Legalities: legal},
+		"Lurrus of the Dream-Den": {Name: "Lurrus of the Dream-Den", Type: "Legendary Creature — Cat Nightmare", ConvertedManaCost: 3},
+	}
+	var buf bytes.Buffer
+	if err := writeCompanionCounts(&buf, 2, 1, cards, "modern", "all", 3); err != nil {
+		t.Fatal(err)
+	}
+	// Keruga in the sideboard, and Islands, Fact or Fiction, and Keruga in
+	// the main deck: 6 decks.
+	if want := "  Keruga: 6 (6)\n"; buf.String() != want {
+		t.Errorf("writeCompanionCounts(all)=%q; want %q", buf.String(), want)
+	}
+	if err := writeCompanionCounts(&buf, 2, 1, cards, "modern", "lurrus", 3); err == nil {
+		t.Errorf("writeCompanionCounts(lurrus) succeeded; want an error for Lurrus, which isn't legal")
+	}
+}
+
+func TestOddsLine(t *testing.T) {
+	q, err := deckcount.ParseHandQuery("2 lands in 3 cards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "at least 2 lands in opening 3: 92.59% (25/27)"
+	if got := oddsLine(q, big.NewRat(25, 27)); got != want {
+		t.Errorf("oddsLine()=%q; want %q", got, want)
+	}
+}
+
+func TestWriteMulligans(t *testing.T) {
+	keep, err := deckcount.ParseHandQuery("2-4 lands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := deckcount.Mulligan{Keep: keep, Goal: keep, MaxMulligans: 1, Turn: 2, OnDraw: true}
+	r := deckcount.MulliganResult{Trials: 400, Kept: []int{300, 80}, Goal: 350}
+	var buf bytes.Buffer
+	writeMulligans(&buf, m, r, []*big.Rat{big.NewRat(3, 4), big.NewRat(1, 5)})
+	want := "keep 2-4 lands:\n" +
+		" 7 cards: 75.00% (exactly 75.00%)\n" +
+		" 6 cards: 20.00% (exactly 20.00%)\n" +
+		"  forced: 5.00% (exactly 5.00%)\n" +
+		"goal 2-4 lands by turn 2 on the draw: 87.50% of 400 trials\n"
+	if buf.String() != want {
+		t.Errorf("writeMulligans()=%q; want %q", buf.String(), want)
+	}
+}
+
+func TestCurveFlag(t *testing.T) {
+	var f curveFlag
+	for _, s := range []string{"1:8-", "5+:-4", "2-3:10-14", "0:2"} {
+		if err := f.Set(s); err != nil {
+			t.Errorf("Set(%q) err=%v", s, err)
+		}
+	}
+	want := curveFlag{
+		{Low: 1, High: 1, Min: 8, Max: -1},
+		{Low: 5, High: -1, Min: 0, Max: 4},
+		{Low: 2, High: 3, Min: 10, Max: 14},
+		{Low: 0, High: 0, Min: 2, Max: 2},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("curveFlag=%v; want %v", f, want)
+	}
+	for _, s := range []string{"1", ":8", "2-:8", "x+:8", "1:", "1:a-b"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%q) err=nil; want an error", s)
+		}
+	}
+}
+
+func TestValidateDeck(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]deckcount.Card{
+		"Opt":    {Name: "Opt", Type: "Instant", Legalities: legal},
+		"Island": {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	path := filepath.Join(t.TempDir(), "deck.txt")
+	if err := ioutil.WriteFile(path, []byte("5 Opt\n55 Island\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	ok, err := validateDeck(&buf, path, cards, "Modern")
+	want := `{"format":"modern","legal":false,"issues":[{"card":"Opt","have":5,"max":4,"reason":"too many copies"}]}` + "\n"
+	if err != nil || ok || buf.String() != want {
+		t.Errorf("validateDeck()=%v, %v, wrote %q; want false, nil, %q", ok, err, buf.String(), want)
+	}
+	if _, err := validateDeck(&buf, filepath.Join(t.TempDir(), "missing.txt"), cards, "modern"); err == nil {
+		t.Errorf("validateDeck(missing file) err=nil; want an error")
+	}
+}
@@ -0,0 +1,213 @@
+package deckcount
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Printing is a card as printed in a set, as in the set's "cards" list in
+// mtgjson's AllPrintings.json or a single set's file.
+type Printing struct {
+	Name          string
+	Rarity        string   // "common", "uncommon", "rare", "mythic", or "special".
+	Supertypes    []string // E.g. ["Basic"].
+	BoosterTypes  []string // E.g. ["default"]; newer data only.
+	IsPromo       bool
+	IsAlternative bool
+	IsStarter     bool
+}
+
+// SetData is a set's code, name, and printings.
+type SetData struct {
+	Code  string
+	Name  string
+	Cards []Printing
+}
+
+// ParseSetData returns the set with code setCode (in any case) from an
+// AllPrintings file, whose data is an object of sets by code, or from a
+// single set's file, whose data is the set.
+func ParseSetData(data []byte, setCode string) (SetData, error) {
+	var top struct {
+		Data json.RawMessage
+	}
+	if err := json.Unmarshal(data, &top); err != nil {
+		return SetData{}, schemaError(fmt.Sprintf("set data: %v", err))
+	}
+	if top.Data == nil {
+		return SetData{}, schemaError("set data has no data")
+	}
+	var set SetData
+	if err := json.Unmarshal(top.Data, &set); err == nil && set.Code != "" {
+		if !strings.EqualFold(set.Code, setCode) {
+			return SetData{}, fmt.Errorf("%w %q: the file is of %s", ErrUnknownSet, setCode, set.Code)
+		}
+		return set, nil
+	}
+	var sets map[string]json.RawMessage
+	if err := json.Unmarshal(top.Data, &sets); err != nil {
+		return SetData{}, schemaError(fmt.Sprintf("set data: %v", err))
+	}
+	for code, raw := range sets {
+		if strings.EqualFold(code, setCode) {
+			if err := json.Unmarshal(raw, &set); err != nil {
+				return SetData{}, schemaError(fmt.Sprintf("%s: %v", code, err))
+			}
+			return set, nil
+		}
+	}
+	return SetData{}, fmt.Errorf("%w %q", ErrUnknownSet, setCode)
+}
+
+// inBoosters reports whether p appears in the set's regular boosters: it's
+// no promo, alternate art, starter deck card, or basic land (those have a
+// slot of their own), and, in data that says, it's in default boosters.
+func (p Printing) inBoosters() bool {
+	if p.IsPromo || p.IsAlternative || p.IsStarter {
+		return false
+	}
+	for _, s := range p.Supertypes {
+		if s == "Basic" {
+			return false
+		}
+	}
+	if len(p.BoosterTypes) == 0 {
+		return true
+	}
+	for _, t := range p.BoosterTypes {
+		if t == "default" {
+			return true
+		}
+	}
+	return false
+}
+
+// Collation is how many cards of each rarity a booster has.  Each rare slot
+// holds a mythic rare instead one time in MythicOdds, if the set has any.
+type Collation struct {
+	Commons, Uncommons, Rares int
+	MythicOdds                int
+}
+
+// DefaultCollation is the collation of most sets' draft boosters since the
+// introduction of mythic rares, leaving out the basic land slot.
+var DefaultCollation = Collation{Commons: 10, Uncommons: 3, Rares: 1, MythicOdds: 8}
+
+// ParseCollation reads a collation written as "commons,uncommons,rares" or
+// "commons,uncommons,rares,mythic odds", such as "10,3,1,8".  Without the
+// mythic odds, they're DefaultCollation's.
+func ParseCollation(s string) (Collation, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 3 && len(fields) != 4 {
+		return Collation{}, fmt.Errorf("%w %q: want commons,uncommons,rares[,mythic odds]", ErrBadCollation, s)
+	}
+	n := make([]int, 4)
+	n[3] = DefaultCollation.MythicOdds
+	for i, f := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 0 || i == 3 && v < 1 {
+			return Collation{}, fmt.Errorf("%w %q: %q isn't a count", ErrBadCollation, s, f)
+		}
+		n[i] = v
+	}
+	return Collation{n[0], n[1], n[2], n[3]}, nil
+}
+
+// Booster describes a set's boosters: the distinct names at each rarity, and
+// the collation.  Reprints of a name at a rarity, such as showcase frames,
+// are the same card, so packs are told apart by their cards' names.
+type Booster struct {
+	Set                               string
+	Commons, Uncommons, Rares, Mythic []string
+	Collation
+}
+
+// NewBooster returns the boosters of set with collation col.  It's an error
+// if the set has too few cards of a rarity to fill its slots.
+func NewBooster(set SetData, col Collation) (Booster, error) {
+	byRarity := map[string]map[string]bool{}
+	for _, p := range set.Cards {
+		if !p.inBoosters() {
+			continue
+		}
+		if byRarity[p.Rarity] == nil {
+			byRarity[p.Rarity] = map[string]bool{}
+		}
+		byRarity[p.Rarity][p.Name] = true
+	}
+	names := func(rarity string) []string {
+		list := []string{}
+		for name := range byRarity[rarity] {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		return list
+	}
+	b := Booster{set.Code, names("common"), names("uncommon"), names("rare"), names("mythic"), col}
+	switch {
+	case len(b.Commons) < col.Commons:
+		return Booster{}, fmt.Errorf("%w: %s has %d commons for %d slots", ErrBadCollation, set.Code, len(b.Commons), col.Commons)
+	case len(b.Uncommons) < col.Uncommons:
+		return Booster{}, fmt.Errorf("%w: %s has %d uncommons for %d slots", ErrBadCollation, set.Code, len(b.Uncommons), col.Uncommons)
+	case len(b.Rares)+len(b.Mythic) < col.Rares || len(b.Rares) == 0 && col.Rares > 0:
+		return Booster{}, fmt.Errorf("%w: %s has %d rares and %d mythics for %d slots", ErrBadCollation, set.Code, len(b.Rares), len(b.Mythic), col.Rares)
+	}
+	return b, nil
+}
+
+// CountPacks returns the number of distinct packs: the ways to choose the
+// commons, times the ways to choose the uncommons, times the ways to choose
+// the rare slots' cards from the rares and mythics together.
+func (b Booster) CountPacks() *big.Int {
+	n := new(big.Int).Binomial(int64(len(b.Commons)), int64(b.Collation.Commons))
+	n.Mul(n, new(big.Int).Binomial(int64(len(b.Uncommons)), int64(b.Collation.Uncommons)))
+	return n.Mul(n, new(big.Int).Binomial(int64(len(b.Rares)+len(b.Mythic)), int64(b.Collation.Rares)))
+}
+
+// PullChance returns the chance that a pack has the card named name, and
+// its rarity.  A common is in Commons of the pack's len(Commons) commons,
+// each equally likely, and likewise an uncommon.  A rare slot holds a given
+// mythic with chance 1/(MythicOdds * len(Mythic)), and a given rare with the
+// rest of the chance shared by the rares; the rare slots are taken to be
+// independent, which is exact for the usual one.
+func (b Booster) PullChance(name string) (*big.Rat, string, error) {
+	c := b.Collation
+	find := func(names []string) bool {
+		i := sort.SearchStrings(names, name)
+		return i < len(names) && names[i] == name
+	}
+	switch {
+	case find(b.Commons):
+		return big.NewRat(int64(c.Commons), int64(len(b.Commons))), "common", nil
+	case find(b.Uncommons):
+		return big.NewRat(int64(c.Uncommons), int64(len(b.Uncommons))), "uncommon", nil
+	}
+	mythic := find(b.Mythic)
+	if !mythic && !find(b.Rares) {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotInPacks, name)
+	}
+	// The chance a rare slot holds the card.
+	slot, rarity := big.NewRat(1, int64(len(b.Rares)+len(b.Mythic))), "rare"
+	switch {
+	case mythic:
+		slot, rarity = big.NewRat(1, int64(c.MythicOdds*len(b.Mythic))), "mythic"
+	case len(b.Mythic) > 0:
+		slot = big.NewRat(int64(c.MythicOdds-1), int64(c.MythicOdds*len(b.Rares)))
+	}
+	return ChanceInPacks(slot, c.Rares), rarity, nil
+}
+
+// ChanceInPacks returns the chance that something with chance p in each of
+// n independent tries happens at least once: 1 - (1-p)^n.
+func ChanceInPacks(p *big.Rat, n int) *big.Rat {
+	miss := new(big.Rat).Sub(big.NewRat(1, 1), p)
+	all := big.NewRat(1, 1)
+	for i := 0; i < n; i++ {
+		all.Mul(all, miss)
+	}
+	return all.Sub(big.NewRat(1, 1), all)
+}
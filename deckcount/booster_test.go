@@ -0,0 +1,119 @@
+package deckcount
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestParseSetData(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/printings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParseSetData(data, "tst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Code != "TST" || set.Name != "Test Set" || len(set.Cards) != 26 {
+		t.Errorf("ParseSetData(tst)=%s %q with %d cards; want TST \"Test Set\" with 26", set.Code, set.Name, len(set.Cards))
+	}
+	if _, err := ParseSetData(data, "XYZ"); !errors.Is(err, ErrUnknownSet) {
+		t.Errorf("ParseSetData(XYZ) err=%v; want ErrUnknownSet", err)
+	}
+	// A single set's file has the set as its data.
+	single := []byte(`{"meta": {}, "data": {"code": "ONE", "name": "One", "cards": [{"name": "Opt", "rarity": "common"}]}}`)
+	if set, err := ParseSetData(single, "ONE"); err != nil || len(set.Cards) != 1 {
+		t.Errorf("ParseSetData(single set)=%v, %v; want its one card", set, err)
+	}
+	if _, err := ParseSetData(single, "TWO"); !errors.Is(err, ErrUnknownSet) {
+		t.Errorf("ParseSetData(single set, TWO) err=%v; want ErrUnknownSet", err)
+	}
+	if _, err := ParseSetData([]byte(`[]`), "TST"); !errors.Is(err, ErrSchema) {
+		t.Errorf("ParseSetData([]) err=%v; want ErrSchema", err)
+	}
+}
+
+func testBooster(t *testing.T) Booster {
+	data, err := ioutil.ReadFile("testdata/printings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParseSetData(data, "TST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBooster(set, DefaultCollation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestNewBooster(t *testing.T) {
+	b := testBooster(t)
+	// The showcase Common 00 is a reprint; the basic, the promo, and the
+	// collector booster's mythic aren't in the packs.
+	got := []int{len(b.Commons), len(b.Uncommons), len(b.Rares), len(b.Mythic)}
+	if want := []int{12, 5, 3, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NewBooster() has %v commons, uncommons, rares, and mythics; want %v", got, want)
+	}
+	// C(12, 10) * C(5, 3) * C(3+2, 1)
+	if got := b.CountPacks(); got.Cmp(big.NewInt(66*10*5)) != 0 {
+		t.Errorf("CountPacks()=%v; want %d", got, 66*10*5)
+	}
+	set := SetData{Code: "TST", Cards: []Printing{{Name: "Opt", Rarity: "common"}}}
+	if _, err := NewBooster(set, DefaultCollation); !errors.Is(err, ErrBadCollation) {
+		t.Errorf("NewBooster(1 common) err=%v; want ErrBadCollation", err)
+	}
+}
+
+func TestPullChance(t *testing.T) {
+	b := testBooster(t)
+	cases := []struct {
+		name, rarity string
+		want         *big.Rat
+	}{
+		{"Common 03", "common", big.NewRat(10, 12)},
+		{"Uncommon 1", "uncommon", big.NewRat(3, 5)},
+		{"Rare 2", "rare", big.NewRat(7, 8*3)},
+		{"Mythic 0", "mythic", big.NewRat(1, 8*2)},
+	}
+	for _, c := range cases {
+		got, rarity, err := b.PullChance(c.name)
+		if err != nil || got.Cmp(c.want) != 0 || rarity != c.rarity {
+			t.Errorf("PullChance(%s)=%v, %s, %v; want %v, %s", c.name, got, rarity, err, c.want, c.rarity)
+		}
+	}
+	for _, name := range []string{"Island", "Promo Dragon", "Box Topper", "Black Lotus"} {
+		if _, _, err := b.PullChance(name); !errors.Is(err, ErrNotInPacks) {
+			t.Errorf("PullChance(%s) err=%v; want ErrNotInPacks", name, err)
+		}
+	}
+	if got, want := ChanceInPacks(big.NewRat(1, 16), 2), big.NewRat(31, 256); got.Cmp(want) != 0 {
+		t.Errorf("ChanceInPacks(1/16, 2)=%v; want %v", got, want)
+	}
+}
+
+func TestParseCollation(t *testing.T) {
+	cases := []struct {
+		s    string
+		want Collation
+	}{
+		{"10,3,1", DefaultCollation},
+		{"10, 3, 1, 7", Collation{10, 3, 1, 7}},
+		{"14,0,1,8", Collation{14, 0, 1, 8}},
+	}
+	for _, c := range cases {
+		if got, err := ParseCollation(c.s); err != nil || got != c.want {
+			t.Errorf("ParseCollation(%q)=%v, %v; want %v", c.s, got, err, c.want)
+		}
+	}
+	for _, s := range []string{"", "10,3", "10,3,1,0", "10,-3,1", "ten,3,1", "10,3,1,8,1"} {
+		if _, err := ParseCollation(s); !errors.Is(err, ErrBadCollation) {
+			t.Errorf("ParseCollation(%q) err=%v; want ErrBadCollation", s, err)
+		}
+	}
+}
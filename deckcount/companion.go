@@ -0,0 +1,361 @@
+package deckcount
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// companion is a companion's deckbuilding restriction on the starting deck,
+// which is the main deck: allows reports whether a card may be in it,
+// singleton limits its nonland cards to a copy each, sharesType requires its
+// nonland cards to share a card type, and extraMain is how many cards over
+// the minimum it must have.
+type companion struct {
+	restriction string
+	allows      func(Card) bool
+	singleton   bool
+	sharesType  bool
+	extraMain   int
+}
+
+// companions are the companions by name, with their restrictions' text.
+var companions = map[string]companion{
+	"Gyruda, Doom of Depths": {
+		restriction: "Each nonland card in your starting deck has an even mana value.",
+		allows:      func(c Card) bool { return c.IsLand() || c.CMC()%2 == 0 },
+	},
+	"Jegantha, the Wellspring": {
+		restriction: "No card in your starting deck has more than one of the same mana symbol in its mana cost.",
+		allows:      func(c Card) bool { return !repeatsManaSymbol(c.ManaCost) },
+	},
+	"Kaheera, the Orphanguard": {
+		restriction: "Each creature card in your starting deck is a Cat, Elemental, Nightmare, Dinosaur, or Beast card.",
+		allows: func(c Card) bool {
+			if !c.HasType("Creature") || c.HasKeyword("Changeling") {
+				return true
+			}
+			for _, t := range []string{"Cat", "Elemental", "Nightmare", "Dinosaur", "Beast"} {
+				if c.HasSubtype(t) {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	"Keruga, the Macrosage": {
+		restriction: "Each nonland card in your starting deck has mana value 3 or greater.",
+		allows:      func(c Card) bool { return c.IsLand() || c.CMC() >= 3 },
+	},
+	"Lurrus of the Dream-Den": {
+		restriction: "Each permanent card in your starting deck has mana value 2 or less.",
+		allows:      func(c Card) bool { return !c.IsPermanent() || c.CMC() <= 2 },
+	},
+	"Lutri, the Spellchaser": {
+		restriction: "Each nonland card in your starting deck has a different name.",
+		singleton:   true,
+	},
+	"Obosh, the Preypiercer": {
+		restriction: "Each nonland card in your starting deck has an odd mana value.",
+		allows:      func(c Card) bool { return c.IsLand() || c.CMC()%2 == 1 },
+	},
+	"Umori, the Collector": {
+		restriction: "Each nonland card in your starting deck shares a card type.",
+		sharesType:  true,
+	},
+	"Yorion, Sky Nomad": {
+		restriction: "Your starting deck contains at least twenty cards more than the minimum starting deck size.",
+		extraMain:   20,
+	},
+	"Zirda, the Dawnwaker": {
+		restriction: "Each permanent card in your starting deck has an activated ability.",
+		allows:      func(c Card) bool { return !c.IsPermanent() || c.hasActivatedAbility() },
+	},
+}
+
+// Companions returns the companions' names, in order.
+func Companions() []string {
+	names := []string{}
+	for name := range companions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompanionRestriction returns the restriction of the companion named name,
+// as for CountCompanionDecks, and its full name.
+func CompanionRestriction(name string) (fullName, restriction string, err error) {
+	for _, full := range Companions() {
+		short := strings.TrimSuffix(strings.Fields(full)[0], ",")
+		if strings.EqualFold(name, full) || strings.EqualFold(name, short) {
+			return full, companions[full].restriction, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %q", ErrNotCompanion, name)
+}
+
+// IsPermanent reports whether c has a permanent card type.
+func (c Card) IsPermanent() bool {
+	for _, t := range []string{"Artifact", "Battle", "Creature", "Enchantment", "Land", "Planeswalker"} {
+		if c.HasType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// activatedKeywords are keywords for activated abilities whose reminder text
+// may be missing.
+var activatedKeywords = []string{"Crew", "Cycling", "Equip", "Fortify", "Level up", "Outlast", "Reconfigure"}
+
+// hasActivatedAbility reports whether c's text has an activated ability, a
+// "cost: effect" line, counting the reminder text of basic lands' and other
+// keywords' abilities.
+func (c Card) hasActivatedAbility() bool {
+	if strings.Contains(c.Text, ":") || c.IsBasicLand() {
+		return true
+	}
+	for _, kw := range activatedKeywords {
+		if c.HasKeyword(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatsManaSymbol reports whether cost, such as "{1}{R}{R}", has some
+// symbol more than once.
+func repeatsManaSymbol(cost string) bool {
+	seen := map[string]bool{}
+	for _, sym := range strings.Split(cost, "}") {
+		if sym == "" {
+			continue
+		}
+		if seen[sym] {
+			return true
+		}
+		seen[sym] = true
+	}
+	return false
+}
+
+// cardTypes are the card types that Umori's restriction looks at.
+var cardTypes = []string{"Artifact", "Battle", "Creature", "Enchantment", "Instant", "Kindred", "Planeswalker", "Sorcery", "Tribal"}
+
+// CountCompanionDecks counts the decks in format that can have the companion
+// named name, as for CompanionRestriction: decks with a copy of it in the
+// sideboard whose main decks keep to its restriction.  Setting that copy
+// aside leaves decks of numSide-1 sideboard cards in which the companion is
+// allowed a copy fewer.  Yorion's decks have numMain+20 main deck cards.
+//
+// Each card may have up to its limit in copies in both zones together, but a
+// restriction caps its main deck copies: at 0 for cards it doesn't allow and
+// at 1 for Lutri's nonland cards.  Umori's decks are counted by inclusion and
+// exclusion over the sets of card types their nonland cards all have.
+func CountCompanionDecks(numMain, numSide int, cards map[string]Card, format, name string) (*big.Int, error) {
+	full, _, err := CompanionRestriction(name)
+	if err != nil {
+		return nil, err
+	}
+	comp := companions[full]
+	c, ok := cards[full]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, full)
+	case c.Limit(format) == 0:
+		return nil, fmt.Errorf("%w: %s isn't legal in %s", ErrBadDecklist, full, format)
+	case numMain < 0 || numSide < 1:
+		return nil, fmt.Errorf("%w: %d+%d has no room for a companion", ErrDeckSize, numMain, numSide)
+	}
+	numMain += comp.extraMain
+	numSide--
+	limit := func(c Card) int {
+		if c.Name == full {
+			return c.Limit(format) - 1
+		}
+		return c.Limit(format)
+	}
+	allows := comp.allows
+	if allows == nil {
+		allows = func(Card) bool { return true }
+	}
+	mainCap := func(c Card, lim int) int {
+		switch {
+		case !allows(c):
+			return 0
+		case comp.singleton && !c.IsLand() && lim > 1:
+			return 1
+		}
+		return lim
+	}
+	if !comp.sharesType {
+		return countMainCapped(numMain, numSide, cards, limit, mainCap), nil
+	}
+	masks := map[string]int{} // Each nonland card's types, as bits of cardTypes.
+	distinct := map[int]bool{}
+	for _, c := range cards {
+		if c.IsLand() || limit(c) <= 0 {
+			continue
+		}
+		for i, t := range cardTypes {
+			if c.HasType(t) {
+				masks[c.Name] |= 1 << i
+			}
+		}
+		distinct[masks[c.Name]] = true
+	}
+	// A type set's cards are those whose types include it, so type sets
+	// included in the same cards' types, such as those no card has, have
+	// the same count, and each is counted once.
+	seen := map[string]*big.Int{}
+	sum := new(big.Int)
+	for set := 1; set < 1<<len(cardTypes); set++ {
+		supersets := []int{}
+		for m := range distinct {
+			if m&set == set {
+				supersets = append(supersets, m)
+			}
+		}
+		sort.Ints(supersets)
+		key := fmt.Sprint(supersets)
+		n, ok := seen[key]
+		if !ok {
+			n = countMainCapped(numMain, numSide, cards, limit, func(c Card, lim int) int {
+				if c.IsLand() || masks[c.Name]&set == set {
+					return lim
+				}
+				return 0
+			})
+			seen[key] = n
+		}
+		if bits.OnesCount(uint(set))%2 == 1 {
+			sum.Add(sum, n)
+		} else {
+			sum.Sub(sum, n)
+		}
+	}
+	return sum, nil
+}
+
+// countMainCapped counts the decks of numMain and numSide cards with up to
+// limit(c) copies of each card c, of which up to mainCap(c, limit(c)) are in
+// the main deck.  The cards with no cap, those kept out of the main deck, and
+// each class of capped cards with the same limit and cap have tables of
+// their own, whose product has the count at x^numMain y^numSide.
+func countMainCapped(numMain, numSide int, cards map[string]Card, limit func(Card) int, mainCap func(Card, int) int) *big.Int {
+	var both, sideOnly []int
+	type capped struct{ lim, max int }
+	classes := map[capped]int{}
+	for _, c := range cards {
+		lim := limit(c)
+		if lim <= 0 {
+			continue
+		}
+		if lim > numMain+numSide {
+			lim = numMain + numSide
+		}
+		switch k := mainCap(c, lim); {
+		case k >= lim:
+			both = append(both, lim)
+		case k <= 0:
+			sideOnly = append(sideOnly, lim)
+		default:
+			classes[capped{lim, k}]++
+		}
+	}
+	tables := [][][]*big.Int{limitTable(numMain, numSide, both)}
+	side := newTable(numMain+1, numSide+1)
+	for s, n := range DeckCountsBySize(sideOnly, numSide) {
+		side[0][s] = n
+	}
+	tables = append(tables, side)
+	keys := []capped{}
+	for k := range classes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].lim < keys[j].lim || keys[i].lim == keys[j].lim && keys[i].max < keys[j].max
+	})
+	for _, k := range keys {
+		tables = append(tables, cappedPower(numMain, numSide, k.lim, k.max, classes[k]))
+	}
+	return productAt(tables, numMain, numSide)
+}
+
+// cappedPower returns the table of n cards each with up to lim copies, of
+// which up to mainMax are in the main deck, by repeated squaring.
+func cappedPower(numMain, numSide, lim, mainMax, n int) [][]*big.Int {
+	f := newTable(numMain+1, numSide+1)
+	for a := 0; a <= mainMax && a <= numMain; a++ {
+		for b := 0; a+b <= lim && b <= numSide; b++ {
+			f[a][b].SetInt64(1)
+		}
+	}
+	p := newTable(numMain+1, numSide+1)
+	p[0][0].SetInt64(1)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			p = mulTables(p, f, defaults.workers)
+		}
+		if n > 1 {
+			f = mulTables(f, f, defaults.workers)
+		}
+	}
+	return p
+}
+
+// companionIssues returns the ways deck breaks the rules for its companion,
+// if it has one: an issue for a companion that isn't one or isn't in the
+// sideboard, a card issue, by name, for each main deck card that isn't
+// allowed or, for Lutri, has too many copies, and for Umori, an issue with no
+// card if the nonland cards share no card type.  Yorion's deck size is left
+// to ValidateJSON.
+func companionIssues(deck Deck, cards map[string]Card) []DeckIssue {
+	if deck.Companion == "" {
+		return nil
+	}
+	comp, ok := companions[deck.Companion]
+	if !ok {
+		return []DeckIssue{{Card: deck.Companion, Reason: "not a companion"}}
+	}
+	var issues []DeckIssue
+	if deck.Side[deck.Companion] == 0 {
+		issues = append(issues, DeckIssue{Card: deck.Companion, Max: 1, Reason: "companion isn't in the sideboard"})
+	}
+	names := []string{}
+	for name := range deck.Main {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reason := "breaks " + deck.Companion + "'s restriction"
+	shared, nonland := 1<<len(cardTypes)-1, 0
+	for _, name := range names {
+		c, ok := cards[name]
+		if !ok {
+			continue // ValidateJSON reports it.
+		}
+		switch have := deck.Main[name]; {
+		case comp.allows != nil && !comp.allows(c):
+			issues = append(issues, DeckIssue{Card: name, Have: have, Max: 0, Reason: reason})
+		case comp.singleton && !c.IsLand() && have > 1:
+			issues = append(issues, DeckIssue{Card: name, Have: have, Max: 1, Reason: reason})
+		}
+		if comp.sharesType && !c.IsLand() {
+			mask := 0
+			for i, t := range cardTypes {
+				if c.HasType(t) {
+					mask |= 1 << i
+				}
+			}
+			shared &= mask
+			nonland++
+		}
+	}
+	if comp.sharesType && nonland > 0 && shared == 0 {
+		issues = append(issues, DeckIssue{Have: nonland, Reason: "nonland cards share no card type, breaking " + deck.Companion + "'s restriction"})
+	}
+	return issues
+}
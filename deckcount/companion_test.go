@@ -0,0 +1,166 @@
+package deckcount
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+)
+
+// companionPool returns a few modern cards and the named companions.
+func companionPool(names ...string) map[string]Card {
+	legal := map[string]string{"modern": "Legal"}
+	pool := []Card{
+		{Name: "Island", Type: "Basic Land — Island", Text: "({T}: Add {U}.)"},
+		{Name: "Opt", Type: "Instant", ManaCost: "{U}", ConvertedManaCost: 1},
+		{Name: "Counterspell", Type: "Instant", ManaCost: "{U}{U}", ConvertedManaCost: 2},
+		{Name: "Fact or Fiction", Type: "Instant", ManaCost: "{3}{U}", ConvertedManaCost: 4},
+		{Name: "Ornithopter", Type: "Artifact Creature — Thopter", ManaCost: "{0}", Text: "Flying", Keywords: []string{"Flying"}},
+		{Name: "Wild Nacatl", Type: "Creature — Cat Warrior", ManaCost: "{G}", ConvertedManaCost: 1,
+			Text: "Wild Nacatl gets +1/+1 as long as you control a Mountain."},
+		{Name: "Aether Vial", Type: "Artifact", ManaCost: "{1}", ConvertedManaCost: 1,
+			Text: "At the beginning of your upkeep, you may put a charge counter on Aether Vial.\n{T}: You may put a creature card with mana value equal to the number of charge counters on Aether Vial from your hand onto the battlefield."},
+		{Name: "Crib Swap", Type: "Kindred Instant — Shapeshifter", ManaCost: "{2}{W}", ConvertedManaCost: 3,
+			Keywords: []string{"Changeling"}},
+	}
+	companionCards := map[string]Card{
+		"Gyruda, Doom of Depths":   {Type: "Legendary Creature — Demon Kraken", ManaCost: "{4}{U/B}{U/B}", ConvertedManaCost: 6},
+		"Jegantha, the Wellspring": {Type: "Legendary Creature — Elemental Elk", ManaCost: "{4}{R/G}", ConvertedManaCost: 5},
+		"Kaheera, the Orphanguard": {Type: "Legendary Creature — Cat Beast", ManaCost: "{1}{G/W}{G/W}", ConvertedManaCost: 3},
+		"Keruga, the Macrosage":    {Type: "Legendary Creature — Dinosaur Hippo", ManaCost: "{3}{G/U}{G/U}", ConvertedManaCost: 5},
+		"Lurrus of the Dream-Den":  {Type: "Legendary Creature — Cat Nightmare", ManaCost: "{1}{W/B}{W/B}", ConvertedManaCost: 3},
+		"Lutri, the Spellchaser":   {Type: "Legendary Creature — Otter", ManaCost: "{1}{U/R}{U/R}", ConvertedManaCost: 3},
+		"Obosh, the Preypiercer":   {Type: "Legendary Creature — Hellion Horror", ManaCost: "{3}{B/R}{B/R}", ConvertedManaCost: 5},
+		"Umori, the Collector":     {Type: "Legendary Creature — Ooze", ManaCost: "{2}{B/G}{B/G}", ConvertedManaCost: 4},
+		"Yorion, Sky Nomad":        {Type: "Legendary Creature — Bird Serpent", ManaCost: "{3}{W/U}{W/U}", ConvertedManaCost: 5},
+		"Zirda, the Dawnwaker": {Type: "Legendary Creature — Elemental Fox", ManaCost: "{1}{R/W}{R/W}", ConvertedManaCost: 3,
+			Text: "{2}, {T}: Target creature can't block this turn."},
+	}
+	for _, name := range names {
+		c := companionCards[name]
+		c.Name = name
+		pool = append(pool, c)
+	}
+	cards := map[string]Card{}
+	for _, c := range pool {
+		c.Legalities = legal
+		cards[c.Name] = c
+	}
+	return cards
+}
+
+func TestCountCompanionDecks(t *testing.T) {
+	// The cards each companion allows in the main deck, besides Island.
+	allowed := map[string][]string{
+		"Gyruda, Doom of Depths":   {"Counterspell", "Fact or Fiction", "Ornithopter", "Gyruda, Doom of Depths"},
+		"Jegantha, the Wellspring": {"Opt", "Fact or Fiction", "Ornithopter", "Wild Nacatl", "Aether Vial", "Crib Swap", "Jegantha, the Wellspring"},
+		"Kaheera, the Orphanguard": {"Opt", "Counterspell", "Fact or Fiction", "Wild Nacatl", "Aether Vial", "Crib Swap", "Kaheera, the Orphanguard"},
+		"Keruga, the Macrosage":    {"Fact or Fiction", "Crib Swap", "Keruga, the Macrosage"},
+		"Lurrus of the Dream-Den":  {"Opt", "Counterspell", "Fact or Fiction", "Ornithopter", "Wild Nacatl", "Aether Vial", "Crib Swap"},
+		"Obosh, the Preypiercer":   {"Opt", "Wild Nacatl", "Aether Vial", "Crib Swap", "Obosh, the Preypiercer"},
+		"Zirda, the Dawnwaker":     {"Opt", "Counterspell", "Fact or Fiction", "Aether Vial", "Crib Swap", "Zirda, the Dawnwaker"},
+	}
+	// Umori's nonland cards' types, as bits: artifact, creature, instant,
+	// kindred.
+	types := map[string]int{
+		"Opt": 4, "Counterspell": 4, "Fact or Fiction": 4, "Ornithopter": 1 | 2,
+		"Wild Nacatl": 2, "Aether Vial": 1, "Crib Swap": 4 | 8, "Umori, the Collector": 2,
+	}
+	for _, comp := range Companions() {
+		if comp == "Yorion, Sky Nomad" {
+			continue
+		}
+		cards := companionPool(comp)
+		names := []string{}
+		for name := range cards {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ok := map[string]bool{"Island": true}
+		for _, name := range allowed[comp] {
+			ok[name] = true
+		}
+		for numMain := 0; numMain <= 3; numMain++ {
+			for numSide := 1; numSide <= 2; numSide++ {
+				limit := make([]int, len(names))
+				for i, name := range names {
+					limit[i] = cards[name].Limit("modern")
+					if limit[i] > numMain+numSide {
+						limit[i] = numMain + numSide
+					}
+				}
+				want := int64(0)
+				EnumerateDecks(numMain, numSide, limit, func(main, side []int) {
+					shared := -1
+					for i, name := range names {
+						if main[i] == 0 {
+							continue
+						}
+						switch comp {
+						case "Lutri, the Spellchaser":
+							if name != "Island" && main[i] > 1 {
+								return
+							}
+						case "Umori, the Collector":
+							if name != "Island" {
+								shared &= types[name]
+							}
+						default:
+							if !ok[name] {
+								return
+							}
+						}
+					}
+					for i, name := range names {
+						if name == comp && side[i] == 0 {
+							return
+						}
+					}
+					if shared != 0 {
+						want++
+					}
+				})
+				got, err := CountCompanionDecks(numMain, numSide, cards, "modern", comp)
+				if err != nil || got.Cmp(big.NewInt(want)) != 0 {
+					t.Errorf("CountCompanionDecks(%d, %d, %s)=%v, %v; want %d", numMain, numSide, comp, got, err, want)
+				}
+			}
+		}
+	}
+
+	// Yorion's decks are 20 cards bigger, and otherwise unrestricted.
+	cards := companionPool("Yorion, Sky Nomad")
+	limit := []int{}
+	for _, c := range cards {
+		if lim := c.Limit("modern"); c.Name == "Yorion, Sky Nomad" {
+			limit = append(limit, lim-1)
+		} else {
+			limit = append(limit, lim)
+		}
+	}
+	if got, err := CountCompanionDecks(40, 15, cards, "modern", "yorion"); err != nil || got.Cmp(CountDecks(60, 14, limit)) != 0 {
+		t.Errorf("CountCompanionDecks(40, 15, Yorion)=%v, %v; want %v", got, err, CountDecks(60, 14, limit))
+	}
+
+	if _, err := CountCompanionDecks(60, 15, cards, "modern", "Tarmogoyf"); !errors.Is(err, ErrNotCompanion) {
+		t.Errorf("CountCompanionDecks(Tarmogoyf) err=%v; want ErrNotCompanion", err)
+	}
+	if _, err := CountCompanionDecks(60, 15, cards, "modern", "Lurrus"); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("CountCompanionDecks(Lurrus) without Lurrus err=%v; want ErrBadDecklist", err)
+	}
+	if _, err := CountCompanionDecks(60, 0, cards, "modern", "Yorion"); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("CountCompanionDecks(60, 0, Yorion) err=%v; want ErrDeckSize", err)
+	}
+}
+
+func TestCompanionRestriction(t *testing.T) {
+	for _, name := range []string{"lurrus", "Lurrus of the Dream-Den", "LURRUS OF THE DREAM-DEN"} {
+		full, restriction, err := CompanionRestriction(name)
+		if err != nil || full != "Lurrus of the Dream-Den" || restriction != "Each permanent card in your starting deck has mana value 2 or less." {
+			t.Errorf("CompanionRestriction(%q)=%q, %q, %v; want Lurrus's", name, full, restriction, err)
+		}
+	}
+	if got := len(Companions()); got != 10 {
+		t.Errorf("len(Companions())=%d; want 10", got)
+	}
+}
@@ -0,0 +1,4082 @@
+// Package deckcount counts Magic: The Gathering decks.  It reads card data
+// from mtgjson (https://mtgjson.com), works out how many copies of each card
+// a format allows, and counts the distinct decks those limits permit, as exact
+// big integers.
+//
+// Most programs need only Count:
+//
+//	cards, err := deckcount.ParseCards(mtgJSON)
+//	...
+//	n, err := deckcount.Count(cards, deckcount.DeckSpec{Format: "modern", Main: 60, Side: 15})
+//
+// The CountDecks family works on limit vectors directly, for custom pools and
+// variants.
+package deckcount
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Card struct {
+	Name       string
+	Type       string
+	Legalities map[string]string
+
+	// Optional fields, used by the predicate-based counters.  Cards in data
+	// files that omit them still count exactly as before.
+	Text       string
+	Keywords   []string
+	Supertypes []string
+	Types      []string // E.g. ["Artifact", "Land"].
+	Printings  []string // Codes of the sets the card was printed in.
+
+	ColorIdentity     []string        // E.g. ["R", "W"]; empty for colorless cards.
+	LeadershipSkills  map[string]bool // Formats in which the card can be a commander.
+	ConvertedManaCost float64         // Mana value; 0 for lands.  Un-cards have halves.
+	Rarity            string          // Lowest rarity printed, e.g. "common".
+	ManaCost          string          // E.g. "{1}{U}{U}".
+}
+
+// colors are the letters of Magic's five colors, in the usual order.
+const colors = "WUBRG"
+
+// Pips returns the number of colored mana symbols of each color in c's mana
+// cost, counting Phyrexian symbols like {U/P} but not hybrid ones like {W/U}.
+func (c Card) Pips() map[string]int {
+	pips := map[string]int{}
+	for _, sym := range strings.Split(c.ManaCost, "}") {
+		sym = strings.TrimSuffix(strings.TrimPrefix(sym, "{"), "/P")
+		if len(sym) == 1 && strings.Contains(colors, sym) {
+			pips[sym]++
+		}
+	}
+	return pips
+}
+
+// UnmarshalJSON decodes c as usual, then renames c's formats to their
+// canonical names, so "Standard" and "standard" in the data are one format.
+func (c *Card) UnmarshalJSON(data []byte) error {
+	type plain Card // Without the UnmarshalJSON method.
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	c.Legalities = canonicalLegalities(c.Legalities)
+	var v5 struct {
+		ManaValue *float64 // Newer mtgjson's name for convertedManaCost.
+	}
+	if err := json.Unmarshal(data, &v5); err == nil && v5.ManaValue != nil && c.ConvertedManaCost == 0 {
+		c.ConvertedManaCost = *v5.ManaValue
+	}
+	return nil
+}
+
+// CanonicalFormat returns the name this package uses for the format called
+// name in data files or by callers: lowercase, without spaces, hyphens, or
+// underscores, then renamed by formatAliases.  So "Standard" and
+// "STANDARD" become "standard", "Historic Brawl" becomes "historicbrawl", as
+// mtgjson names it, and "EDH" becomes "commander".
+func CanonicalFormat(name string) string {
+	name = foldFormat(name)
+	if alias, ok := formatAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// foldFormat returns name in lowercase, without spaces, hyphens, or
+// underscores.
+func foldFormat(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// formatAliases maps old or informal names of formats to the names in current
+// mtgjson data.  AddFormatAlias adds to it.
+var formatAliases = map[string]string{
+	"edh":           "commander",
+	"duelcommander": "duel",
+	"type1":         "vintage",
+	"type1.5":       "legacy",
+}
+
+// AddFormatAlias makes CanonicalFormat, and so every lookup of a format, treat
+// the format old as the format new.  It isn't safe to call while counting.
+func AddFormatAlias(old, new string) {
+	formatAliases[foldFormat(old)] = CanonicalFormat(new)
+}
+
+// canonicalLegalities returns legalities keyed by canonical format name.  If
+// two spellings of a format disagree, the stricter status wins.
+func canonicalLegalities(legalities map[string]string) map[string]string {
+	if legalities == nil {
+		return nil
+	}
+	canon := make(map[string]string, len(legalities))
+	for f, status := range legalities {
+		f = CanonicalFormat(f)
+		if old, ok := canon[f]; ok && DefaultStatusLimits[old] <= DefaultStatusLimits[status] {
+			continue
+		}
+		canon[f] = status
+	}
+	return canon
+}
+
+// CMC returns c's mana value, rounded down.
+func (c Card) CMC() int {
+	return int(c.ConvertedManaCost)
+}
+
+// IsLegendary reports whether c has the Legendary supertype.  Older data
+// without a supertypes list falls back to the type line.
+func (c Card) IsLegendary() bool {
+	if len(c.Supertypes) == 0 {
+		return strings.HasPrefix(c.Type, "Legendary") || strings.Contains(c.Type, " Legendary ")
+	}
+	for _, s := range c.Supertypes {
+		if s == "Legendary" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasKeyword reports whether c has the keyword kw (e.g. "Partner"), ignoring case.
+func (c Card) HasKeyword(kw string) bool {
+	for _, k := range c.Keywords {
+		if strings.EqualFold(k, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnumerateDecks calls fn with the number of copies of each card in the main
+// deck and sideboard of every deck counted by CountDecks(numMain, numSide,
+// limit), main decks with more copies of earlier cards first.  fn must not
+// retain its arguments.
+func EnumerateDecks(numMain, numSide int, limit []int, fn func(main, side []int)) {
+	main := make([]int, len(limit))
+	side := make([]int, len(limit))
+	var fill func(zone []int, i, left int, done func())
+	fill = func(zone []int, i, left int, done func()) {
+		if left == 0 {
+			done()
+			return
+		}
+		if i == len(limit) {
+			return
+		}
+		avail := limit[i] - main[i] - side[i]
+		if avail > left {
+			avail = left
+		}
+		for k := avail; k >= 0; k-- {
+			zone[i] = k
+			fill(zone, i+1, left-k, done)
+		}
+		zone[i] = 0
+	}
+	fill(main, 0, numMain, func() {
+		fill(side, 0, numSide, func() { fn(main, side) })
+	})
+}
+
+// Errors returned by the loaders and counters, for use with errors.Is.
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrEmptyPool     = errors.New("no legal cards")
+	ErrBadDecklist   = errors.New("bad decklist")
+	ErrSchema        = errors.New("unexpected card data schema")
+	ErrNotRestricted = errors.New("not restricted")
+	ErrDeckSize      = errors.New("bad deck size")
+	ErrBadOverride   = errors.New("bad override")
+	ErrNoDecks       = errors.New("no decks")
+	ErrNotCounted    = errors.New("deck not counted")
+	ErrRank          = errors.New("deck number out of range")
+	ErrBadIdentity   = errors.New("bad color identity")
+	ErrBadTypeRange  = errors.New("bad type range")
+	ErrUnknownSet    = errors.New("unknown set")
+	ErrBadCollation  = errors.New("bad collation")
+	ErrNotInPacks    = errors.New("not in the set's boosters")
+	ErrNotCompanion  = errors.New("not a companion")
+	ErrBadQuery      = errors.New("bad hand query")
+	ErrBadCurveRange = errors.New("bad curve range")
+	ErrBadLimits     = errors.New("mismatched limits")
+)
+
+// schemaError is a description of a problem with the shape of a card data
+// file.  It matches ErrSchema.
+type schemaError string
+
+func (e schemaError) Error() string        { return string(e) }
+func (e schemaError) Is(target error) bool { return target == ErrSchema }
+
+// ParseCards decodes an AllCards.json file into a map from card name to Card.
+func ParseCards(mtgJSON []byte) (map[string]Card, error) {
+	data, err := ParseCardData(mtgJSON)
+	return data.Cards, err
+}
+
+// Meta describes the version of a card data file.
+type Meta struct {
+	Version string
+	Date    string
+}
+
+// CardData is the contents of a card data file.  Meta is empty for older
+// files that don't have it.
+type CardData struct {
+	Meta  Meta
+	Cards map[string]Card
+}
+
+// ParseCardData decodes a card data file, which is either a flat JSON object
+// from card name to card, or (in newer mtgjson files) an object with such a
+// map under "data" and the file's version under "meta".  In v5 files
+// (AtomicCards.json) each name maps to an array of the card's faces; those are
+// detected by shape and the first face is used.
+func ParseCardData(mtgJSON []byte) (CardData, error) {
+	tok, err := json.NewDecoder(bytes.NewReader(mtgJSON)).Token()
+	if err != nil {
+		return CardData{}, err
+	}
+	if tok == json.Delim('[') {
+		return CardData{}, schemaError("expected a JSON object of cards; got an array — did you pass AllPrintings instead of AllCards?")
+	}
+	if tok != json.Delim('{') {
+		return CardData{}, schemaError(fmt.Sprintf("expected a JSON object of cards; got %v", tok))
+	}
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(mtgJSON, &top); err != nil {
+		return CardData{}, err
+	}
+	var d CardData
+	if isWrapped(top) {
+		if meta, ok := top["meta"]; ok {
+			if err := json.Unmarshal(meta, &d.Meta); err != nil {
+				return CardData{}, schemaError(fmt.Sprintf("meta: %v", err))
+			}
+		}
+		var cards map[string]json.RawMessage
+		if err := json.Unmarshal(top["data"], &cards); err != nil {
+			return CardData{}, schemaError(fmt.Sprintf("data: %v", err))
+		}
+		top = cards
+	}
+	d.Cards = map[string]Card{}
+	for name, raw := range top {
+		c, err := decodeCardJSON(name, raw)
+		if err != nil {
+			return CardData{}, err
+		}
+		d.Cards[name] = c
+	}
+	return d, nil
+}
+
+// isWrapped reports whether top is a {"meta":..., "data":...} wrapper rather
+// than a map of cards.
+func isWrapped(top map[string]json.RawMessage) bool {
+	if _, ok := top["data"]; !ok {
+		return false
+	}
+	for k := range top {
+		if k != "meta" && k != "data" {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkCards decodes a card data file (flat or wrapped, as for ParseCardData)
+// from r one card at a time, calling fn on each, so the whole file is never
+// in memory at once.  It stops at the first error from fn and returns it.
+func WalkCards(r io.Reader, fn func(Card) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == json.Delim('[') {
+		return schemaError("expected a JSON object of cards; got an array — did you pass AllPrintings instead of AllCards?")
+	}
+	if tok != json.Delim('{') {
+		return schemaError(fmt.Sprintf("expected a JSON object of cards; got %v", tok))
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		switch key {
+		case "meta":
+			var meta json.RawMessage
+			if err := dec.Decode(&meta); err != nil {
+				return err
+			}
+		case "data":
+			if tok, err := dec.Token(); err != nil {
+				return err
+			} else if tok != json.Delim('{') {
+				return schemaError(fmt.Sprintf("data: expected a JSON object of cards; got %v", tok))
+			}
+			for dec.More() {
+				if err := walkCard(dec, fn); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+		default:
+			if err := decodeCard(dec, key, fn); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// walkCard decodes the next name and card from dec and calls fn on the card.
+func walkCard(dec *json.Decoder, fn func(Card) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	return decodeCard(dec, tok.(string), fn)
+}
+
+func decodeCard(dec *json.Decoder, name string, fn func(Card) error) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	c, err := decodeCardJSON(name, raw)
+	if err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+// decodeCardJSON decodes the card called name from raw, which is either a
+// card object (mtgjson v4) or an array of the card's faces (v5's
+// AtomicCards.json), in which case the first face stands for the card.
+func decodeCardJSON(name string, raw json.RawMessage) (Card, error) {
+	var c Card
+	var err error
+	if t := bytes.TrimSpace(raw); len(t) > 0 && t[0] == '[' {
+		var faces []Card
+		if err = json.Unmarshal(raw, &faces); err == nil && len(faces) == 0 {
+			return Card{}, schemaError(fmt.Sprintf("%s: no faces", name))
+		}
+		if err == nil {
+			c = faces[0]
+		}
+	} else {
+		err = json.Unmarshal(raw, &c)
+	}
+	if err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return Card{}, schemaError(fmt.Sprintf("%s: %v", name, err))
+		}
+		return Card{}, err
+	}
+	return c, nil
+}
+
+func FormatLimits(mtgJSON []byte) (map[string][]int, error) {
+	limits := map[string][]int{}
+	err := WalkCards(bytes.NewReader(mtgJSON), func(c Card) error {
+		addLimits(limits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// LimitsByFormat returns the limit vector of every format the cards mention,
+// as FormatLimits does for a data file.
+func LimitsByFormat(cards map[string]Card) map[string][]int {
+	limits := map[string][]int{}
+	for _, c := range cards {
+		addLimits(limits, c)
+	}
+	return limits
+}
+
+// addLimits appends c's limit to the vector of each format in which it's
+// legal, and makes sure every format c mentions has a vector.
+func addLimits(limits map[string][]int, c Card) {
+	for f := range c.Legalities {
+		if _, ok := limits[f]; !ok {
+			limits[f] = []int{}
+		}
+		if lim := c.Limit(f); lim > 0 {
+			limits[f] = append(limits[f], lim)
+		}
+	}
+}
+
+// DataReport summarizes a card data file, for spotting schema drift before
+// trusting the counts.
+type DataReport struct {
+	Cards    int
+	Statuses map[string]int // Number of (card, format) pairs with each legality status.
+	Unnamed  []string       // Keys of cards with an empty name.
+	Unknown  []string       // "card: format=status" for each unrecognized status.
+}
+
+// knownStatuses are the legality statuses Limit understands.  Any other
+// status is treated like Banned.
+var knownStatuses = map[string]bool{"Legal": true, "Restricted": true, "Banned": true}
+
+func ValidateData(cards map[string]Card) DataReport {
+	r := DataReport{Cards: len(cards), Statuses: map[string]int{}}
+	for key, c := range cards {
+		if c.Name == "" {
+			r.Unnamed = append(r.Unnamed, key)
+		}
+		for f, leg := range c.Legalities {
+			r.Statuses[leg]++
+			if !knownStatuses[leg] {
+				r.Unknown = append(r.Unknown, fmt.Sprintf("%s: %s=%s", key, f, leg))
+			}
+		}
+	}
+	sort.Strings(r.Unnamed)
+	sort.Strings(r.Unknown)
+	return r
+}
+
+func (r DataReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%d cards\n", r.Cards)
+	statuses := []string{}
+	for leg := range r.Statuses {
+		statuses = append(statuses, leg)
+	}
+	sort.Strings(statuses)
+	for _, leg := range statuses {
+		fmt.Fprintf(w, "%12s: %d\n", leg, r.Statuses[leg])
+	}
+	for _, key := range r.Unnamed {
+		fmt.Fprintf(w, "warning: card %q has no name\n", key)
+	}
+	for _, u := range r.Unknown {
+		fmt.Fprintf(w, "warning: unknown legality status (counted as banned) for %s\n", u)
+	}
+}
+
+// digitalFormats are the formats played only on MTG Arena, and so the only
+// ones in which Alchemy's rebalanced "A-" cards are legal.
+var digitalFormats = map[string]bool{"historic": true, "alchemy": true, "brawl": true, "historicbrawl": true}
+
+// IsRebalanced reports whether c is an Alchemy rebalanced version of a card,
+// such as "A-Luminarch Aspirant".
+func (c Card) IsRebalanced() bool {
+	return strings.HasPrefix(c.Name, "A-")
+}
+
+// DefaultStatusLimits maps each legality status to the number of copies of an
+// ordinary card it allows.  Statuses that aren't listed, such as Banned,
+// Suspended, and Future (cards from sets that aren't released yet), allow
+// none.
+var DefaultStatusLimits = map[string]int{"Legal": 4, "Restricted": 1}
+
+// withFuture returns a copy of statuses that treats Future like Legal.
+func withFuture(statuses map[string]int) map[string]int {
+	m := map[string]int{"Future": statuses["Legal"]}
+	for leg, lim := range statuses {
+		m[leg] = lim
+	}
+	return m
+}
+
+// Limit returns the maximum number of copies of c a deck in format may
+// contain, or 0 if c isn't legal there, under the options set by SetDefaults.
+func (c Card) Limit(format string) int {
+	return defaults.limit(c, format)
+}
+
+func (o *options) limit(c Card, format string) int {
+	format = CanonicalFormat(format)
+	if c.IsRebalanced() && !digitalFormats[format] {
+		return 0
+	}
+	lim := o.statuses[c.Legalities[format]]
+	if lim > 1 && c.IsBasicLand() && o.basicCap > 0 {
+		return o.basicCap
+	}
+	if lim > 1 && c.IsBasicLand() {
+		return 1000
+	}
+	if n := c.CopiesAllowed(); lim > 1 && n > 0 {
+		return n
+	}
+	return lim
+}
+
+// CopiesAllowed returns the number of copies c's own text lets a deck have,
+// instead of the usual four: 1000 (unlimited) for "A deck can have any number
+// of cards named Relentless Rats", 7 for Seven Dwarves' "up to seven".  It
+// returns 0 for cards without such text.  Cards in data without text are
+// looked up in copiesByName instead.
+func (c Card) CopiesAllowed() int {
+	if c.Text == "" {
+		return copiesByName[c.Name]
+	}
+	text := strings.ToLower(c.Text)
+	const prefix = "a deck can have "
+	i := strings.Index(text, prefix)
+	if i < 0 {
+		return 0
+	}
+	rest := text[i+len(prefix):]
+	if strings.HasPrefix(rest, "any number of cards named") {
+		return 1000
+	}
+	var word string
+	if _, err := fmt.Sscanf(rest, "up to %s cards named", &word); err != nil {
+		return 0
+	}
+	return numberWords[word]
+}
+
+// copiesByName are the cards known to allow more than four copies, for data
+// files without card text.
+var copiesByName = map[string]int{
+	"Relentless Rats":        1000,
+	"Shadowborn Apostle":     1000,
+	"Persistent Petitioners": 1000,
+	"Rat Colony":             1000,
+	"Dragon's Approach":      1000,
+	"Slime Against Humanity": 1000,
+	"Seven Dwarves":          7,
+	"Nazgûl":                 9,
+}
+
+// numberWords are the numbers card text spells out in "up to N cards named".
+var numberWords = map[string]int{
+	"two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// IsLand reports whether c has the Land type.
+func (c Card) IsLand() bool {
+	return c.HasType("Land")
+}
+
+// HasType reports whether c has the card type typ, such as "Creature", in
+// any case.  Older data without a types list falls back to the words before
+// the dash in the type line.
+func (c Card) HasType(typ string) bool {
+	types := c.Types
+	if len(types) == 0 {
+		words := c.Type
+		if i := strings.Index(words, "—"); i >= 0 {
+			words = words[:i]
+		}
+		types = strings.Fields(words)
+	}
+	for _, t := range types {
+		if strings.EqualFold(t, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBasicLand reports whether c is a land with the Basic supertype, such as
+// Island, Wastes, or Snow-Covered Island.  Older data without a supertypes
+// list falls back to the words before the dash in the type line.
+func (c Card) IsBasicLand() bool {
+	if !c.IsLand() {
+		return false
+	}
+	supertypes := c.Supertypes
+	if len(supertypes) == 0 {
+		words := c.Type
+		if i := strings.Index(words, "—"); i >= 0 {
+			words = words[:i]
+		}
+		supertypes = strings.Fields(words)
+	}
+	for _, s := range supertypes {
+		if s == "Basic" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSubtype reports whether subtype (e.g. "Elf") appears after the dash in
+// c's type line.
+func (c Card) HasSubtype(subtype string) bool {
+	i := strings.Index(c.Type, "—")
+	if i < 0 {
+		return false
+	}
+	for _, s := range strings.Fields(c.Type[i+len("—"):]) {
+		if s == subtype {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentityKey returns c's color identity as a sorted string such as "RW",
+// so that cards with equal identities have equal keys.
+func (c Card) IdentityKey() string {
+	colors := append([]string{}, c.ColorIdentity...)
+	sort.Strings(colors)
+	return strings.Join(colors, "")
+}
+
+// CanLead reports whether c can be the commander of a deck in format.  Data
+// without leadershipSkills falls back to legendary creatures and cards that
+// say they can be your commander.
+func (c Card) CanLead(format string) bool {
+	if c.LeadershipSkills != nil {
+		return c.LeadershipSkills[format]
+	}
+	return (c.IsLegendary() && strings.Contains(c.Type, "Creature")) ||
+		strings.Contains(c.Text, "can be your commander")
+}
+
+// HasPartner reports whether c has plain Partner (not "Partner with" a
+// particular card), so it can share the command zone with any other such
+// commander.
+func (c Card) HasPartner() bool {
+	return c.HasKeyword("Partner") && !strings.Contains(c.Text, "Partner with")
+}
+
+// ChoosesBackground reports whether c can share the command zone with a
+// Background.
+func (c Card) ChoosesBackground() bool {
+	return c.HasKeyword("Choose a Background") || strings.Contains(c.Text, "Choose a Background")
+}
+
+// PartnersWith returns the name of the card that c has "Partner with", as in
+// "Partner with Pir, Imaginative Rascal (When this creature enters ...", or
+// "" if it has none.
+func (c Card) PartnersWith() string {
+	i := strings.Index(c.Text, "Partner with ")
+	if i < 0 {
+		return ""
+	}
+	name := c.Text[i+len("Partner with "):]
+	if j := strings.IndexAny(name, "(\n"); j >= 0 {
+		name = name[:j]
+	}
+	return strings.TrimSpace(name)
+}
+
+// HasFriendsForever reports whether c has Friends forever, so it can share
+// the command zone with any other such commander.
+func (c Card) HasFriendsForever() bool {
+	return c.HasKeyword("Friends forever") || strings.Contains(c.Text, "Friends forever")
+}
+
+// canShareCommandZone reports whether a and b can be a deck's two
+// commanders in format: both have Partner, both have Friends forever, either
+// has Partner with the other, or one chooses a Background and the other is
+// one.
+func canShareCommandZone(a, b Card, format string) bool {
+	if a.Name == b.Name {
+		return false
+	}
+	background := func(chooser, bg Card) bool {
+		return chooser.CanLead(format) && chooser.ChoosesBackground() && bg.HasSubtype("Background")
+	}
+	if background(a, b) || background(b, a) {
+		return true
+	}
+	if !a.CanLead(format) || !b.CanLead(format) {
+		return false
+	}
+	return a.HasPartner() && b.HasPartner() ||
+		a.HasFriendsForever() && b.HasFriendsForever() ||
+		a.PartnersWith() == b.Name || b.PartnersWith() == a.Name
+}
+
+// withinIdentity reports whether every color of c's identity is in identity.
+func (c Card) withinIdentity(identity string) bool {
+	for _, color := range c.ColorIdentity {
+		if !strings.Contains(identity, color) {
+			return false
+		}
+	}
+	return true
+}
+
+// PrintedIn reports whether c was printed in the set with code setCode.
+func (c Card) PrintedIn(setCode string) bool {
+	for _, p := range c.Printings {
+		if p == setCode {
+			return true
+		}
+	}
+	return false
+}
+
+// NamedLimit is a card's name and its limit in some format.
+type NamedLimit struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+// NamedLimits returns the limit of each card legal in format, in order of
+// name.  Unlike the plain limit vectors, it keeps track of which card is
+// which.
+func NamedLimits(cards map[string]Card, format string) []NamedLimit {
+	named := []NamedLimit{}
+	for name, c := range cards {
+		if lim := c.Limit(format); lim > 0 {
+			named = append(named, NamedLimit{name, lim})
+		}
+	}
+	sort.Slice(named, func(a, b int) bool { return named[a].Name < named[b].Name })
+	return named
+}
+
+// LimitHistogram returns the number of cards with each limit.
+func LimitHistogram(named []NamedLimit) map[int]int {
+	hist := map[int]int{}
+	for _, nl := range named {
+		hist[nl.Limit]++
+	}
+	return hist
+}
+
+// LimitsVersion is the version of the limits file format written by
+// WriteLimitsJSON.  The format is independent of mtgjson, so other programs
+// can write limits for this one to count:
+//
+//	{
+//	  "version": 1,
+//	  "formats": {
+//	    "modern": [{"name": "Island", "limit": 1000}, {"name": "Opt", "limit": 4}]
+//	  }
+//	}
+//
+// Names must be unique within a format, and limits nonnegative.
+const LimitsVersion = 1
+
+// limitsFile is the JSON form of a limits file.
+type limitsFile struct {
+	Version int                     `json:"version"`
+	Formats map[string][]NamedLimit `json:"formats"`
+}
+
+// WriteLimitsJSON writes the limits of each format as a limits file.
+func WriteLimitsJSON(w io.Writer, formats map[string][]NamedLimit) error {
+	data, err := json.MarshalIndent(limitsFile{LimitsVersion, formats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// ReadLimitsJSON reads and checks a limits file.  Errors about its contents
+// match ErrSchema.
+func ReadLimitsJSON(r io.Reader) (map[string][]NamedLimit, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var f limitsFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, schemaError(fmt.Sprintf("limits file: %v", err))
+	}
+	if f.Version != LimitsVersion {
+		return nil, schemaError(fmt.Sprintf("limits file version %d; want %d", f.Version, LimitsVersion))
+	}
+	if f.Formats == nil {
+		return nil, schemaError("limits file has no formats")
+	}
+	for format, named := range f.Formats {
+		seen := map[string]bool{}
+		for _, nl := range named {
+			switch {
+			case nl.Name == "":
+				return nil, schemaError(fmt.Sprintf("%s: a card has no name", format))
+			case seen[nl.Name]:
+				return nil, schemaError(fmt.Sprintf("%s: %s is listed twice", format, nl.Name))
+			case nl.Limit < 0:
+				return nil, schemaError(fmt.Sprintf("%s: %s has limit %d", format, nl.Name, nl.Limit))
+			}
+			seen[nl.Name] = true
+		}
+	}
+	return f.Formats, nil
+}
+
+// ValidateLimitsJSON checks that r holds a valid limits file.
+func ValidateLimitsJSON(r io.Reader) error {
+	_, err := ReadLimitsJSON(r)
+	return err
+}
+
+// LegalLimits returns the limit vector for format.  It returns
+// ErrUnknownFormat if no card mentions format, and ErrEmptyPool if none is
+// legal there.
+func LegalLimits(cards map[string]Card, format string) ([]int, error) {
+	if !knownFormat(cards, format) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	limit := poolLimits(cards, format, func(Card) bool { return true })
+	if len(limit) == 0 {
+		return nil, fmt.Errorf("%s: %w", format, ErrEmptyPool)
+	}
+	return limit, nil
+}
+
+// knownFormat reports whether any card has a legality status in format.
+func knownFormat(cards map[string]Card, format string) bool {
+	format = CanonicalFormat(format)
+	for _, c := range cards {
+		if _, ok := c.Legalities[format]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// poolLimits returns the limit vector for format, restricted to the cards for
+// which include returns true.
+func poolLimits(cards map[string]Card, format string, include func(Card) bool) []int {
+	limits := []int{}
+	for _, c := range cards {
+		if !include(c) {
+			continue
+		}
+		if lim := c.Limit(format); lim > 0 {
+			limits = append(limits, lim)
+		}
+	}
+	return limits
+}
+
+// CountTribalDecks counts the decks in format built only from basic lands and
+// cards with the given creature type.  Changelings have every creature type,
+// so they're always included.
+func CountTribalDecks(numMain, numSide int, cards map[string]Card, format, subtype string) *big.Int {
+	return CountDecksWhere(numMain, numSide, cards, format, func(c Card) bool {
+		return c.IsBasicLand() || c.HasSubtype(subtype) || c.HasKeyword("Changeling") ||
+			strings.HasPrefix(c.Text, "Changeling")
+	})
+}
+
+// PowerNine are the nine most powerful cards from Magic's first sets, all
+// restricted in Vintage.
+var PowerNine = []string{
+	"Black Lotus", "Ancestral Recall", "Time Walk",
+	"Mox Pearl", "Mox Sapphire", "Mox Jet", "Mox Ruby", "Mox Emerald",
+	"Timetwister",
+}
+
+// CountVintageWithoutPower counts the Vintage decks with none of the
+// PowerNine.  It's a novelty for "what if they were banned?", not a format
+// anyone plays.
+func CountVintageWithoutPower(numMain, numSide int, cards map[string]Card) *big.Int {
+	power := map[string]bool{}
+	for _, name := range PowerNine {
+		power[name] = true
+	}
+	return CountDecksWhere(numMain, numSide, cards, "vintage", func(c Card) bool { return !power[c.Name] })
+}
+
+// CountDecksWhere counts the decks in format built only from the cards for
+// which include returns true.  It only handles constraints on individual
+// cards; constraints across the deck, such as "at least 20 lands", need one
+// of the specialized counters like CountDecksBySplit.
+func CountDecksWhere(numMain, numSide int, cards map[string]Card, format string, include func(Card) bool) *big.Int {
+	return CountDecks(numMain, numSide, poolLimits(cards, format, include))
+}
+
+// DeckSpec describes the decks Count counts: Main main-deck cards and Side
+// sideboard cards, all legal in Format.
+type DeckSpec struct {
+	Format string
+	Main   int
+	Side   int
+}
+
+// An Option changes how Count, CountLimits, or (through SetDefaults) every
+// counter works.
+type Option func(*options)
+
+type options struct {
+	ctx      context.Context
+	progress func(done, total int)
+	statuses map[string]int // Copies allowed by each legality status.
+	basicCap int
+	workers  int
+	memo     *Memo
+}
+
+// defaults are the options Card.Limit, and so every counter but Count and
+// CountLimits, uses.
+var defaults = options{ctx: context.Background(), progress: func(int, int) {}, statuses: DefaultStatusLimits, workers: 1}
+
+// SetDefaults applies opts to the options every counter uses, for programs,
+// like the command line tool, that count many ways under one configuration.
+// It isn't safe to call while counting.
+func SetDefaults(opts ...Option) {
+	for _, opt := range opts {
+		opt(&defaults)
+	}
+}
+
+// WithContext makes a count give up with ctx's error once ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) { o.ctx = ctx }
+}
+
+// WithProgress makes a count call progress(I, N) after it has accounted for
+// I of N cards.
+func WithProgress(progress func(done, total int)) Option {
+	return func(o *options) { o.progress = progress }
+}
+
+// WithFuture counts cards with Future legality, from sets that aren't
+// released yet, as Legal, for counting an upcoming Standard.
+func WithFuture() Option {
+	return func(o *options) { o.statuses = withFuture(o.statuses) }
+}
+
+// WithBasicCap, if n is positive, allows at most n copies of each basic land
+// instead of 1000.  Counts made with a cap are of "realistic" decks, not of
+// all legal decks.
+func WithBasicCap(n int) Option {
+	return func(o *options) { o.basicCap = n }
+}
+
+// WithParallelism lets CountDecks and the counters built on it use up to n
+// goroutines within one count.  The default is 1.
+func WithParallelism(n int) Option {
+	return func(o *options) { o.workers = n }
+}
+
+// WithMemo makes CountDecks, CountDecksProgress, and Count look each count
+// up in m before making it, and remember it there after.
+func WithMemo(m *Memo) Option {
+	return func(o *options) { o.memo = m }
+}
+
+// parallel calls fn(i) for each i in [0, n), on up to workers goroutines at
+// once, and returns when all the calls have.
+func parallel(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Count returns the number of decks in spec made from cards.  It returns
+// ErrUnknownFormat if no card mentions spec.Format, and ErrDeckSize if a
+// size is negative.
+func Count(cards map[string]Card, spec DeckSpec, opts ...Option) (*big.Int, error) {
+	o := defaults
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !knownFormat(cards, spec.Format) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, spec.Format)
+	}
+	var limit []int
+	for _, c := range cards {
+		if lim := o.limit(c, spec.Format); lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	return countLimits(limit, spec, o)
+}
+
+// CountLimits is Count for the cards described by limit, as for CountDecks.
+// spec.Format is ignored.
+func CountLimits(limit []int, spec DeckSpec, opts ...Option) (*big.Int, error) {
+	o := defaults
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return countLimits(limit, spec, o)
+}
+
+func countLimits(limit []int, spec DeckSpec, o options) (*big.Int, error) {
+	if spec.Main < 0 || spec.Side < 0 {
+		return nil, fmt.Errorf("%w: %d+%d", ErrDeckSize, spec.Main, spec.Side)
+	}
+	fp := Fingerprint(spec.Main, spec.Side, LimitClasses(spec.Main, spec.Side, limit))
+	if c, ok := o.memo.Get(fp); ok {
+		o.progress(len(limit), len(limit))
+		return c, nil
+	}
+	ways, err := deckTableContext(o.ctx, spec.Main, spec.Side, limit, o.progress)
+	if err != nil {
+		return nil, err
+	}
+	o.memo.Put(fp, ways[spec.Main][spec.Side])
+	return ways[spec.Main][spec.Side], nil
+}
+
+// MemoVersion is the version of the memo file format.
+const MemoVersion = 1
+
+// Memo remembers counts between runs, by the Fingerprint of what was
+// counted.  A count depends only on the deck sizes and how many cards have
+// each limit, so after a banlist change only the formats whose limits changed
+// are recounted, however the card data changed otherwise.  A nil *Memo
+// remembers nothing.  A Memo is safe for concurrent use.
+type Memo struct {
+	mu     sync.Mutex
+	counts map[string]string // Decimal counts, by Fingerprint.
+}
+
+// memoFile is the JSON form of a Memo.
+type memoFile struct {
+	Version int               `json:"version"`
+	Counts  map[string]string `json:"counts"`
+}
+
+// NewMemo returns an empty Memo.
+func NewMemo() *Memo {
+	return &Memo{counts: map[string]string{}}
+}
+
+// Fingerprint returns a key that two counts share exactly when they count the
+// same decks: the deck sizes and, from LimitClasses, the number of cards with
+// each limit.  For example, Fingerprint(60, 15, {1: 40, 4: 18000}) is
+// "60+15:1x40,4x18000".
+func Fingerprint(numMain, numSide int, classes map[int]int) string {
+	lims := []int{}
+	for lim, n := range classes {
+		if lim > 0 && n > 0 {
+			lims = append(lims, lim)
+		}
+	}
+	sort.Ints(lims)
+	parts := make([]string, len(lims))
+	for i, lim := range lims {
+		parts[i] = fmt.Sprintf("%dx%d", lim, classes[lim])
+	}
+	return fmt.Sprintf("%d+%d:%s", numMain, numSide, strings.Join(parts, ","))
+}
+
+func (m *Memo) Get(fingerprint string) (*big.Int, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.mu.Lock()
+	s, ok := m.counts[fingerprint]
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func (m *Memo) Put(fingerprint string, count *big.Int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.counts[fingerprint] = count.String()
+	m.mu.Unlock()
+}
+
+// Len returns the number of counts in m.
+func (m *Memo) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.counts)
+}
+
+// WriteMemo writes m as a memo file.
+func WriteMemo(w io.Writer, m *Memo) error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(memoFile{MemoVersion, m.counts}, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// ReadMemo reads a memo file.  A file of another MemoVersion, whose counts
+// may have been made differently, reads as an empty Memo rather than an
+// error, so they're recounted.  Errors about its contents match ErrSchema.
+func ReadMemo(r io.Reader) (*Memo, error) {
+	var f memoFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, schemaError(fmt.Sprintf("memo file: %v", err))
+	}
+	if f.Version != MemoVersion || f.Counts == nil {
+		return NewMemo(), nil
+	}
+	for fp, s := range f.Counts {
+		if _, ok := new(big.Int).SetString(s, 10); !ok {
+			return nil, schemaError(fmt.Sprintf("memo file: %s has count %q", fp, s))
+		}
+	}
+	return &Memo{counts: f.Counts}, nil
+}
+
+// key is a cache key of _countDecks: the main deck and sideboard sizes left,
+// and the number of cards left to place.
+type key struct {
+	main, side, numCards int
+}
+
+// CountDecks(M, S, L) returns the number of ways to make a deck with M
+// cards in the main deck and S cards in the sideboard where there are len(L)
+// cards to choose from, and there can be at most L[I] copies of card I in your
+// mainboard and sideboard combined (0 < I < len(L)).
+// Examples (mainboard/sideboard):
+//   CountDecks(3, 0, []int{1,2,3})=6 (abb abc acc bbc bcc ccd)
+//   CountDecks(3, 3, []int{1,2,3})=6 (abb/ccc abc/bcc acc/bbc bbc/acc bcc/abc ccc/abb)
+//   CountDecks(3, 1, []int{1,2,3})=12 (abb/c abc/b abc/c acc/b acc/c bbc/a bbc/c bcc/a bcc/b bcc/c ccc/a ccc/b)
+//   CountDecks(4, 0, []int{1,2,3})=5 (abbc abcc accc bbcc bccc)
+//   CountDecks(4, 1, []int{1,2,3})=8 (abbc/c abcc/b abcc/b accc/b bbcc/a bbcc/c bccc/a bccc/b)
+//   CountDecks(4, 2, []int{1,2,3})=5 (abbc/cc abcc/bc accc/bb bbcc/ac bccc/ab)
+//   CountDecks(60, 15, []int{75})=1 (the "all islands" example)
+//
+// The count is the coefficient of x^M y^S in the generating function that is
+// the product, over the cards, of the sum of x^a y^b for a+b <= L[I]: a copies
+// in the main deck and b in the sideboard.  Since nearly every card's limit
+// is 4, 1, or unlimited, CountDecks groups the cards by limit and raises each
+// group's factor to a power (see CountDecksByClass), rather than multiplying
+// in one card at a time as Count does (see gfStep).
+func CountDecks(numMain, numSide int, limit []int) *big.Int {
+	return CountDecksByClass(numMain, numSide, LimitClasses(numMain, numSide, limit))
+}
+
+// LimitClasses returns the number of cards with each limit in limit.  Limits
+// of numMain+numSide or more, which are all effectively unlimited, are merged
+// under numMain+numSide, and limits of 0 are left out.
+func LimitClasses(numMain, numSide int, limit []int) map[int]int {
+	classes := map[int]int{}
+	for _, lim := range limit {
+		if lim > numMain+numSide {
+			lim = numMain + numSide
+		}
+		if lim > 0 {
+			classes[lim]++
+		}
+	}
+	return classes
+}
+
+// CountDecksByClass is CountDecks for a pool given as the number of cards
+// with each limit, such as {1: 40, 4: 18000, 75: 11}.  Its work depends on the
+// number of distinct limits, not the number of cards: each class's factor
+// (sum[a+b <= L] x^a y^b)^N comes from a recurrence (see classPower), and the
+// few classes are multiplied together.  The classes' factors, and the rows of
+// each product, are computed in parallel up to WithParallelism's limit.
+func CountDecksByClass(numMain, numSide int, classes map[int]int) *big.Int {
+	if numMain < 0 || numSide < 0 {
+		return big.NewInt(0)
+	}
+	fp := Fingerprint(numMain, numSide, classes)
+	if c, ok := defaults.memo.Get(fp); ok {
+		return c
+	}
+	c := countDecksByClass(numMain, numSide, classes, nil)
+	defaults.memo.Put(fp, c)
+	return c
+}
+
+// countDecksByClass is CountDecksByClass without the memo.  If classDone
+// isn't nil, it's called with the number of cards in each class once the
+// class's factor is done, perhaps from several goroutines at once.
+func countDecksByClass(numMain, numSide int, classes map[int]int, classDone func(cards int)) *big.Int {
+	lims := []int{}
+	for lim, n := range classes {
+		if lim > 0 && n > 0 {
+			lims = append(lims, lim)
+		}
+	}
+	if len(lims) == 0 {
+		if numMain == 0 && numSide == 0 {
+			return big.NewInt(1)
+		}
+		return big.NewInt(0)
+	}
+	sort.Ints(lims)
+	powers := make([][][]*big.Int, len(lims))
+	parallel(len(lims), defaults.workers, func(i int) {
+		powers[i] = classPower(numMain, numSide, lims[i], classes[lims[i]])
+		if classDone != nil {
+			classDone(classes[lims[i]])
+		}
+	})
+	return productAt(powers, numMain, numSide)
+}
+
+// productAt returns the coefficient of x^numMain y^numSide in the product of
+// tables, of which there must be at least one.
+func productAt(tables [][][]*big.Int, numMain, numSide int) *big.Int {
+	workers := defaults.workers
+	acc := tables[0]
+	for i, p := range tables[1:] {
+		if i == len(tables)-2 {
+			return productCoefficient(acc, p, numMain, numSide, workers)
+		}
+		acc = mulTables(acc, p, workers)
+	}
+	return acc[numMain][numSide]
+}
+
+// CountDecksByDistinct returns, as element K, the number of the decks
+// counted by CountDecks(numMain, numSide, limit) that have exactly K
+// distinct cards, main deck and sideboard together.
+//
+// With z marking each card used, a card's factor is 1 + z(f-1), and a class
+// of n cards' is the sum over K of C(n, K) z^K (f-1)^K, where (f-1)^K is
+// splitTables' h_K.  Rather than multiply the classes' three-dimensional
+// tables, CountDecksByDistinct picks z = 2^B, with 2^B more than the number
+// of decks, so that the product's coefficient, written in base 2^B, has the
+// count for each K as its Kth digit.
+func CountDecksByDistinct(numMain, numSide int, limit []int) []*big.Int {
+	if numMain < 0 || numSide < 0 {
+		return nil
+	}
+	maxK := numMain + numSide
+	if maxK > len(limit) {
+		maxK = len(limit)
+	}
+	counts := make([]*big.Int, maxK+1)
+	for k := range counts {
+		counts[k] = new(big.Int)
+	}
+	classes := LimitClasses(numMain, numSide, limit)
+	total := CountDecksByClass(numMain, numSide, classes)
+	if len(classes) == 0 || total.Sign() == 0 {
+		counts[0].Set(total)
+		return counts
+	}
+	bits := uint(total.BitLen() + 1)
+	lims := []int{}
+	for lim := range classes {
+		lims = append(lims, lim)
+	}
+	sort.Ints(lims)
+	tables := make([][][]*big.Int, len(lims))
+	parallel(len(lims), defaults.workers, func(i int) {
+		n := classes[lims[i]]
+		h := splitTables(numMain, numSide, lims[i], n)
+		tables[i] = newTable(numMain+1, numSide+1)
+		c := new(big.Int)
+		for k := len(h) - 1; k >= 0; k-- {
+			c.Binomial(int64(n), int64(k))
+			for m, row := range tables[i] {
+				for s, t := range row {
+					t.Lsh(t, bits).Add(t, new(big.Int).Mul(c, h[k][m][s]))
+				}
+			}
+		}
+	})
+	packed := productAt(tables, numMain, numSide)
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	for k := range counts {
+		counts[k].And(packed, mask)
+		packed.Rsh(packed, bits)
+	}
+	return counts
+}
+
+// classPower returns the coefficients of g = f^n up to x^numMain y^numSide,
+// where f = sum[a+b <= lim] x^a y^b is the factor of a card with limit lim.
+// Writing f = sum[a] x^a f_a(y) and g = sum[m] x^m g_m(y), the identity
+// f * x dg/dx = n * g * x df/dx gives, coefficient by coefficient of x,
+//
+//	m f_0 g_m = sum[1 <= a <= lim] (n*a - m + a) f_a g_(m-a)
+//
+// and each f_a is 1 + y + ... + y^(lim-a), so multiplying by it, or dividing
+// by f_0 = (1-y^(lim+1))/(1-y), is a running sum over y.  g_0 = f_0^n comes
+// from the same identity in y alone.
+func classPower(numMain, numSide, lim, n int) [][]*big.Int {
+	g := newTable(numMain+1, numSide+1)
+	bigN := big.NewInt(int64(n))
+	t := new(big.Int)
+	// g_0 = f_0^n: s G_s = sum[1 <= b <= lim] (n*b - s + b) G_(s-b).
+	g[0][0].SetInt64(1)
+	for s := 1; s <= numSide; s++ {
+		for b := 1; b <= lim && b <= s; b++ {
+			t.Mul(bigN, big.NewInt(int64(b)))
+			t.Add(t, big.NewInt(int64(b-s)))
+			g[0][s].Add(g[0][s], t.Mul(t, g[0][s-b]))
+		}
+		g[0][s].Quo(g[0][s], big.NewInt(int64(s)))
+	}
+	rhs := make([]*big.Int, numSide+1)
+	fa := make([]*big.Int, numSide+1) // f_a g_(m-a)
+	for s := range rhs {
+		rhs[s], fa[s] = new(big.Int), new(big.Int)
+	}
+	window := new(big.Int)
+	for m := 1; m <= numMain; m++ {
+		for s := range rhs {
+			rhs[s].SetInt64(0)
+		}
+		for a := 1; a <= lim && a <= m; a++ {
+			// fa = (1 + y + ... + y^(lim-a)) * g_(m-a)
+			window.SetInt64(0)
+			for s := range fa {
+				window.Add(window, g[m-a][s])
+				if s > lim-a {
+					window.Sub(window, g[m-a][s-(lim-a)-1])
+				}
+				fa[s].Set(window)
+			}
+			coef := big.NewInt(int64(n*a - m + a))
+			for s := range rhs {
+				rhs[s].Add(rhs[s], t.Mul(coef, fa[s]))
+			}
+		}
+		// g_m = rhs * (1-y) / (1-y^(lim+1)) / m
+		for s := numSide; s > 0; s-- {
+			rhs[s].Sub(rhs[s], rhs[s-1])
+		}
+		for s := range rhs {
+			if s > lim {
+				rhs[s].Add(rhs[s], g[m][s-lim-1])
+			}
+			g[m][s].Set(rhs[s])
+		}
+		for s := range rhs {
+			g[m][s].Quo(g[m][s], big.NewInt(int64(m)))
+		}
+	}
+	return g
+}
+
+// selfTests are the examples from the CountDecks doc comment.
+var selfTests = []struct {
+	numMain, numSide int
+	limit            []int
+	want             int64
+}{
+	{3, 0, []int{1, 2, 3}, 6},
+	{3, 3, []int{1, 2, 3}, 6},
+	{3, 1, []int{1, 2, 3}, 12},
+	{4, 0, []int{1, 2, 3}, 5},
+	{4, 1, []int{1, 2, 3}, 8},
+	{4, 2, []int{1, 2, 3}, 5},
+	{60, 15, []int{75}, 1},
+}
+
+// SelfTest writes PASS or FAIL for each of the selfTests and reports
+// whether they all passed.
+func SelfTest(w io.Writer) bool {
+	ok := true
+	for _, st := range selfTests {
+		got := CountDecks(st.numMain, st.numSide, st.limit)
+		result := "PASS"
+		if got.Cmp(big.NewInt(st.want)) != 0 {
+			result = "FAIL"
+			ok = false
+		}
+		fmt.Fprintf(w, "%s: CountDecks(%d, %d, %v)=%v; want %d\n", result, st.numMain, st.numSide, st.limit, got, st.want)
+	}
+	return ok
+}
+
+// CountDecksSideLimits is like CountDecks, except that a deck may have up to
+// mainLimit[I] copies of card I in the main deck and sideLimit[I] in the
+// sideboard, and no more than the larger of the two in total.  So a card
+// legal only in the sideboard, like a wish target in some custom formats,
+// has mainLimit 0 and sideLimit 1, and an ordinary 4-of has 4 and 4; a card
+// with 4 and 1 may have 3 main deck copies and a sideboard copy, but not 4
+// and 1.  It's an error if mainLimit and sideLimit aren't the same length.
+func CountDecksSideLimits(numMain, numSide int, mainLimit, sideLimit []int) (*big.Int, error) {
+	if len(mainLimit) != len(sideLimit) {
+		return nil, fmt.Errorf("%w: %d main deck limits and %d sideboard limits", ErrBadLimits, len(mainLimit), len(sideLimit))
+	}
+	if numMain < 0 || numSide < 0 {
+		return nil, fmt.Errorf("%w: %d+%d", ErrDeckSize, numMain, numSide)
+	}
+	return _countDecks(numMain, numSide, mainLimit, sideLimit, map[key]*big.Int{}), nil
+}
+
+func _countDecks(numMain, numSide int, mainLimit, sideLimit []int, cache map[key]*big.Int) *big.Int {
+	if numMain+numSide == 0 {
+		return big.NewInt(1)
+	}
+	if len(mainLimit) == 0 {
+		return big.NewInt(0)
+	}
+	key := key{numMain, numSide, len(mainLimit)}
+	if val, ok := cache[key]; ok {
+		return val
+	}
+	total := mainLimit[0]
+	if sideLimit[0] > total {
+		total = sideLimit[0]
+	}
+	sum := big.NewInt(0)
+	for m := 0; m <= numMain && m <= mainLimit[0]; m++ {
+		for s := 0; s <= numSide && s <= sideLimit[0] && m+s <= total; s++ {
+			sum.Add(sum, _countDecks(numMain-m, numSide-s, mainLimit[1:], sideLimit[1:], cache))
+		}
+	}
+	cache[key] = sum
+	return sum
+}
+
+// CountDecksOneZone is like CountDecks, but for formats where each card's
+// copies must all be in the main deck or all in the sideboard.  For each
+// card, a deck has a copies in the main deck or b in the sideboard, not both.
+func CountDecksOneZone(numMain, numSide int, limit []int) *big.Int {
+	ways := newTable(numMain+1, numSide+1)
+	ways[0][0].SetInt64(1)
+	for _, lim := range limit {
+		next := newTable(numMain+1, numSide+1)
+		for m := range next {
+			for s := range next[m] {
+				next[m][s].Set(ways[m][s])
+				for a := 1; a <= m && a <= lim; a++ {
+					next[m][s].Add(next[m][s], ways[m-a][s])
+				}
+				for b := 1; b <= s && b <= lim; b++ {
+					next[m][s].Add(next[m][s], ways[m][s-b])
+				}
+			}
+		}
+		ways = next
+	}
+	return ways[numMain][numSide]
+}
+
+// CountDisjointDeckPairs counts the ordered pairs of decks, each with
+// numMain main deck cards and numSide in the sideboard, that have no card in
+// common.  Each card goes to the first deck, the second, or neither, and a
+// deck that gets it can have up to its limit across main and sideboard.  The
+// table has a dimension for each zone of each deck, so it's only practical
+// for small decks.
+func CountDisjointDeckPairs(numMain, numSide int, limit []int) *big.Int {
+	type sizes struct{ mainA, sideA, mainB, sideB int }
+	ways := map[sizes]*big.Int{{}: big.NewInt(1)}
+	for _, lim := range limit {
+		next := map[sizes]*big.Int{}
+		add := func(to sizes, n *big.Int) {
+			if next[to] == nil {
+				next[to] = big.NewInt(0)
+			}
+			next[to].Add(next[to], n)
+		}
+		for from, n := range ways {
+			add(from, n)
+			for a := 0; a <= lim; a++ {
+				for b := 0; a+b <= lim; b++ {
+					if a+b == 0 {
+						continue
+					}
+					if from.mainA+a <= numMain && from.sideA+b <= numSide {
+						add(sizes{from.mainA + a, from.sideA + b, from.mainB, from.sideB}, n)
+					}
+					if from.mainB+a <= numMain && from.sideB+b <= numSide {
+						add(sizes{from.mainA, from.sideA, from.mainB + a, from.sideB + b}, n)
+					}
+				}
+			}
+		}
+		ways = next
+	}
+	if n, ok := ways[sizes{numMain, numSide, numMain, numSide}]; ok {
+		return n
+	}
+	return big.NewInt(0)
+}
+
+// CountDecksForbiddenPair counts the decks from limit that don't play both
+// card a and card b.  By inclusion-exclusion, those are the decks without a,
+// plus those without b, minus those without either.
+func CountDecksForbiddenPair(numMain, numSide int, limit []int, a, b int) *big.Int {
+	count := CountDecks(numMain, numSide, without(limit, a))
+	count.Add(count, CountDecks(numMain, numSide, without(limit, b)))
+	return count.Sub(count, CountDecks(numMain, numSide, without(limit, a, b)))
+}
+
+// without returns limit without the cards at the given indexes.
+func without(limit []int, indexes ...int) []int {
+	skip := map[int]bool{}
+	for _, i := range indexes {
+		skip[i] = true
+	}
+	rest := []int{}
+	for i, lim := range limit {
+		if !skip[i] {
+			rest = append(rest, lim)
+		}
+	}
+	return rest
+}
+
+// CountDecksThemeCore counts the numMain-card decks from limit that play 4
+// copies each of at least minFours of the cards at themeIndices, such as a
+// tribe's core.  It counts the theme cards by size and by how many of them
+// are 4-ofs (up to minFours, which stands for "minFours or more"), then
+// combines the decks with enough 4-ofs with the other cards.
+func CountDecksThemeCore(numMain int, limit []int, themeIndices []int, minFours int) *big.Int {
+	if minFours < 0 {
+		minFours = 0
+	}
+	inTheme := map[int]bool{}
+	for _, i := range themeIndices {
+		inTheme[i] = true
+	}
+	ways := newTable(minFours+1, numMain+1) // ways[J][S]: S theme cards, J 4-ofs.
+	ways[0][0].SetInt64(1)
+	rest := []int{}
+	for i, lim := range limit {
+		if !inTheme[i] {
+			rest = append(rest, lim)
+			continue
+		}
+		next := newTable(minFours+1, numMain+1)
+		for j, row := range ways {
+			for size, n := range row {
+				if n.Sign() == 0 {
+					continue
+				}
+				for k := 0; k <= lim && size+k <= numMain; k++ {
+					to := j
+					if k == 4 && j < minFours {
+						to++
+					}
+					next[to][size+k].Add(next[to][size+k], n)
+				}
+			}
+		}
+		ways = next
+	}
+	others := DeckCountsBySize(rest, numMain)
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for size, n := range ways[minFours] {
+		sum.Add(sum, t.Mul(n, others[numMain-size]))
+	}
+	return sum
+}
+
+// CountDecksCapPerCard is CountDecks with every limit clamped to perCardMax,
+// counting for example the decks with no more than 2 copies of any card.
+func CountDecksCapPerCard(numMain, numSide, perCardMax int, limit []int) *big.Int {
+	capped := make([]int, len(limit))
+	for i, lim := range limit {
+		if lim > perCardMax {
+			lim = perCardMax
+		}
+		capped[i] = lim
+	}
+	return CountDecks(numMain, numSide, capped)
+}
+
+// largeWork is the estimated work, in table updates, above which
+// IsLargeCount reports a count as large.  No 60+15 count of a real format
+// crosses it; much bigger decks do.
+const largeWork = 1e8
+
+// IsLargeCount reports whether CountDecks(numMain, numSide, limit), or
+// CountDecksProgress, is expected to be slow.  It estimates the work from the
+// table size and the classes of LimitClasses, as CountDecksByClass does it: a
+// classPower recurrence for each class, whose work grows with its limit, a
+// mulTables for each class but the last two, and the one coefficient of their
+// product.
+func IsLargeCount(numMain, numSide int, limit []int) bool {
+	if numMain < 0 || numSide < 0 {
+		return false
+	}
+	cells := float64((numMain + 1) * (numSide + 1))
+	classes := LimitClasses(numMain, numSide, limit)
+	work := cells
+	for lim := range classes {
+		if lim > numMain {
+			lim = numMain
+		}
+		work += cells * float64(lim+1)
+	}
+	if len(classes) > 2 {
+		// Each product term pairs every cell with those below it.
+		work += float64(len(classes)-2) * cells * cells / 4
+	}
+	return work > largeWork
+}
+
+// CountDecksProgress returns CountDecks(numMain, numSide, limit), calling
+// progress(I, len(limit)) as it accounts for the cards, with I increasing to
+// len(limit).  It counts by class, as CountDecks does, so I moves a class of
+// cards at a time, once the class's factor is done.
+func CountDecksProgress(numMain, numSide int, limit []int, progress func(done, total int)) *big.Int {
+	if numMain < 0 || numSide < 0 {
+		return big.NewInt(0)
+	}
+	classes := LimitClasses(numMain, numSide, limit)
+	fp := Fingerprint(numMain, numSide, classes)
+	if c, ok := defaults.memo.Get(fp); ok {
+		progress(len(limit), len(limit))
+		return c
+	}
+	// Cards with limit 0 are accounted for from the start.
+	done := len(limit)
+	for _, n := range classes {
+		done -= n
+	}
+	var mu sync.Mutex
+	c := countDecksByClass(numMain, numSide, classes, func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		done += n
+		progress(done, len(limit))
+	})
+	if done < len(limit) {
+		progress(len(limit), len(limit))
+	}
+	defaults.memo.Put(fp, c)
+	return c
+}
+
+// deckTableContext returns a table whose element [M][S] is CountDecks(M, S,
+// limit), for M <= numMain and S <= numSide, card by card, calling
+// progress(I, len(limit)) after the first I cards.  It gives up with ctx's
+// error, between cards, once ctx is done.
+func deckTableContext(ctx context.Context, numMain, numSide int, limit []int, progress func(done, total int)) ([][]*big.Int, error) {
+	ways := newTable(numMain+1, numSide+1)
+	ways[0][0].SetInt64(1)
+	next := newTable(numMain+1, numSide+1)
+	diag := newTable(numMain+1, numSide+1)
+	for i, lim := range limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		gfStep(next, ways, diag, lim)
+		ways, next = next, ways
+		progress(i+1, len(limit))
+	}
+	return ways, nil
+}
+
+// gfStep sets next to the product of the generating function ways and a
+// card's, the sum of x^a y^b for a+b <= lim, keeping the terms up to ways'
+// size.  Rather than adding up to lim^2 terms for each coefficient, it uses
+// the identity
+//
+//	(1-x) * sum[a+b <= L] x^a y^b = sum[b <= L] y^b - sum[1 <= i <= L+1] x^i y^(L+1-i)
+//
+// so that next[m][s] is next[m-1][s], plus a window of row m of ways, minus a
+// stretch of an antidiagonal of ways.  Sliding the window and keeping running
+// sums along the antidiagonals (in diag, which is scratch space) makes each
+// coefficient a few additions.
+func gfStep(next, ways, diag [][]*big.Int, lim int) {
+	numMain, numSide := len(ways)-1, len(ways[0])-1
+	if lim > numMain+numSide {
+		lim = numMain + numSide
+	}
+	// diag[m][s] = ways[m][s] + ways[m-1][s+1] + ways[m-2][s+2] + ...
+	for m := range ways {
+		for s := range ways[m] {
+			diag[m][s].Set(ways[m][s])
+			if m > 0 && s < numSide {
+				diag[m][s].Add(diag[m][s], diag[m-1][s+1])
+			}
+		}
+	}
+	row := new(big.Int)
+	for m := range ways {
+		row.SetInt64(0) // ways[m][s-lim] + ... + ways[m][s]
+		for s := range ways[m] {
+			row.Add(row, ways[m][s])
+			if s > lim {
+				row.Sub(row, ways[m][s-lim-1])
+			}
+			n := next[m][s].Set(row)
+			if m > 0 {
+				n.Add(n, next[m-1][s])
+			}
+			// Subtract ways[m-i][s-lim-1+i] for the i in [lo, hi] in range.
+			lo, hi := lim+1-s, lim+1
+			if lo < 1 {
+				lo = 1
+			}
+			if hi > m {
+				hi = m
+			}
+			if lo <= hi {
+				n.Sub(n, diag[m-lo][s-lim-1+lo])
+				if m-hi-1 >= 0 && s-lim+hi <= numSide {
+					n.Add(n, diag[m-hi-1][s-lim+hi])
+				}
+			}
+		}
+	}
+}
+
+// DeckCountsBySize returns a slice whose element K is CountDecks(K, 0, limit),
+// for 0 <= K <= maxSize.  Rather than recursing once per size, it computes the
+// coefficients of the generating function (1 + x + ... + x^L[0]) * (1 + x +
+// ... + x^L[1]) * ... one card at a time.
+func DeckCountsBySize(limit []int, maxSize int) []*big.Int {
+	counts := make([]*big.Int, maxSize+1)
+	for k := range counts {
+		counts[k] = big.NewInt(0)
+	}
+	counts[0].SetInt64(1)
+	prefix := make([]*big.Int, maxSize+2) // prefix[k] is counts[0] + ... + counts[k-1].
+	for k := range prefix {
+		prefix[k] = big.NewInt(0)
+	}
+	for _, lim := range limit {
+		for k, c := range counts {
+			prefix[k+1].Add(prefix[k], c)
+		}
+		for k := range counts {
+			lo := k - lim
+			if lo < 0 {
+				lo = 0
+			}
+			counts[k].Sub(prefix[k+1], prefix[lo])
+		}
+	}
+	return counts
+}
+
+// Log10 returns the base-10 logarithm of c, or -Inf if c is 0.
+func Log10(c *big.Int) float64 {
+	if c.Sign() == 0 {
+		return math.Inf(-1)
+	}
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(c).MantExp(mant)
+	m, _ := mant.Float64()
+	return math.Log10(m) + float64(exp)*math.Log10(2)
+}
+
+// CountGuildDecks counts the decks in format built from cards whose color
+// identity is within colors, a string of color letters such as "WU" for
+// Azorius.  Colorless cards fit in any guild.
+func CountGuildDecks(cards map[string]Card, format, colors string, numMain, numSide int) *big.Int {
+	return CountDecksWhere(numMain, numSide, cards, format, func(c Card) bool { return c.withinIdentity(colors) })
+}
+
+// identityNames are the names of color identities that ParseIdentity knows,
+// besides strings of color letters.
+var identityNames = map[string]string{
+	"colorless": "",
+	"white":     "W", "blue": "U", "black": "B", "red": "R", "green": "G",
+	"azorius": "WU", "dimir": "UB", "rakdos": "BR", "gruul": "RG", "selesnya": "WG",
+	"orzhov": "WB", "izzet": "UR", "golgari": "BG", "boros": "WR", "simic": "UG",
+	"bant": "WUG", "esper": "WUB", "grixis": "UBR", "jund": "BRG", "naya": "WRG",
+	"abzan": "WBG", "jeskai": "WUR", "sultai": "UBG", "mardu": "WBR", "temur": "URG",
+}
+
+// ParseIdentity returns the color identity s names as its color letters in
+// WUBRG order.  s is either letters, in any case and order, such as "rw", or
+// a name such as "boros", "mono-red", "esper", or "colorless" (or "C"), which
+// is the empty identity.
+func ParseIdentity(s string) (string, error) {
+	name := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "mono-")
+	if identity, ok := identityNames[name]; ok {
+		return identity, nil
+	}
+	if strings.EqualFold(name, "c") {
+		return "", nil
+	}
+	identity := ""
+	for _, color := range colors {
+		n := strings.Count(strings.ToUpper(name), string(color))
+		if n > 1 {
+			return "", fmt.Errorf("%w %q: %c is repeated", ErrBadIdentity, s, color)
+		}
+		if n == 1 {
+			identity += string(color)
+		}
+	}
+	if name == "" || len(identity) != len(name) {
+		return "", fmt.Errorf("%w %q: want color letters from %s, or a name like boros", ErrBadIdentity, s, colors)
+	}
+	return identity, nil
+}
+
+// WithinIdentity returns the cards whose color identity is within identity,
+// as from ParseIdentity, for counting decks of those colors or fewer.  It
+// doesn't modify cards.
+func WithinIdentity(cards map[string]Card, identity string) map[string]Card {
+	within := map[string]Card{}
+	for name, c := range cards {
+		if c.withinIdentity(identity) {
+			within[name] = c
+		}
+	}
+	return within
+}
+
+// CountDecksByIdentity returns the number of decks in format whose cards'
+// color identities, main deck and sideboard together, make up exactly each
+// identity, keyed by its letters in WUBRG order ("" for colorless decks).
+// Identities with no decks are left out.  As for CountDecksMaxColors, the
+// counts of decks within each identity are turned into counts of decks of
+// exactly it by inclusion-exclusion, here one color at a time.
+func CountDecksByIdentity(numMain, numSide int, cards map[string]Card, format string) map[string]*big.Int {
+	identity := func(mask int) string {
+		s := ""
+		for i := range colors {
+			if mask&(1<<i) != 0 {
+				s += colors[i : i+1]
+			}
+		}
+		return s
+	}
+	exact := make([]*big.Int, 1<<len(colors))
+	parallel(len(exact), defaults.workers, func(mask int) {
+		exact[mask] = CountGuildDecks(cards, format, identity(mask), numMain, numSide)
+	})
+	for i := range colors {
+		for mask := range exact {
+			if mask&(1<<i) != 0 {
+				exact[mask].Sub(exact[mask], exact[mask&^(1<<i)])
+			}
+		}
+	}
+	counts := map[string]*big.Int{}
+	for mask, c := range exact {
+		if c.Sign() != 0 {
+			counts[identity(mask)] = c
+		}
+	}
+	return counts
+}
+
+// CountDecksWithSet counts the decks in format with at least one card printed
+// in setCode: all decks minus those built only from cards never printed there.
+func CountDecksWithSet(numMain, numSide int, cards map[string]Card, format, setCode string) *big.Int {
+	all := CountDecksWhere(numMain, numSide, cards, format, func(Card) bool { return true })
+	without := CountDecksWhere(numMain, numSide, cards, format, func(c Card) bool { return !c.PrintedIn(setCode) })
+	return all.Sub(all, without)
+}
+
+// CountBlockDecks counts the decks for a Block Constructed format made of
+// the given sets: cards printed in any of them, 4 copies each, plus unlimited
+// basic lands.  It ignores the cards' legalities.
+func CountBlockDecks(cards map[string]Card, sets []string, numMain, numSide int) *big.Int {
+	return CountDecks(numMain, numSide, setLimits(cards, sets, nil))
+}
+
+// OldSchoolSets are the sets of Old School 93/94: Alpha, Beta, Unlimited,
+// Summer Magic, Arabian Nights, Antiquities, Legends, and The Dark.
+var OldSchoolSets = []string{"LEA", "LEB", "2ED", "SUM", "ARN", "ATQ", "LEG", "DRK"}
+
+// CountOldSchoolDecks counts Old School 93/94 decks: cards printed in the
+// OldSchoolSets, 4 copies each except for the restricted cards, which are
+// 1-ofs, and the banned ones, which are left out.  The community keeps the
+// lists, so they're arguments rather than read from mtgjson.
+func CountOldSchoolDecks(cards map[string]Card, restricted, banned []string, numMain, numSide int) *big.Int {
+	limits := map[string]int{}
+	for _, name := range restricted {
+		limits[name] = 1
+	}
+	for _, name := range banned {
+		limits[name] = 0
+	}
+	return CountDecks(numMain, numSide, setLimits(cards, OldSchoolSets, limits))
+}
+
+// CountProjectedStandard projects the number of Standard decks after a
+// rotation: the sets in out leave Standard and those in in join it.  A card
+// stays if it has a printing in a Standard set that isn't leaving, and cards
+// printed in the joining sets are 4-ofs unless their Standard status says
+// otherwise.  It's a projection from the current data, not an official list:
+// it can't know about new bans, or about reprints in sets not in the data.
+func CountProjectedStandard(numMain, numSide int, cards map[string]Card, out, in []string) *big.Int {
+	staying := map[string]bool{}
+	for set := range standardSets(cards) {
+		staying[set] = true
+	}
+	for _, set := range out {
+		delete(staying, set)
+	}
+	joining := map[string]bool{}
+	for _, set := range in {
+		staying[set] = true
+		joining[set] = true
+	}
+	limit := []int{}
+	for _, c := range cards {
+		lim := c.Limit("standard")
+		stays := c.IsBasicLand()
+		for _, set := range c.Printings {
+			if staying[set] {
+				stays = true
+			}
+			if _, ok := c.Legalities["standard"]; joining[set] && !ok {
+				lim = DefaultStatusLimits["Legal"]
+			}
+		}
+		if stays && lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	return CountDecks(numMain, numSide, limit)
+}
+
+// standardSets returns the sets that are in Standard: those whose cards all
+// have a Standard status.  Older sets, and supplemental products with cards
+// that were never Standard-legal, have cards without one.
+func standardSets(cards map[string]Card) map[string]bool {
+	sets, others := map[string]bool{}, map[string]bool{}
+	for _, c := range cards {
+		_, ok := c.Legalities["standard"]
+		for _, set := range c.Printings {
+			if ok {
+				sets[set] = true
+			} else {
+				others[set] = true
+			}
+		}
+	}
+	for set := range others {
+		delete(sets, set)
+	}
+	return sets
+}
+
+// setLimits returns the limit vector for the cards printed in any of sets,
+// plus the basic lands, which are unlimited.  Other cards have a limit of 4,
+// unless they're in override.
+func setLimits(cards map[string]Card, sets []string, override map[string]int) []int {
+	limit := []int{}
+	for _, c := range cards {
+		if c.IsBasicLand() {
+			limit = append(limit, 1000)
+			continue
+		}
+		for _, set := range sets {
+			if !c.PrintedIn(set) {
+				continue
+			}
+			lim, ok := override[c.Name]
+			if !ok {
+				lim = DefaultStatusLimits["Legal"]
+			}
+			if lim > 0 {
+				limit = append(limit, lim)
+			}
+			break
+		}
+	}
+	return limit
+}
+
+// CountCardPairs counts the pairs of distinct cards legal in format.  If
+// sameColorIdentity is set, both cards must have the same color identity.
+// Ordered pairs count (a, b) and (b, a) separately; unordered pairs don't.
+func CountCardPairs(cards map[string]Card, format string, sameColorIdentity, ordered bool) *big.Int {
+	groups := map[string]int64{}
+	for _, c := range cards {
+		if c.Limit(format) == 0 {
+			continue
+		}
+		key := ""
+		if sameColorIdentity {
+			key = c.IdentityKey()
+		}
+		groups[key]++
+	}
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for _, n := range groups {
+		sum.Add(sum, t.Mul(big.NewInt(n), big.NewInt(n-1)))
+	}
+	if !ordered {
+		sum.Rsh(sum, 1)
+	}
+	return sum
+}
+
+// CountBrawlDecks counts 60-card Brawl decks: a commander plus 59 other
+// cards, all legal in Brawl (the Standard card pool).
+func CountBrawlDecks(cards map[string]Card) *big.Int {
+	return countCommanderDecks(cards, "brawl", 60)
+}
+
+// countCommanderDecks counts deckSize-card singleton decks in format made of
+// a commander and deckSize-1 other cards within its color identity.  Basic
+// lands (and cards like Relentless Rats) are unlimited as usual.
+func countCommanderDecks(cards map[string]Card, format string, deckSize int) *big.Int {
+	cc := newCompletions(cards, format, deckSize)
+	sum := big.NewInt(0)
+	for _, cmdr := range commanders(cards, format) {
+		sum.Add(sum, cc.count(cmdr))
+	}
+	return sum
+}
+
+// CountAllCommanderDecks counts 100-card Commander decks in format over every
+// way to choose the command zone: a single commander, or any of the pairs of
+// CommandZonePairs.  Each deck's other 98 cards are within the pair's
+// combined color identity.
+func CountAllCommanderDecks(cards map[string]Card, format string) *big.Int {
+	return countAllCommanderDecks(cards, format, 100)
+}
+
+// CountDecksForCommander counts the 100-card decks in format with the named
+// command zone: one commander, or two that can share it, as for
+// CommandZonePairs.
+func CountDecksForCommander(cards map[string]Card, format string, names ...string) (*big.Int, error) {
+	if len(names) < 1 || len(names) > 2 {
+		return nil, fmt.Errorf("%w: want one or two commanders; got %d", ErrBadDecklist, len(names))
+	}
+	cmdrs := []Card{}
+	for _, name := range names {
+		c, ok := cards[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, name)
+		}
+		if c.Limit(format) == 0 {
+			return nil, fmt.Errorf("%w: %s isn't legal in %s", ErrBadDecklist, name, format)
+		}
+		cmdrs = append(cmdrs, c)
+	}
+	a := cmdrs[0]
+	switch {
+	case len(cmdrs) == 1 && a.CanLead(format):
+	case len(cmdrs) == 2 && canShareCommandZone(a, cmdrs[1], format):
+	default:
+		return nil, fmt.Errorf("%w: %s can't be a command zone in %s", ErrBadDecklist, strings.Join(names, " and "), format)
+	}
+	return newCompletions(cards, format, 100).count(cmdrs...), nil
+}
+
+func countAllCommanderDecks(cards map[string]Card, format string, deckSize int) *big.Int {
+	cc := newCompletions(cards, format, deckSize)
+	sum := big.NewInt(0)
+	for _, c := range commanders(cards, format) {
+		sum.Add(sum, cc.count(c))
+	}
+	for _, pair := range CommandZonePairs(cards, format) {
+		sum.Add(sum, cc.count(pair[0], pair[1]))
+	}
+	return sum
+}
+
+// CommandZonePairs returns every pair of cards legal in format that can be a
+// deck's two commanders, each pair once and in order of name: two commanders
+// with Partner, two with Friends forever, two that have Partner with each
+// other, or a commander that says "Choose a Background" with a Background.
+func CommandZonePairs(cards map[string]Card, format string) [][2]Card {
+	var partners, friends, choosers, backgrounds []Card
+	pairs := [][2]Card{}
+	add := func(a, b Card) {
+		if b.Name < a.Name {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]Card{a, b})
+	}
+	for _, c := range commanders(cards, format) {
+		switch {
+		case c.HasPartner():
+			partners = append(partners, c)
+		case c.HasFriendsForever():
+			friends = append(friends, c)
+		}
+		if c.ChoosesBackground() {
+			choosers = append(choosers, c)
+		}
+		// Take each Partner with pair from its first card by name, or from
+		// the only card that names the other.
+		if p, ok := cards[c.PartnersWith()]; ok && p.Limit(format) > 0 && p.CanLead(format) &&
+			(c.Name < p.Name || p.PartnersWith() != c.Name) {
+			add(c, p)
+		}
+	}
+	for _, c := range cards {
+		if c.Limit(format) > 0 && c.HasSubtype("Background") {
+			backgrounds = append(backgrounds, c)
+		}
+	}
+	for _, group := range [][]Card{partners, friends} {
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				add(a, b)
+			}
+		}
+	}
+	for _, a := range choosers {
+		for _, b := range backgrounds {
+			add(a, b)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0].Name != pairs[j][0].Name {
+			return pairs[i][0].Name < pairs[j][0].Name
+		}
+		return pairs[i][1].Name < pairs[j][1].Name
+	})
+	return pairs
+}
+
+// commanders returns the cards that can lead a deck in format, in order of
+// name.
+func commanders(cards map[string]Card, format string) []Card {
+	cmdrs := []Card{}
+	for _, c := range cards {
+		if c.Limit(format) > 0 && c.CanLead(format) {
+			cmdrs = append(cmdrs, c)
+		}
+	}
+	sort.Slice(cmdrs, func(a, b int) bool { return cmdrs[a].Name < cmdrs[b].Name })
+	return cmdrs
+}
+
+// completions counts the ways to fill out a Commander deck around its
+// command zone.  The counts by size for each color identity's singleton pool
+// are computed once and shared by every command zone with that identity.
+type completions struct {
+	cards      map[string]Card
+	format     string
+	deckSize   int
+	byIdentity map[string][]*big.Int
+}
+
+func newCompletions(cards map[string]Card, format string, deckSize int) *completions {
+	return &completions{cards, format, deckSize, map[string][]*big.Int{}}
+}
+
+// count returns the number of decks with exactly the given cards in the
+// command zone.
+func (cc *completions) count(cmdrs ...Card) *big.Int {
+	identity := identityUnion(cmdrs...)
+	counts, ok := cc.byIdentity[identity]
+	if !ok {
+		counts = DeckCountsBySize(singletonLimits(cc.cards, cc.format, identity), cc.deckSize)
+		cc.byIdentity[identity] = counts
+	}
+	// The commanders are in their own identity's pool, so take them out.
+	for range cmdrs {
+		counts = withoutSingleton(counts)
+	}
+	n := cc.deckSize - len(cmdrs)
+	if n < 0 {
+		return big.NewInt(0)
+	}
+	return counts[n]
+}
+
+// identityUnion returns the IdentityKey of the combined color identity of cs.
+func identityUnion(cs ...Card) string {
+	var u Card
+	seen := map[string]bool{}
+	for _, c := range cs {
+		for _, color := range c.ColorIdentity {
+			if !seen[color] {
+				seen[color] = true
+				u.ColorIdentity = append(u.ColorIdentity, color)
+			}
+		}
+	}
+	return u.IdentityKey()
+}
+
+// singletonLimits returns the singleton limit vector for format's cards
+// within identity.
+func singletonLimits(cards map[string]Card, format, identity string) []int {
+	limit := poolLimits(cards, format, func(c Card) bool { return c.withinIdentity(identity) })
+	for i, lim := range limit {
+		if lim < 1000 {
+			limit[i] = 1
+		}
+	}
+	return limit
+}
+
+// withoutSingleton takes the counts by size for a pool including some
+// singleton card and returns the counts by size for the pool without it.
+// Each deck of size K from the full pool either omits the card or is a deck
+// of size K-1 from the smaller pool plus the card, so without[K] = with[K] -
+// without[K-1].
+func withoutSingleton(with []*big.Int) []*big.Int {
+	without := make([]*big.Int, len(with))
+	for k, c := range with {
+		without[k] = new(big.Int).Set(c)
+		if k > 0 {
+			without[k].Sub(without[k], without[k-1])
+		}
+	}
+	return without
+}
+
+// CountDecksMaxDistinctNonland counts the numMain-card decks in format with
+// at most maxDistinct different nonland cards.  Lands are unconstrained.  A
+// negative maxDistinct allows no decks.
+func CountDecksMaxDistinctNonland(numMain int, cards map[string]Card, format string, maxDistinct int) *big.Int {
+	if maxDistinct < 0 {
+		return big.NewInt(0)
+	}
+	limit, land := []int{}, []bool{}
+	for _, c := range cards {
+		if lim := c.Limit(format); lim > 0 {
+			limit = append(limit, lim)
+			land = append(land, c.IsLand())
+		}
+	}
+	distinct := func(i, copies int) int {
+		if land[i] || copies == 0 {
+			return 0
+		}
+		return 1
+	}
+	return countCapped(numMain, limit, distinct, maxDistinct)
+}
+
+// CountDecksFromNames counts the decks in format built only from the named
+// cards, each within its usual limit in format.  It's an error to name a card
+// that isn't in cards.
+func CountDecksFromNames(numMain, numSide int, cards map[string]Card, format string, names []string) (*big.Int, error) {
+	chosen := map[string]Card{}
+	for _, name := range names {
+		c, ok := cards[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, name)
+		}
+		chosen[name] = c
+	}
+	return CountDecks(numMain, numSide, poolLimits(chosen, format, func(Card) bool { return true })), nil
+}
+
+// CountDecksUnion counts the decks built from cards legal in formatA or
+// formatB, allowing each card its more permissive limit of the two, so a card
+// restricted in one and legal in the other is a 4-of.
+func CountDecksUnion(numMain, numSide int, cards map[string]Card, formatA, formatB string) *big.Int {
+	return CountDecks(numMain, numSide, mergedLimits(cards, formatA, formatB, func(a, b int) int {
+		if a > b {
+			return a
+		}
+		return b
+	}))
+}
+
+// CountDecksIntersection counts the decks built from cards legal in both
+// formatA and formatB, allowing each card its stricter limit of the two.  A
+// card banned in either format is left out.
+func CountDecksIntersection(numMain, numSide int, cards map[string]Card, formatA, formatB string) *big.Int {
+	return CountDecks(numMain, numSide, mergedLimits(cards, formatA, formatB, func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}))
+}
+
+// mergedLimits returns the limit vector whose entry for each card is
+// combine(its limit in formatA, its limit in formatB), leaving out the cards
+// for which that's 0.
+func mergedLimits(cards map[string]Card, formatA, formatB string, combine func(a, b int) int) []int {
+	limit := []int{}
+	for _, c := range cards {
+		if lim := combine(c.Limit(formatA), c.Limit(formatB)); lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	return limit
+}
+
+// CountDecksMaxColors counts the numMain-card decks in format whose cards'
+// color identities together have at most maxColors colors.  If within[S] is
+// the number of decks using only the colors in S, then by inclusion-exclusion
+// the decks using exactly the colors in S number the sum over subsets T of S
+// of (-1)^|S-T| within[T]; the answer sums those over the small enough S.
+func CountDecksMaxColors(numMain int, cards map[string]Card, format string, maxColors int) *big.Int {
+	subset := func(mask int) string {
+		s := ""
+		for i := range colors {
+			if mask&(1<<i) != 0 {
+				s += colors[i : i+1]
+			}
+		}
+		return s
+	}
+	all := 1 << len(colors)
+	within := make([]*big.Int, all)
+	for mask := range within {
+		identity := subset(mask)
+		limit := poolLimits(cards, format, func(c Card) bool { return c.withinIdentity(identity) })
+		within[mask] = DeckCountsBySize(limit, numMain)[numMain]
+	}
+	sum := big.NewInt(0)
+	for mask := 0; mask < all; mask++ {
+		if len(subset(mask)) > maxColors {
+			continue
+		}
+		// Every submask of mask, each once.
+		for sub := mask; ; sub = (sub - 1) & mask {
+			if (len(subset(mask))-len(subset(sub)))%2 == 0 {
+				sum.Add(sum, within[sub])
+			} else {
+				sum.Sub(sum, within[sub])
+			}
+			if sub == 0 {
+				break
+			}
+		}
+	}
+	return sum
+}
+
+// FindCard returns the card called name in cards.  Besides its exact name, a
+// card is found by its name in another case, like "lightning bolt", or by
+// the name of its first face, like "Fire" for "Fire // Ice", if no other card
+// has that name too.
+func FindCard(cards map[string]Card, name string) (Card, error) {
+	if c, ok := cards[name]; ok {
+		return c, nil
+	}
+	var found []string
+	for full := range cards {
+		face := full
+		if i := strings.Index(full, " // "); i >= 0 {
+			face = full[:i]
+		}
+		if strings.EqualFold(full, name) || strings.EqualFold(face, name) {
+			found = append(found, full)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Card{}, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, name)
+	case 1:
+		return cards[found[0]], nil
+	}
+	sort.Strings(found)
+	return Card{}, fmt.Errorf("%w: %q could be %s", ErrBadDecklist, name, strings.Join(found, " or "))
+}
+
+// CountDecksIncluding counts the decks in format whose main decks have at
+// least include[name] copies of each card named, as for FindCard, in
+// include.  Setting those copies aside leaves decks of numMain minus their
+// number main deck cards, from the same pool but with each included card
+// allowed include[name] fewer copies.  It's an error if an included card
+// isn't legal in format, or is included more times than it's allowed, or if
+// the included cards don't fit in the main deck.
+func CountDecksIncluding(numMain, numSide int, cards map[string]Card, format string, include map[string]int) (*big.Int, error) {
+	fewer := map[string]int{}
+	for name, n := range include {
+		c, err := FindCard(cards, name)
+		if err != nil {
+			return nil, err
+		}
+		lim := c.Limit(format)
+		fewer[c.Name] += n
+		switch {
+		case n < 1:
+			return nil, fmt.Errorf("%w: %d copies of %s", ErrBadDecklist, n, c.Name)
+		case lim == 0:
+			return nil, fmt.Errorf("%w: %s isn't legal in %s", ErrBadDecklist, c.Name, format)
+		case fewer[c.Name] > lim:
+			return nil, fmt.Errorf("%w: %d copies of %s; %s allows %d", ErrBadDecklist, fewer[c.Name], c.Name, format, lim)
+		}
+		numMain -= n
+	}
+	if numMain < 0 {
+		return nil, fmt.Errorf("%w: the included cards don't fit in the main deck", ErrDeckSize)
+	}
+	limit := []int{}
+	for _, c := range cards {
+		if lim := c.Limit(format) - fewer[c.Name]; lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	return CountDecks(numMain, numSide, limit), nil
+}
+
+// CountDecksForcingRestricted counts the decks in format that play the one
+// allowed copy of the restricted card cardName, in the main deck or the
+// sideboard.  It's an error if cardName isn't Restricted in format.
+func CountDecksForcingRestricted(numMain, numSide int, cards map[string]Card, format, cardName string) (*big.Int, error) {
+	forced, ok := cards[cardName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, cardName)
+	}
+	if status := forced.Legalities[CanonicalFormat(format)]; status != "Restricted" {
+		return nil, fmt.Errorf("%s in %s: %w (%s)", cardName, format, ErrNotRestricted, status)
+	}
+	limit := poolLimits(cards, format, func(c Card) bool { return c.Name != cardName })
+	count := big.NewInt(0)
+	if numMain > 0 {
+		count.Add(count, CountDecks(numMain-1, numSide, limit))
+	}
+	if numSide > 0 {
+		count.Add(count, CountDecks(numMain, numSide-1, limit))
+	}
+	return count, nil
+}
+
+// CountDecksMinMulticolor counts the numMain-card decks in format with at
+// least minMulti copies of cards with two or more colors in their identity.
+// The multicolor and other cards are counted by size separately, then
+// combined wherever the multicolor part is big enough.
+func CountDecksMinMulticolor(numMain int, cards map[string]Card, format string, minMulti int) *big.Int {
+	isMulti := func(c Card) bool { return len(c.ColorIdentity) >= 2 }
+	multi := DeckCountsBySize(poolLimits(cards, format, isMulti), numMain)
+	other := DeckCountsBySize(poolLimits(cards, format, func(c Card) bool { return !isMulti(c) }), numMain)
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	if minMulti < 0 {
+		minMulti = 0
+	}
+	for k := minMulti; k <= numMain; k++ {
+		sum.Add(sum, t.Mul(multi[k], other[numMain-k]))
+	}
+	return sum
+}
+
+// CountDecksCurveFriendly counts the numMain-card decks in format with at
+// most maxPerCMC[v] nonland cards of each mana value v listed in maxPerCMC.
+// Lands, and mana values not listed, are unconstrained.  Each mana value's
+// cards are counted by size, capped, and the buckets multiplied together.
+func CountDecksCurveFriendly(numMain int, cards map[string]Card, format string, maxPerCMC map[int]int) *big.Int {
+	buckets := map[int][]int{}
+	free := []int{}
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if lim == 0 {
+			continue
+		}
+		if _, ok := maxPerCMC[c.CMC()]; ok && !c.IsLand() {
+			buckets[c.CMC()] = append(buckets[c.CMC()], lim)
+		} else {
+			free = append(free, lim)
+		}
+	}
+	counts := DeckCountsBySize(free, numMain)
+	for cmc, limit := range buckets {
+		capped := DeckCountsBySize(limit, numMain)
+		for k := maxPerCMC[cmc] + 1; k <= numMain; k++ {
+			capped[k].SetInt64(0)
+		}
+		counts = convolve(counts, capped)
+	}
+	return counts[numMain]
+}
+
+// CountDecksByPips counts the numMain-card decks in format whose mana costs,
+// over every copy, have exactly target[C] pips of each color C (see Pips);
+// colors not in target must have none.  It tracks every pip vector up to
+// target for every deck size, so it's only practical for targets of a few
+// dozen pips in two or three colors.
+func CountDecksByPips(numMain int, cards map[string]Card, format string, target map[string]int) *big.Int {
+	type state struct {
+		size int
+		pips [len(colors)]int
+	}
+	var goal [len(colors)]int
+	for col, n := range target {
+		i := strings.Index(colors, col)
+		if i < 0 || len(col) != 1 {
+			if n == 0 {
+				continue
+			}
+			return big.NewInt(0)
+		}
+		goal[i] = n
+	}
+	free := []int{}
+	ways := map[state]*big.Int{{}: big.NewInt(1)}
+cardLoop:
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if lim == 0 {
+			continue
+		}
+		var pips [len(colors)]int
+		for col, n := range c.Pips() {
+			i := strings.Index(colors, col)
+			if n > goal[i] {
+				continue cardLoop // Even one copy has too many.
+			}
+			pips[i] = n
+		}
+		if pips == ([len(colors)]int{}) {
+			free = append(free, lim)
+			continue
+		}
+		next := map[state]*big.Int{}
+		for st, n := range ways {
+		copyLoop:
+			for k := 0; k <= lim && st.size+k <= numMain; k++ {
+				to := state{size: st.size + k}
+				for i := range to.pips {
+					to.pips[i] = st.pips[i] + k*pips[i]
+					if to.pips[i] > goal[i] {
+						break copyLoop
+					}
+				}
+				if next[to] == nil {
+					next[to] = big.NewInt(0)
+				}
+				next[to].Add(next[to], n)
+			}
+		}
+		ways = next
+	}
+	freeCounts := DeckCountsBySize(free, numMain)
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for st, n := range ways {
+		if st.pips == goal {
+			sum.Add(sum, t.Mul(n, freeCounts[numMain-st.size]))
+		}
+	}
+	return sum
+}
+
+// convolve returns the counts by size of decks made of a deck counted by a
+// and one counted by b, up to the size of a.
+func convolve(a, b []*big.Int) []*big.Int {
+	c := make([]*big.Int, len(a))
+	t := new(big.Int)
+	for n := range c {
+		c[n] = big.NewInt(0)
+		for k := 0; k <= n && k < len(b); k++ {
+			c[n].Add(c[n], t.Mul(a[n-k], b[k]))
+		}
+	}
+	return c
+}
+
+// CountDecksAllRestricted counts the decks in format that play every
+// Restricted card (one copy each, in the main deck or the sideboard), filling
+// the remaining slots with unrestricted cards.  With R restricted cards, J of
+// them in the main deck, the copies can be placed in binomial(R, J) ways.
+func CountDecksAllRestricted(numMain, numSide int, cards map[string]Card, format string) *big.Int {
+	format = CanonicalFormat(format)
+	numRestricted := 0
+	limit := []int{}
+	for _, c := range cards {
+		if c.Legalities[format] == "Restricted" {
+			numRestricted++
+		} else if lim := c.Limit(format); lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for j := 0; j <= numRestricted; j++ {
+		if j > numMain || numRestricted-j > numSide {
+			continue
+		}
+		t.Binomial(int64(numRestricted), int64(j))
+		sum.Add(sum, t.Mul(t, CountDecks(numMain-j, numSide-(numRestricted-j), limit)))
+	}
+	return sum
+}
+
+// CountDecksWeightedByPrintings sums, over the numMain-card decks in format,
+// the product over the deck's cards of the number of distinct printings of
+// the card, once per copy.  A deck with two Opts (printed 4 times) and a Shock
+// (printed 3 times) weighs 4*4*3, the number of ways to choose a printing for
+// each card.  Cards without printings data count as printed once.
+func CountDecksWeightedByPrintings(numMain int, cards map[string]Card, format string) *big.Int {
+	counts := make([]*big.Int, numMain+1)
+	for k := range counts {
+		counts[k] = big.NewInt(0)
+	}
+	counts[0].SetInt64(1)
+	t := new(big.Int)
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if lim == 0 {
+			continue
+		}
+		p := big.NewInt(int64(len(c.Printings)))
+		if p.Sign() == 0 {
+			p.SetInt64(1)
+		}
+		// The card contributes 1 + p*x + ... + (p*x)^lim to the generating
+		// function, so next[k] = counts[k] + p*next[k-1] - p^(lim+1)*counts[k-lim-1].
+		pow := new(big.Int).Exp(p, big.NewInt(int64(lim+1)), nil)
+		next := make([]*big.Int, numMain+1)
+		for k := range next {
+			next[k] = new(big.Int).Set(counts[k])
+			if k > 0 {
+				next[k].Add(next[k], t.Mul(p, next[k-1]))
+			}
+			if k > lim {
+				next[k].Sub(next[k], t.Mul(pow, counts[k-lim-1]))
+			}
+		}
+		counts = next
+	}
+	return counts[numMain]
+}
+
+// CountDecksBySplit counts the numMain-card decks in format with exactly
+// lands lands, creatures creatures, and others other cards.  A card that's
+// both a land and a creature (like Dryad Arbor) counts as a land.  Since the
+// groups don't share cards, the count is the product of each group's count.
+func CountDecksBySplit(numMain int, cards map[string]Card, format string, lands, creatures, others int) (*big.Int, error) {
+	if lands+creatures+others != numMain {
+		return nil, fmt.Errorf("%w: %d lands + %d creatures + %d others != %d cards", ErrDeckSize, lands, creatures, others, numMain)
+	}
+	if lands < 0 || creatures < 0 || others < 0 {
+		return nil, fmt.Errorf("%w: negative split %d/%d/%d", ErrDeckSize, lands, creatures, others)
+	}
+	isCreature := func(c Card) bool { return !c.IsLand() && c.HasType("Creature") }
+	count := DeckCountsBySize(poolLimits(cards, format, Card.IsLand), lands)[lands]
+	count.Mul(count, DeckCountsBySize(poolLimits(cards, format, isCreature), creatures)[creatures])
+	isOther := func(c Card) bool { return !c.IsLand() && !isCreature(c) }
+	return count.Mul(count, DeckCountsBySize(poolLimits(cards, format, isOther), others)[others]), nil
+}
+
+// TypeRange limits the number of main deck cards of a card type, such as
+// "Land" or "Creature", to from Min to Max.
+type TypeRange struct {
+	Type     string
+	Min, Max int
+}
+
+// CountDecksByTypes counts the decks in format whose main decks have from
+// r.Min to r.Max cards of type r.Type for each r in ranges.  A card counts
+// toward the first of ranges' types it has, so with lands before creatures,
+// Dryad Arbor counts as a land, as in CountDecksBySplit.
+//
+// A range's cards, and the cards of none of the types, make up groups that
+// don't share cards, so the count is the coefficient of x^M y^S in the
+// product of the groups' tables, with each range's table cut to the rows for
+// from Min to Max main deck cards.
+func CountDecksByTypes(numMain, numSide int, cards map[string]Card, format string, ranges []TypeRange) (*big.Int, error) {
+	if numMain < 0 || numSide < 0 {
+		return nil, fmt.Errorf("%w: %d+%d", ErrDeckSize, numMain, numSide)
+	}
+	seen := map[string]bool{}
+	for _, r := range ranges {
+		switch key := strings.ToLower(r.Type); {
+		case r.Min < 0 || r.Min > r.Max:
+			return nil, fmt.Errorf("%w: %d to %d %s cards", ErrBadTypeRange, r.Min, r.Max, r.Type)
+		case seen[key]:
+			return nil, fmt.Errorf("%w: %s is limited twice", ErrBadTypeRange, r.Type)
+		default:
+			seen[key] = true
+		}
+	}
+	groups := make([][]int, len(ranges)+1) // The last is the cards of none of the types.
+	rows := make([][2]int, len(ranges))
+	for i, r := range ranges {
+		rows[i] = [2]int{r.Min, r.Max}
+	}
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if lim == 0 {
+			continue
+		}
+		g := len(ranges)
+		for i, r := range ranges {
+			if c.HasType(r.Type) {
+				g = i
+				break
+			}
+		}
+		groups[g] = append(groups[g], lim)
+	}
+	return countGroupRows(numMain, numSide, groups, rows), nil
+}
+
+// countGroupRows returns the number of decks from groups of cards that don't
+// share cards, given by their limits, with from rows[i][0] to rows[i][1] main
+// deck cards from each groups[i] that has rows; the last group is
+// unconstrained.  That's the coefficient of x^M y^S in the product of the
+// groups' tables, with the rows outside each range zeroed.
+func countGroupRows(numMain, numSide int, groups [][]int, rows [][2]int) *big.Int {
+	tables := make([][][]*big.Int, len(groups))
+	parallel(len(groups), defaults.workers, func(i int) {
+		tables[i] = limitTable(numMain, numSide, groups[i])
+	})
+	for i, r := range rows {
+		for a, row := range tables[i] {
+			if a < r[0] || a > r[1] {
+				for _, t := range row {
+					t.SetInt64(0)
+				}
+			}
+		}
+	}
+	return productAt(tables, numMain, numSide)
+}
+
+// CurveRange limits the number of nonland main deck cards with mana value
+// from Low to High, or Low and up if High is -1, to from Min to Max.
+type CurveRange struct {
+	Low, High int
+	Min, Max  int
+}
+
+// String returns r as, e.g., "1: 8-60" or "5+: 0-4".
+func (r CurveRange) String() string {
+	values := fmt.Sprintf("%d+", r.Low)
+	switch {
+	case r.High == r.Low:
+		values = strconv.Itoa(r.Low)
+	case r.High >= 0:
+		values = fmt.Sprintf("%d-%d", r.Low, r.High)
+	}
+	return fmt.Sprintf("%s: %d-%d", values, r.Min, r.Max)
+}
+
+// CountDecksByCurve counts the decks in format whose main decks have from
+// r.Min to r.Max nonland cards of mana value from r.Low to r.High, rounded
+// down, for each r in ranges.  The ranges' mana values mustn't overlap, so
+// each range's cards, and the other cards (lands among them), make up
+// groups that don't share cards, counted as for CountDecksByTypes.
+func CountDecksByCurve(numMain, numSide int, cards map[string]Card, format string, ranges []CurveRange) (*big.Int, error) {
+	if numMain < 0 || numSide < 0 {
+		return nil, fmt.Errorf("%w: %d+%d", ErrDeckSize, numMain, numSide)
+	}
+	within := func(r CurveRange, mv int) bool { return mv >= r.Low && (r.High < 0 || mv <= r.High) }
+	rows := make([][2]int, len(ranges))
+	for i, r := range ranges {
+		switch {
+		case r.Low < 0 || r.High >= 0 && r.High < r.Low:
+			return nil, fmt.Errorf("%w: mana values %d to %d", ErrBadCurveRange, r.Low, r.High)
+		case r.Min < 0 || r.Min > r.Max:
+			return nil, fmt.Errorf("%w: %d to %d cards", ErrBadCurveRange, r.Min, r.Max)
+		}
+		for _, o := range ranges[:i] {
+			if within(o, r.Low) || within(r, o.Low) {
+				return nil, fmt.Errorf("%w: %v and %v overlap", ErrBadCurveRange, o, r)
+			}
+		}
+		rows[i] = [2]int{r.Min, r.Max}
+	}
+	groups := make([][]int, len(ranges)+1) // The last is the cards of none of the ranges.
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if lim == 0 {
+			continue
+		}
+		g := len(ranges)
+		for i, r := range ranges {
+			if !c.IsLand() && within(r, c.CMC()) {
+				g = i
+			}
+		}
+		groups[g] = append(groups[g], lim)
+	}
+	return countGroupRows(numMain, numSide, groups, rows), nil
+}
+
+// limitTable returns a table whose element [M][S] is CountDecks(M, S, limit),
+// for M <= numMain and S <= numSide, as the product of its classes' factors.
+func limitTable(numMain, numSide int, limit []int) [][]*big.Int {
+	classes := LimitClasses(numMain, numSide, limit)
+	lims := []int{}
+	for lim := range classes {
+		lims = append(lims, lim)
+	}
+	sort.Ints(lims)
+	t := newTable(numMain+1, numSide+1)
+	t[0][0].SetInt64(1)
+	for i, lim := range lims {
+		p := classPower(numMain, numSide, lim, classes[lim])
+		if i == 0 {
+			t = p
+			continue
+		}
+		t = mulTables(t, p, 1)
+	}
+	return t
+}
+
+// CountDecksColorLockedSideboard counts the decks in format whose main deck
+// has exactly the color identity colors (e.g. "UR") and whose sideboard uses
+// only cards within it, so the count is at most the unconstrained count.
+// Summing over the identities T within colors, by inclusion and exclusion,
+// the decks whose main decks are within T and sideboards within colors have
+// the cards within T in either zone and the rest within colors only in the
+// sideboard.
+func CountDecksColorLockedSideboard(numMain, numSide int, cards map[string]Card, format, colors string) *big.Int {
+	letters := []string{}
+	for _, color := range colors {
+		if l := string(color); !strings.Contains(strings.Join(letters, ""), l) {
+			letters = append(letters, l)
+		}
+	}
+	inColors := func(c Card) bool { return c.withinIdentity(colors) }
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for set := 0; set < 1<<len(letters); set++ {
+		within := ""
+		for k, l := range letters {
+			if set&(1<<k) != 0 {
+				within += l
+			}
+		}
+		both := limitTable(numMain, numSide, poolLimits(cards, format, func(c Card) bool { return c.withinIdentity(within) }))
+		sideOnly := DeckCountsBySize(poolLimits(cards, format, func(c Card) bool {
+			return inColors(c) && !c.withinIdentity(within)
+		}), numSide)
+		n := new(big.Int)
+		for s := 0; s <= numSide; s++ {
+			n.Add(n, t.Mul(both[numMain][s], sideOnly[numSide-s]))
+		}
+		if (len(letters)-bits.OnesCount(uint(set)))%2 == 0 {
+			sum.Add(sum, n)
+		} else {
+			sum.Sub(sum, n)
+		}
+	}
+	return sum
+}
+
+// CountHighlanderDecks counts deckSize-card singleton decks from format's
+// pool, with no sideboard.  Basics and cards like Relentless Rats stay
+// unlimited unless singletonBasics is set, as some highlander groups play.
+func CountHighlanderDecks(cards map[string]Card, format string, deckSize int, singletonBasics bool) *big.Int {
+	limit := poolLimits(cards, format, func(Card) bool { return true })
+	for i, lim := range limit {
+		if lim < 1000 || singletonBasics {
+			limit[i] = 1
+		}
+	}
+	return CountDecks(deckSize, 0, limit)
+}
+
+// CountCanadianHighlander counts deckSize-card Canadian Highlander decks:
+// singleton decks from the Vintage card pool (basics and cards like Relentless
+// Rats are still unlimited) where the cards listed in pointValues cost points
+// and the deck's total is at most budget.
+func CountCanadianHighlander(cards map[string]Card, pointValues map[string]int, budget int, deckSize int) *big.Int {
+	limit, cost := []int{}, []int{}
+	for _, c := range cards {
+		lim := c.Limit("vintage")
+		if lim == 0 {
+			continue
+		}
+		if lim < 1000 {
+			lim = 1
+		}
+		limit = append(limit, lim)
+		cost = append(cost, pointValues[c.Name])
+	}
+	return countBudgeted(deckSize, limit, cost, budget)
+}
+
+// CountPeasantDecks counts numMain-card Peasant decks: decks from the Vintage
+// pool of cards printed at common or uncommon, with at most maxUncommons
+// copies of uncommons in total.  A negative maxUncommons allows any number.
+func CountPeasantDecks(numMain int, cards map[string]Card, maxUncommons int) *big.Int {
+	limit, uncommon := []int{}, []bool{}
+	for _, c := range cards {
+		lim := c.Limit("vintage")
+		if lim == 0 || (c.Rarity != "common" && c.Rarity != "uncommon" && !c.IsBasicLand()) {
+			continue
+		}
+		limit = append(limit, lim)
+		uncommon = append(uncommon, c.Rarity == "uncommon")
+	}
+	if maxUncommons < 0 {
+		return DeckCountsBySize(limit, numMain)[numMain]
+	}
+	return countCapped(numMain, limit, func(i, copies int) int {
+		if uncommon[i] {
+			return copies
+		}
+		return 0
+	}, maxUncommons)
+}
+
+// CountDecksMaxTotalCMC counts the numMain-card decks in format whose total
+// mana value, summed over every copy, is at most maxCMC.
+func CountDecksMaxTotalCMC(numMain int, cards map[string]Card, format string, maxCMC int) *big.Int {
+	limit, cmc := []int{}, []int{}
+	for _, c := range cards {
+		if lim := c.Limit(format); lim > 0 {
+			limit = append(limit, lim)
+			cmc = append(cmc, c.CMC())
+		}
+	}
+	return countBudgeted(numMain, limit, cmc, maxCMC)
+}
+
+// CountDecksPowerBudget counts the numMain-card decks in format whose total
+// power, summing power[name] over every copy, is at most budget.  Cards
+// without a rating have no power.
+func CountDecksPowerBudget(numMain int, cards map[string]Card, format string, power map[string]int, budget int) *big.Int {
+	limit, cost := []int{}, []int{}
+	for _, c := range cards {
+		if lim := c.Limit(format); lim > 0 {
+			limit = append(limit, lim)
+			cost = append(cost, power[c.Name])
+		}
+	}
+	return countBudgeted(numMain, limit, cost, budget)
+}
+
+// ReadPowerRatings reads a CSV file of card names and their nonnegative
+// power ratings, like "Sol Ring,9", for CountDecksPowerBudget.
+func ReadPowerRatings(r io.Reader) (map[string]int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.Comment = '#'
+	power := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return power, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		n, err := strconv.Atoi(strings.TrimSpace(rec[1]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("line %d: want a nonnegative power rating for %s; got %q", line, rec[0], rec[1])
+		}
+		power[strings.TrimSpace(rec[0])] = n
+	}
+}
+
+// countBudgeted returns the number of numMain-card decks drawn from limit,
+// where each copy of card I costs cost[I] and the deck's total cost must be
+// at most budget.
+func countBudgeted(numMain int, limit, cost []int, budget int) *big.Int {
+	return countCapped(numMain, limit, func(i, copies int) int { return copies * cost[i] }, budget)
+}
+
+// countCapped returns the number of numMain-card decks drawn from limit where
+// the sum over cards I of weight(I, copies of I) is at most capacity.  weight
+// must be nondecreasing in copies and 0 for no copies.  Cards that weigh
+// nothing even at their limit are counted together by DeckCountsBySize; the
+// others are tracked by (size, weight) and combined with them at the end.
+// No deck weighs less than nothing, so a negative capacity counts none.
+func countCapped(numMain int, limit []int, weight func(i, copies int) int, capacity int) *big.Int {
+	if capacity < 0 {
+		return big.NewInt(0)
+	}
+	free := []int{}
+	ways := newTable(numMain+1, capacity+1) // ways[s][w]: decks of s weighted cards weighing w.
+	ways[0][0].SetInt64(1)
+	for i, lim := range limit {
+		if weight(i, lim) == 0 {
+			free = append(free, lim)
+			continue
+		}
+		next := newTable(numMain+1, capacity+1)
+		for s, row := range ways {
+			for w, n := range row {
+				if n.Sign() == 0 {
+					continue
+				}
+				for k := 0; k <= lim && s+k <= numMain; k++ {
+					wk := w + weight(i, k)
+					if wk > capacity {
+						break
+					}
+					next[s+k][wk].Add(next[s+k][wk], n)
+				}
+			}
+		}
+		ways = next
+	}
+	freeCounts := DeckCountsBySize(free, numMain)
+	sum := big.NewInt(0)
+	t := new(big.Int)
+	for s, row := range ways {
+		for _, n := range row {
+			sum.Add(sum, t.Mul(n, freeCounts[numMain-s]))
+		}
+	}
+	return sum
+}
+
+// mulTables returns the product of two generating functions, as tables of
+// coefficients, up to their size, computing up to workers rows at once.
+func mulTables(a, b [][]*big.Int, workers int) [][]*big.Int {
+	c := newTable(len(a), len(a[0]))
+	parallel(len(c), workers, func(m int) {
+		t := new(big.Int)
+		for s := range c[m] {
+			for i := 0; i <= m; i++ {
+				for j := 0; j <= s; j++ {
+					c[m][s].Add(c[m][s], t.Mul(a[i][j], b[m-i][s-j]))
+				}
+			}
+		}
+	})
+	return c
+}
+
+// productCoefficient returns the coefficient of x^m y^s in the product of a
+// and b, without the rest of the product.
+func productCoefficient(a, b [][]*big.Int, m, s, workers int) *big.Int {
+	rows := make([]*big.Int, m+1)
+	parallel(m+1, workers, func(i int) {
+		rows[i] = new(big.Int)
+		t := new(big.Int)
+		for j := 0; j <= s; j++ {
+			rows[i].Add(rows[i], t.Mul(a[i][j], b[m-i][s-j]))
+		}
+	})
+	sum := new(big.Int)
+	for _, r := range rows {
+		sum.Add(sum, r)
+	}
+	return sum
+}
+
+// newTable returns a rows x cols table of zeros.
+func newTable(rows, cols int) [][]*big.Int {
+	t := make([][]*big.Int, rows)
+	for i := range t {
+		t[i] = make([]*big.Int, cols)
+		for j := range t[i] {
+			t[i][j] = big.NewInt(0)
+		}
+	}
+	return t
+}
+
+// Override sets the legality status of the card called Name in Format, or,
+// if Format is empty, in every format in which the card has a status.
+type Override struct {
+	Format string `json:"format,omitempty"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// overrideVerbs are the statuses set by each verb of a plain text override
+// file.
+var overrideVerbs = map[string]string{"ban": "Banned", "restrict": "Restricted", "unban": "Legal"}
+
+// ParseOverrides reads an override file.  A JSON file is an array of
+// Override.  A plain text file has one override per line, a verb (ban,
+// restrict, or unban) and a card name, optionally after a format and a colon:
+//
+//	# Modern, if Twin came back
+//	modern: unban Splinter Twin
+//	ban Oko, Thief of Crowns
+//
+// Blank lines and lines starting with "#" are ignored.  Errors match
+// ErrBadOverride.
+func ParseOverrides(data []byte) ([]Override, error) {
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] == '[' {
+		var overrides []Override
+		if err := json.Unmarshal(t, &overrides); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadOverride, err)
+		}
+		for i, o := range overrides {
+			if !knownStatuses[o.Status] || o.Name == "" {
+				return nil, fmt.Errorf("%w: entry %d: want a name and a status of Legal, Restricted, or Banned; got %+v", ErrBadOverride, i, o)
+			}
+		}
+		return overrides, nil
+	}
+	var overrides []Override
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		o, ok := parseOverride(line)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: want \"[format:] ban|restrict|unban <card name>\"; got %q", ErrBadOverride, n, line)
+		}
+		overrides = append(overrides, o)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// parseOverride parses one line of a plain text override file.
+func parseOverride(line string) (Override, bool) {
+	var o Override
+	fields := strings.SplitN(line, " ", 2)
+	if strings.HasSuffix(fields[0], ":") && len(fields) == 2 {
+		o.Format = strings.TrimSuffix(fields[0], ":")
+		fields = strings.SplitN(strings.TrimSpace(fields[1]), " ", 2)
+	}
+	status, ok := overrideVerbs[strings.ToLower(fields[0])]
+	if !ok || len(fields) < 2 {
+		return Override{}, false
+	}
+	o.Name, o.Status = strings.TrimSpace(fields[1]), status
+	return o, true
+}
+
+// ApplyOverrides returns a copy of cards with overrides applied, in order,
+// leaving cards unchanged.  It's an error, matching ErrBadOverride, for an
+// override to name a card that isn't in cards.
+func ApplyOverrides(cards map[string]Card, overrides []Override) (map[string]Card, error) {
+	out := make(map[string]Card, len(cards))
+	for name, c := range cards {
+		out[name] = c
+	}
+	copied := map[string]bool{}
+	for _, o := range overrides {
+		c, ok := out[o.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", ErrBadOverride, o.Name)
+		}
+		if !copied[o.Name] {
+			legalities := make(map[string]string, len(c.Legalities)+1)
+			for f, status := range c.Legalities {
+				legalities[f] = status
+			}
+			c.Legalities = legalities
+			copied[o.Name] = true
+		}
+		if o.Format != "" {
+			c.Legalities[CanonicalFormat(o.Format)] = o.Status
+		} else {
+			for f := range c.Legalities {
+				c.Legalities[f] = o.Status
+			}
+		}
+		out[o.Name] = c
+	}
+	return out, nil
+}
+
+// A BanChange is an entry in a banlist history: from Date (YYYY-MM-DD) on,
+// the Override holds.
+type BanChange struct {
+	Date string `json:"date"`
+	Override
+}
+
+// BanHistory is a timeline of banlist changes, and of set releases, from
+// which AsOf reconstructs past legalities.
+type BanHistory struct {
+	Changes  []BanChange       `json:"changes"`
+	Releases map[string]string `json:"releases,omitempty"` // Set code to release date.
+}
+
+// ParseBanHistory reads a banlist history.  A JSON file is a BanHistory.  A
+// plain text file has one entry per line, a date and then either a line of an
+// override file or "release" and a set code:
+//
+//	2015-01-19 modern: ban Birthing Pod
+//	2015-03-27 release DTK
+//
+// Blank lines and lines starting with "#" are ignored.  Errors match
+// ErrBadOverride.
+func ParseBanHistory(data []byte) (BanHistory, error) {
+	var h BanHistory
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] == '{' {
+		if err := json.Unmarshal(t, &h); err != nil {
+			return BanHistory{}, fmt.Errorf("%w: %v", ErrBadOverride, err)
+		}
+		if err := h.check(); err != nil {
+			return BanHistory{}, err
+		}
+		return h, nil
+	}
+	h.Releases = map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 3 && strings.EqualFold(fields[1], "release") {
+			h.Releases[strings.ToUpper(fields[2])] = fields[0]
+			continue
+		}
+		date := fields[0]
+		o, ok := parseOverride(strings.TrimSpace(strings.TrimPrefix(line, date)))
+		if !ok {
+			return BanHistory{}, fmt.Errorf("%w: line %d: want \"<date> [format:] ban|restrict|unban <card name>\" or \"<date> release <set>\"; got %q", ErrBadOverride, n, line)
+		}
+		h.Changes = append(h.Changes, BanChange{date, o})
+	}
+	if err := scanner.Err(); err != nil {
+		return BanHistory{}, err
+	}
+	if err := h.check(); err != nil {
+		return BanHistory{}, err
+	}
+	return h, nil
+}
+
+// check reports the first bad date or change in h.
+func (h BanHistory) check() error {
+	for set, date := range h.Releases {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("%w: release of %s: %v", ErrBadOverride, set, err)
+		}
+	}
+	for _, c := range h.Changes {
+		if _, err := time.Parse("2006-01-02", c.Date); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrBadOverride, c.Name, err)
+		}
+		if !knownStatuses[c.Status] || c.Name == "" {
+			return fmt.Errorf("%w: want a name and a status of Legal, Restricted, or Banned; got %+v", ErrBadOverride, c)
+		}
+	}
+	return nil
+}
+
+// AsOf returns a copy of cards with the legalities they had on date
+// (YYYY-MM-DD), according to h.  A card's status in a format is the one set by
+// its latest change on or before date.  Before its first change, a card is
+// taken to have been Legal, or Banned if that change unbans it; cards with no
+// changes keep their current status.  Cards printed only in sets that h says
+// were released after date are left out.  Cards from sets h doesn't know are
+// kept, so the reconstruction is only as good as h's list of releases.
+func (h BanHistory) AsOf(cards map[string]Card, date string) (map[string]Card, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, err
+	}
+	changes := append([]BanChange(nil), h.Changes...)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Date < changes[j].Date })
+	byCard := map[string][]BanChange{}
+	for _, c := range changes {
+		if _, ok := cards[c.Name]; !ok {
+			return nil, fmt.Errorf("%w: unknown card %q", ErrBadOverride, c.Name)
+		}
+		byCard[c.Name] = append(byCard[c.Name], c)
+	}
+	out := make(map[string]Card, len(cards))
+	for name, c := range cards {
+		if !h.printedBy(c, date) {
+			continue
+		}
+		if history := byCard[name]; history != nil {
+			c.Legalities = statusesAsOf(c.Legalities, history, date)
+		}
+		out[name] = c
+	}
+	return out, nil
+}
+
+// printedBy reports whether c had been printed by date, as far as h knows.
+func (h BanHistory) printedBy(c Card, date string) bool {
+	for _, set := range c.Printings {
+		if released, ok := h.Releases[set]; !ok || released <= date {
+			return true
+		}
+	}
+	return len(c.Printings) == 0
+}
+
+// statusesAsOf returns the statuses in legalities as of date, given the
+// card's changes in date order.
+func statusesAsOf(legalities map[string]string, history []BanChange, date string) map[string]string {
+	out := make(map[string]string, len(legalities))
+	for f, status := range legalities {
+		out[f] = status
+	}
+	for f := range legalities {
+		first := ""
+		var last *BanChange
+		for i, c := range history {
+			if c.Format != "" && CanonicalFormat(c.Format) != f {
+				continue
+			}
+			if first == "" {
+				first = c.Status
+			}
+			if c.Date <= date {
+				last = &history[i]
+			}
+		}
+		switch {
+		case last != nil:
+			out[f] = last.Status
+		case first == "Legal":
+			out[f] = "Banned"
+		case first != "":
+			out[f] = "Legal"
+		}
+	}
+	return out
+}
+
+// Deck is a decklist: the number of copies of each card name in the main deck
+// and in the sideboard, and the sideboard card declared as its companion, if
+// any.
+type Deck struct {
+	Main      map[string]int
+	Side      map[string]int
+	Companion string
+}
+
+// ParseDeck reads a decklist with one line per card, like "4 Lightning Bolt".
+// Cards after a line reading "Sideboard" (or lines starting "SB:") go in the
+// sideboard, as does the card after a line reading "Companion", which becomes
+// the deck's companion; a line reading "Deck" goes back to the main deck, as
+// in Arena's exports.  Blank lines and lines starting with "//" are ignored.
+// Errors match ErrBadDecklist.
+func ParseDeck(r io.Reader) (Deck, error) {
+	deck := Deck{Main: map[string]int{}, Side: map[string]int{}}
+	zone := deck.Main
+	inCompanion := false
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		switch header := strings.ToLower(strings.TrimSuffix(line, ":")); header {
+		case "sideboard", "companion":
+			zone, inCompanion = deck.Side, header == "companion"
+			continue
+		case "deck":
+			zone, inCompanion = deck.Main, false
+			continue
+		}
+		z := zone
+		if strings.HasPrefix(line, "SB:") {
+			z = deck.Side
+			line = strings.TrimSpace(line[len("SB:"):])
+		}
+		fields := strings.SplitN(line, " ", 2)
+		copies, err := strconv.Atoi(strings.TrimSuffix(fields[0], "x"))
+		if err != nil || len(fields) < 2 || copies <= 0 {
+			return Deck{}, fmt.Errorf("%w: line %d: want \"<copies> <card name>\"; got %q", ErrBadDecklist, n, line)
+		}
+		name := strings.TrimSpace(fields[1])
+		z[name] += copies
+		if inCompanion {
+			if deck.Companion != "" && deck.Companion != name {
+				return Deck{}, fmt.Errorf("%w: line %d: a second companion, %s", ErrBadDecklist, n, name)
+			}
+			deck.Companion = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Deck{}, err
+	}
+	return deck, nil
+}
+
+// The deck sizes allowed in constructed formats.
+const (
+	minMainDeck  = 60
+	maxSideboard = 15
+)
+
+// ValidationReport lists the reasons a deck isn't legal in a format.
+type ValidationReport struct {
+	Format string
+	Issues []DeckIssue // Empty if the deck is legal.
+}
+
+// DeckIssue is one problem with a deck.  Have and Max are numbers of copies
+// of Card, or for a deck-size issue (with no Card), numbers of cards; for a
+// main deck that's too small, Max is the minimum.
+type DeckIssue struct {
+	Card   string `json:"card,omitempty"`
+	Have   int    `json:"have"`
+	Max    int    `json:"max"`
+	Reason string `json:"reason"`
+}
+
+func (r ValidationReport) MarshalJSON() ([]byte, error) {
+	issues := r.Issues
+	if issues == nil {
+		issues = []DeckIssue{}
+	}
+	return json.Marshal(struct {
+		Format string      `json:"format"`
+		Legal  bool        `json:"legal"`
+		Issues []DeckIssue `json:"issues"`
+	}{r.Format, len(r.Issues) == 0, issues})
+}
+
+// ValidateJSON checks deck against format's rules: at least 60 main deck
+// cards, at most 15 in the sideboard, each card within its limit across both,
+// and a main deck that keeps to the restriction of deck's companion, if it
+// has one.  Deck-size issues come first, then card issues by name, then
+// companion issues, as for companionIssues.
+func ValidateJSON(deck Deck, cards map[string]Card, format string) ValidationReport {
+	r := ValidationReport{Format: CanonicalFormat(format)}
+	minMain := minMainDeck
+	if comp, ok := companions[deck.Companion]; ok {
+		minMain += comp.extraMain
+	}
+	numMain, numSide := 0, 0
+	copies := map[string]int{}
+	for name, n := range deck.Main {
+		numMain += n
+		copies[name] += n
+	}
+	for name, n := range deck.Side {
+		numSide += n
+		copies[name] += n
+	}
+	if numMain < minMain {
+		r.Issues = append(r.Issues, DeckIssue{Have: numMain, Max: minMain, Reason: fmt.Sprintf("main deck has fewer than %d cards", minMain)})
+	}
+	if numSide > maxSideboard {
+		r.Issues = append(r.Issues, DeckIssue{Have: numSide, Max: maxSideboard, Reason: "sideboard has more than 15 cards"})
+	}
+	names := []string{}
+	for name := range copies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c, ok := cards[name]
+		if !ok {
+			r.Issues = append(r.Issues, DeckIssue{Card: name, Have: copies[name], Reason: "unknown card"})
+			continue
+		}
+		max := c.Limit(format)
+		if copies[name] <= max {
+			continue
+		}
+		reason := "too many copies"
+		switch status := c.Legalities[r.Format]; {
+		case status == "Banned" || status == "Restricted" || status == "Suspended":
+			reason = strings.ToLower(status)
+		case max == 0:
+			// Including rebalanced cards outside digital formats, and
+			// statuses whose limit is 0.
+			reason = "not legal"
+		}
+		r.Issues = append(r.Issues, DeckIssue{Card: name, Have: copies[name], Max: max, Reason: reason})
+	}
+	r.Issues = append(r.Issues, companionIssues(deck, cards)...)
+	return r
+}
+
+// CountSideboards counts the numSide-card sideboards that can go with the
+// main deck of deck, drawn from the cards in limit, each reduced by the copies
+// already in the main deck.  limit names the cards, as NamedLimits does,
+// since a plain limit vector can't say which entry a main-deck card uses;
+// CountSideboardLimits takes plain vectors.  It's an error, matching
+// ErrBadDecklist, if the main deck has a card that isn't in limit or more
+// copies of one than its limit.
+func CountSideboards(deck Deck, numSide int, limit []NamedLimit) (*big.Int, error) {
+	index := map[string]int{}
+	lims := make([]int, len(limit))
+	for i, nl := range limit {
+		index[nl.Name] = i
+		lims[i] = nl.Limit
+	}
+	main := make([]int, len(limit))
+	for name, n := range deck.Main {
+		i, ok := index[name]
+		switch {
+		case n <= 0:
+			continue
+		case !ok:
+			return nil, fmt.Errorf("%w: %s isn't legal", ErrBadDecklist, name)
+		case n > lims[i]:
+			return nil, fmt.Errorf("%w: %d copies of %s; its limit is %d", ErrBadDecklist, n, name, lims[i])
+		}
+		main[i] = n
+	}
+	return CountSideboardLimits(main, numSide, lims)
+}
+
+// CountSideboardLimits is CountSideboards for a main deck with main[I] copies
+// of card I, whose limit is limit[I].  It's an error if the two aren't the
+// same length, or if a main deck card is over its limit.
+func CountSideboardLimits(main []int, numSide int, limit []int) (*big.Int, error) {
+	if len(main) != len(limit) {
+		return nil, fmt.Errorf("%w: %d main deck counts and %d limits", ErrBadLimits, len(main), len(limit))
+	}
+	left := []int{}
+	for i, lim := range limit {
+		if main[i] > lim {
+			return nil, fmt.Errorf("%w: %d copies of card %d; its limit is %d", ErrBadDecklist, main[i], i, lim)
+		}
+		if lim -= main[i]; lim > 0 {
+			left = append(left, lim)
+		}
+	}
+	return CountDecks(0, numSide, left), nil
+}
+
+// AverageCMC returns the mean mana value of the nonland cards in deck's main
+// deck, counting each copy, or 0 if it has none.  Cards not in cards are
+// left out too.
+func AverageCMC(deck Deck, cards map[string]Card) float64 {
+	total, n := 0.0, 0
+	for name, copies := range deck.Main {
+		c, ok := cards[name]
+		if !ok || c.IsLand() {
+			continue
+		}
+		total += float64(copies) * c.ConvertedManaCost
+		n += copies
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// ParseCollection reads a list of owned cards in the format ParseDeck reads,
+// returning the number of copies owned of each card.  A "Sideboard" section
+// is allowed, and counts like the rest.
+func ParseCollection(r io.Reader) (map[string]int, error) {
+	deck, err := ParseDeck(r)
+	if err != nil {
+		return nil, err
+	}
+	owned := deck.Main
+	for name, n := range deck.Side {
+		owned[name] += n
+	}
+	return owned, nil
+}
+
+// CountDecksFromCollection counts the decks in format that can be built from
+// the owned cards, allowing each card the smaller of its limit and the
+// number owned.  Basic lands are unlimited unless owned lists them.
+func CountDecksFromCollection(numMain, numSide int, cards map[string]Card, format string, owned map[string]int) *big.Int {
+	limit := []int{}
+	for _, c := range cards {
+		lim := c.Limit(format)
+		if n, ok := owned[c.Name]; ok || !c.IsBasicLand() {
+			if n < lim {
+				lim = n
+			}
+		}
+		if lim > 0 {
+			limit = append(limit, lim)
+		}
+	}
+	return CountDecks(numMain, numSide, limit)
+}
+
+// Sampler draws decks uniformly at random from those counted by
+// CountDecks(numMain, numSide, L) for the limits L of some named cards, so
+// that each of those decks is equally likely.  It does so by numbering the
+// decks from 0 (see RankDeck) and drawing a number.  It keeps the tables it
+// works from between decks, so it isn't safe for concurrent use.
+type Sampler struct {
+	numMain, numSide int
+	lims             []int
+	names            [][]string         // The cards with each limit in lims.
+	index            map[string]cardRef // Where each card is in names.
+	powers, prefix   [][][]*big.Int     // G_j and P_j; see RankDeck.
+	splits           [][][][]*big.Int   // Each class's h_k, once needed.
+}
+
+// cardRef is the place of a card in Sampler.names.
+type cardRef struct {
+	class, i int
+}
+
+// NewSampler returns a Sampler of the decks of numMain and numSide cards
+// from named.  It returns ErrNoDecks if there are none.
+func NewSampler(numMain, numSide int, named []NamedLimit) (*Sampler, error) {
+	if numMain < 0 || numSide < 0 {
+		return nil, fmt.Errorf("%w: %d+%d", ErrDeckSize, numMain, numSide)
+	}
+	byLimit := map[int][]string{}
+	for _, nl := range named {
+		lim := nl.Limit
+		if lim > numMain+numSide {
+			lim = numMain + numSide
+		}
+		if lim > 0 {
+			byLimit[lim] = append(byLimit[lim], nl.Name)
+		}
+	}
+	sp := &Sampler{numMain: numMain, numSide: numSide, index: map[string]cardRef{}}
+	for lim := range byLimit {
+		sp.lims = append(sp.lims, lim)
+	}
+	sort.Ints(sp.lims)
+	for j, lim := range sp.lims {
+		sp.names = append(sp.names, byLimit[lim])
+		for i, name := range byLimit[lim] {
+			sp.index[name] = cardRef{j, i}
+		}
+	}
+	workers := defaults.workers
+	sp.powers = make([][][]*big.Int, len(sp.lims))
+	sp.splits = make([][][][]*big.Int, len(sp.lims))
+	parallel(len(sp.lims), workers, func(i int) {
+		sp.powers[i] = classPower(numMain, numSide, sp.lims[i], len(sp.names[i]))
+	})
+	sp.prefix = [][][]*big.Int{newTable(numMain+1, numSide+1)}
+	sp.prefix[0][0][0].SetInt64(1)
+	for i, p := range sp.powers {
+		if i > 0 {
+			p = mulTables(sp.prefix[i], p, workers)
+		}
+		sp.prefix = append(sp.prefix, p)
+	}
+	if sp.Count().Sign() == 0 {
+		return nil, fmt.Errorf("%w of %d+%d cards among %d", ErrNoDecks, numMain, numSide, len(named))
+	}
+	return sp, nil
+}
+
+// Count returns the number of decks sp draws from.
+func (sp *Sampler) Count() *big.Int {
+	return new(big.Int).Set(sp.prefix[len(sp.lims)][sp.numMain][sp.numSide])
+}
+
+// Sample returns a deck, using rng for its choices.
+func (sp *Sampler) Sample(rng *rand.Rand) Deck {
+	deck, err := sp.UnrankDeck(new(big.Int).Rand(rng, sp.Count()))
+	if err != nil {
+		panic(err)
+	}
+	return deck
+}
+
+// RankDeck returns the number of deck among sp's decks, from 0 to Count()-1.
+// It returns ErrNotCounted if deck isn't one of them.
+//
+// The numbering follows the tables CountDecksByClass multiplies.  With P_j
+// the product of the first j classes' factors G_i, the decks with class j's
+// share of (m, s) cards are numbered in order of the share (a, b) of the
+// last class, each share's block holding P_j[m-a][s-b] * G_j[a][b] decks;
+// within a block, the rest of the deck's number is the major digit and the
+// class's own (see classRank) the minor.
+func (sp *Sampler) RankDeck(deck Deck) (*big.Int, error) {
+	// split returns each class's copies of its cards in zone, by their
+	// place in sp.names, and the zone's size.
+	split := func(zone map[string]int) ([]map[int]int, int, error) {
+		shares := make([]map[int]int, len(sp.lims))
+		for j := range shares {
+			shares[j] = map[int]int{}
+		}
+		total := 0
+		for name, n := range zone {
+			ref, ok := sp.index[name]
+			if n < 0 || n > 0 && !ok {
+				return nil, 0, fmt.Errorf("%w: %d %s", ErrNotCounted, n, name)
+			}
+			if n > 0 {
+				shares[ref.class][ref.i] = n
+				total += n
+			}
+		}
+		return shares, total, nil
+	}
+	main, numMain, err := split(deck.Main)
+	if err != nil {
+		return nil, err
+	}
+	side, numSide, err := split(deck.Side)
+	if err != nil {
+		return nil, err
+	}
+	if numMain != sp.numMain || numSide != sp.numSide {
+		return nil, fmt.Errorf("%w: it has %d+%d cards; want %d+%d", ErrNotCounted, numMain, numSide, sp.numMain, sp.numSide)
+	}
+	rank := new(big.Int)
+	m, s := 0, 0
+	t := new(big.Int)
+	for j := range sp.lims {
+		r, a, b, err := sp.classRank(j, main[j], side[j])
+		if err != nil {
+			return nil, err
+		}
+		m, s = m+a, s+b
+		rank.Mul(rank, sp.powers[j][a][b])
+		rank.Add(rank, r)
+		rank.Add(rank, blockStart(a, b, s, func(a, b int) *big.Int {
+			return t.Mul(sp.prefix[j][m-a][s-b], sp.powers[j][a][b])
+		}))
+	}
+	return rank, nil
+}
+
+// UnrankDeck returns the deck RankDeck numbers n.  It returns ErrRank if n
+// isn't from 0 to Count()-1.
+func (sp *Sampler) UnrankDeck(n *big.Int) (Deck, error) {
+	if n.Sign() < 0 || n.Cmp(sp.Count()) >= 0 {
+		return Deck{}, fmt.Errorf("%w: %v of %v decks", ErrRank, n, sp.Count())
+	}
+	deck := Deck{Main: map[string]int{}, Side: map[string]int{}}
+	r := new(big.Int).Set(n)
+	m, s := sp.numMain, sp.numSide
+	t, rc := new(big.Int), new(big.Int)
+	for j := len(sp.lims) - 1; j >= 0; j-- {
+		a, b := block(r, m, s, func(a, b int) *big.Int {
+			return t.Mul(sp.prefix[j][m-a][s-b], sp.powers[j][a][b])
+		})
+		r.QuoRem(r, sp.powers[j][a][b], rc)
+		sp.classUnrank(deck, j, a, b, rc)
+		m, s = m-a, s-b
+	}
+	return deck, nil
+}
+
+// DeckIterator goes through a Sampler's decks in the order of their
+// numbers (see RankDeck), from 0, making each as it gets to it.  For example,
+// to page through the decks numbered 1000 to 1009:
+//
+//	it := sp.Decks()
+//	it.Skip(big.NewInt(1000))
+//	for i := 0; i < 10; i++ {
+//		deck, ok := it.Next()
+//		if !ok {
+//			break
+//		}
+//		...
+//	}
+type DeckIterator struct {
+	sp   *Sampler
+	next *big.Int
+}
+
+// Decks returns an iterator over sp's decks.
+func (sp *Sampler) Decks() *DeckIterator {
+	return &DeckIterator{sp, new(big.Int)}
+}
+
+// Next returns the next deck, or false once there are no more.
+func (it *DeckIterator) Next() (Deck, bool) {
+	deck, err := it.sp.UnrankDeck(it.next)
+	if err != nil {
+		return Deck{}, false
+	}
+	it.next.Add(it.next, big.NewInt(1))
+	return deck, true
+}
+
+// Skip passes over the next n decks without making them, or goes back -n
+// decks, but not past the first, if n is negative.
+func (it *DeckIterator) Skip(n *big.Int) {
+	it.next.Add(it.next, n)
+	if it.next.Sign() < 0 {
+		it.next.SetInt64(0)
+	}
+}
+
+// Rank returns the number of the deck Next returns next.
+func (it *DeckIterator) Rank() *big.Int {
+	return new(big.Int).Set(it.next)
+}
+
+// block finds the (a, b), with a <= maxA and b <= maxB in order, whose block
+// of size(a, b) numbers holds r, and leaves in r its place in the block.
+func block(r *big.Int, maxA, maxB int, size func(a, b int) *big.Int) (int, int) {
+	for a := 0; a <= maxA; a++ {
+		for b := 0; b <= maxB; b++ {
+			n := size(a, b)
+			if r.Cmp(n) < 0 {
+				return a, b
+			}
+			r.Sub(r, n)
+		}
+	}
+	panic("deckcount: blocks add up to less than their total")
+}
+
+// blockStart returns the first number in the block of (a, b), where block
+// finds them: the sum of the blocks before it.
+func blockStart(a, b, maxB int, size func(a, b int) *big.Int) *big.Int {
+	start := new(big.Int)
+	for a2 := 0; a2 <= a; a2++ {
+		for b2 := 0; b2 <= maxB && (a2 < a || b2 < b); b2++ {
+			start.Add(start, size(a2, b2))
+		}
+	}
+	return start
+}
+
+// classTables returns class j's h_k (see classRank), making them if need be.
+func (sp *Sampler) classTables(j int) [][][]*big.Int {
+	if sp.splits[j] == nil {
+		sp.splits[j] = splitTables(sp.numMain, sp.numSide, sp.lims[j], len(sp.names[j]))
+	}
+	return sp.splits[j]
+}
+
+// classRank returns the number of class j's share of a deck, given as the
+// copies of its cards, by their place in sp.names[j], in the main deck and
+// sideboard, and the share's size (a, b).
+//
+// With h_k[m][s] the number of sequences of k nonzero (a, b), each with a+b
+// <= lim, that add up to (m, s), a share of (m, s) that uses exactly k of the
+// n cards can be made C(n, k) * h_k[m][s] ways.  The shares are numbered by
+// k, then by which k cards (in the combinatorial number system), then by the
+// sequence of the cards' copies, from the last card back.
+func (sp *Sampler) classRank(j int, main, side map[int]int) (*big.Int, int, int, error) {
+	lim, h := sp.lims[j], sp.classTables(j)
+	used := map[int]bool{}
+	numMain, numSide := 0, 0
+	for i, n := range main {
+		used[i] = true
+		numMain += n
+	}
+	for i, n := range side {
+		used[i] = true
+		numSide += n
+	}
+	chosen := []int{}
+	for i := range used {
+		if main[i]+side[i] > lim {
+			return nil, 0, 0, fmt.Errorf("%w: %d copies of %s; the limit is %d", ErrNotCounted, main[i]+side[i], sp.names[j][i], lim)
+		}
+		chosen = append(chosen, i)
+	}
+	sort.Ints(chosen)
+	k, n := len(chosen), int64(len(sp.names[j]))
+	rank := new(big.Int)
+	for k2 := 0; k2 < k; k2++ {
+		rank.Add(rank, new(big.Int).Mul(new(big.Int).Binomial(n, int64(k2)), h[k2][numMain][numSide]))
+	}
+	comb := new(big.Int)
+	for i, c := range chosen {
+		comb.Add(comb, new(big.Int).Binomial(int64(c), int64(i+1)))
+	}
+	rank.Add(rank, comb.Mul(comb, h[k][numMain][numSide]))
+	m, s := numMain, numSide
+	zero := new(big.Int)
+	for i := k; i > 0; i-- {
+		a, b := main[chosen[i-1]], side[chosen[i-1]]
+		rank.Add(rank, blockStart(a, b, s, func(a, b int) *big.Int {
+			if a+b == 0 || a+b > lim {
+				return zero
+			}
+			return h[i-1][m-a][s-b]
+		}))
+		m, s = m-a, s-b
+	}
+	return rank, numMain, numSide, nil
+}
+
+// classUnrank adds to deck the share of class j, of numMain main deck and
+// numSide sideboard cards, that classRank numbers r.
+func (sp *Sampler) classUnrank(deck Deck, j, numMain, numSide int, r *big.Int) {
+	names, lim, h := sp.names[j], sp.lims[j], sp.classTables(j)
+	maxK := len(h) - 1
+	if maxK > numMain+numSide {
+		maxK = numMain + numSide
+	}
+	n := int64(len(names))
+	t := new(big.Int)
+	k, _ := block(r, maxK, 0, func(k, _ int) *big.Int {
+		return t.Mul(t.Binomial(n, int64(k)), h[k][numMain][numSide])
+	})
+	comb := new(big.Int)
+	r.QuoRem(r, h[k][numMain][numSide], comb)
+	r, comb = comb, r
+	// The combination: the largest c with C(c, i) <= comb, for i from k down.
+	chosen := make([]int, k)
+	hi := int(n)
+	for i := k; i > 0; i-- {
+		lo := i - 1 // C(i-1, i) = 0 <= comb
+		for lo+1 < hi {
+			mid := (lo + hi) / 2
+			if t.Binomial(int64(mid), int64(i)).Cmp(comb) <= 0 {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		chosen[i-1] = lo
+		comb.Sub(comb, t.Binomial(int64(lo), int64(i)))
+		hi = lo
+	}
+	m, s := numMain, numSide
+	zero := new(big.Int)
+	for i := k; i > 0; i-- {
+		a, b := block(r, m, s, func(a, b int) *big.Int {
+			if a+b == 0 || a+b > lim {
+				return zero
+			}
+			return h[i-1][m-a][s-b]
+		})
+		name := names[chosen[i-1]]
+		if a > 0 {
+			deck.Main[name] = a
+		}
+		if b > 0 {
+			deck.Side[name] = b
+		}
+		m, s = m-a, s-b
+	}
+}
+
+// splitTables returns classRank's h_k for k up to the smaller of n and
+// numMain+numSide: h_k = h_(k-1) * (f - 1), where gfStep multiplies by f.
+func splitTables(numMain, numSide, lim, n int) [][][]*big.Int {
+	maxK := numMain + numSide
+	if maxK > n {
+		maxK = n
+	}
+	h := [][][]*big.Int{newTable(numMain+1, numSide+1)}
+	h[0][0][0].SetInt64(1)
+	diag := newTable(numMain+1, numSide+1)
+	for k := 1; k <= maxK; k++ {
+		next := newTable(numMain+1, numSide+1)
+		gfStep(next, h[k-1], diag, lim)
+		for m := range next {
+			for s := range next[m] {
+				next[m][s].Sub(next[m][s], h[k-1][m][s])
+			}
+		}
+		h = append(h, next)
+	}
+	return h
+}
+
+// landStation are the basic lands a limited event gives players as many of
+// as they want.
+var landStation = []string{"Plains", "Island", "Swamp", "Mountain", "Forest"}
+
+// CountSealedDecks counts the numMain-card limited decks that can be built
+// from pool, the copies of each card opened, and any number of the basic
+// lands in landStation.  In limited, the cards not in the main deck are the
+// sideboard, so only main decks are counted, and formats' legalities don't
+// apply.  The cards in pool are found in cards as by FindCard.
+func CountSealedDecks(numMain int, cards map[string]Card, pool map[string]int) (*big.Int, error) {
+	if numMain < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrDeckSize, numMain)
+	}
+	copies := map[string]int{}
+	for name, n := range pool {
+		c, err := FindCard(cards, name)
+		if err != nil {
+			return nil, err
+		}
+		copies[c.Name] += n
+	}
+	for _, name := range landStation {
+		copies[name] = numMain
+	}
+	limit := []int{}
+	for _, n := range copies {
+		limit = append(limit, n)
+	}
+	return CountDecks(numMain, 0, limit), nil
+}
+
+// ShuffleDeck returns the main deck as a slice with one entry per copy, in an
+// order determined entirely by rng.
+func ShuffleDeck(deck Deck, rng *rand.Rand) []string {
+	names := []string{}
+	for name := range deck.Main {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cards := []string{}
+	for _, name := range names {
+		for i := 0; i < deck.Main[name]; i++ {
+			cards = append(cards, name)
+		}
+	}
+	rng.Shuffle(len(cards), func(i, j int) { cards[i], cards[j] = cards[j], cards[i] })
+	return cards
+}
+
+// Draw splits cards into the first n (or all of them, if there are fewer than
+// n) and the rest.  Neither result shares memory with cards.
+func Draw(cards []string, n int) (hand, rest []string) {
+	if n > len(cards) {
+		n = len(cards)
+	}
+	if n < 0 {
+		n = 0
+	}
+	hand = append([]string{}, cards[:n]...)
+	rest = append([]string{}, cards[n:]...)
+	return hand, rest
+}
+
+// GoldfishTurns estimates the average turn on which every card in needed is
+// in hand, drawing an opening hand of 7 on turn 1 and one more card on each
+// later turn.  A name listed twice in needed requires two copies.  If deck
+// doesn't contain enough copies of the needed cards, GoldfishTurns returns
+// +Inf, and otherwise, with no trials, it has no estimate and returns 0.
+// Its shuffles come from a source seeded with goldfishSeed, never from the
+// global source, so every call with the same arguments gives the same
+// estimate; GoldfishTurnsRand takes the caller's source.
+func GoldfishTurns(deck Deck, needed []string, trials int) float64 {
+	return GoldfishTurnsRand(deck, needed, trials, rand.New(rand.NewSource(goldfishSeed)))
+}
+
+// goldfishSeed seeds GoldfishTurns' shuffles.
+const goldfishSeed = 1
+
+// GoldfishTurnsRand is GoldfishTurns with the shuffles from rng, so a given
+// seed gives the same estimate.
+func GoldfishTurnsRand(deck Deck, needed []string, trials int, rng *rand.Rand) float64 {
+	want := map[string]int{}
+	for _, name := range needed {
+		want[name]++
+	}
+	for name, n := range want {
+		if deck.Main[name] < n {
+			return math.Inf(1)
+		}
+	}
+	total := 0
+	for i := 0; i < trials; i++ {
+		hand, library := Draw(ShuffleDeck(deck, rng), 7)
+		missing := len(needed)
+		have := map[string]int{}
+		see := func(name string) {
+			if have[name] < want[name] {
+				missing--
+			}
+			have[name]++
+		}
+		for _, name := range hand {
+			see(name)
+		}
+		turn := 1
+		for ; missing > 0; turn++ {
+			see(library[0])
+			library = library[1:]
+		}
+		total += turn
+	}
+	if trials <= 0 {
+		return 0
+	}
+	return float64(total) / float64(trials)
+}
@@ -0,0 +1,3007 @@
+package deckcount
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var sampleJSON = []byte(`{
+	"Llanowar Elves": {
+		"name": "Llanowar Elves",
+		"type": "Creature — Elf Druid",
+		"text": "{T}: Add {G}.",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	},
+	"Thalia, Guardian of Thraben": {
+		"name": "Thalia, Guardian of Thraben",
+		"type": "Legendary Creature — Human Soldier",
+		"supertypes": ["Legendary"],
+		"keywords": ["First strike"],
+		"text": "First strike\nNoncreature spells cost {1} more to cast.",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	},
+	"Island": {
+		"name": "Island",
+		"type": "Basic Land — Island",
+		"supertypes": ["Basic"],
+		"text": "({T}: Add {U}.)",
+		"legalities": {"modern": "Legal", "legacy": "Legal"}
+	}
+}`)
+
+func TestParseCards(t *testing.T) {
+	cards, err := ParseCards(sampleJSON)
+	if err != nil {
+		t.Fatalf("ParseCards: %v", err)
+	}
+	if len(cards) != 3 {
+		t.Fatalf("ParseCards: got %d cards; want 3", len(cards))
+	}
+	thalia := cards["Thalia, Guardian of Thraben"]
+	if thalia.Text != "First strike\nNoncreature spells cost {1} more to cast." {
+		t.Errorf("Thalia text=%q", thalia.Text)
+	}
+	if len(thalia.Supertypes) != 1 || thalia.Supertypes[0] != "Legendary" {
+		t.Errorf("Thalia supertypes=%v; want [Legendary]", thalia.Supertypes)
+	}
+}
+
+func TestIsLegendary(t *testing.T) {
+	cases := []struct {
+		in   Card
+		want bool
+	}{
+		{Card{Type: "Creature — Elf Druid"}, false},
+		{Card{Type: "Legendary Creature — Human Soldier", Supertypes: []string{"Legendary"}}, true},
+		{Card{Type: "Legendary Creature — Human Soldier"}, true},
+		{Card{Type: "Basic Land — Island", Supertypes: []string{"Basic"}}, false},
+		{Card{Type: "Snow Legendary Land"}, true},
+	}
+	for _, c := range cases {
+		got := c.in.IsLegendary()
+		if got != c.want {
+			t.Errorf("(%q).IsLegendary()=%v; want %v", c.in.Type, got, c.want)
+		}
+	}
+}
+
+func TestIsBasicLand(t *testing.T) {
+	cases := []struct {
+		in   Card
+		want bool
+	}{
+		{Card{Type: "Basic Land — Island"}, true},
+		{Card{Type: "Basic Land — Island", Supertypes: []string{"Basic"}, Types: []string{"Land"}}, true},
+		{Card{Type: "Basic Land", Supertypes: []string{"Basic"}, Types: []string{"Land"}}, true}, // Wastes
+		{Card{Type: "Basic Land"}, true},
+		{Card{Type: "Basic Snow Land — Island", Supertypes: []string{"Basic", "Snow"}, Types: []string{"Land"}}, true},
+		{Card{Type: "Basic Snow Land — Island"}, true},
+		{Card{Type: "Snow Basic Land — Forest"}, true},
+		{Card{Type: "Land Básica Nevada — Ilha", Supertypes: []string{"Basic", "Snow"}, Types: []string{"Land"}}, true},
+		{Card{Type: "Snow Land", Supertypes: []string{"Snow"}, Types: []string{"Land"}}, false},
+		{Card{Type: "Land Creature — Forest Dryad", Types: []string{"Land", "Creature"}}, false},
+		{Card{Type: "Legendary Land", Supertypes: []string{"Legendary"}}, false},
+		{Card{Type: "Creature — Basic Lands Fan"}, false},
+	}
+	for _, c := range cases {
+		got := c.in.IsBasicLand()
+		if got != c.want {
+			t.Errorf("(%q).IsBasicLand()=%v; want %v", c.in.Type, got, c.want)
+		}
+	}
+	snow := Card{Name: "Snow-Covered Island", Type: "Basic Snow Land — Island", Supertypes: []string{"Basic", "Snow"}, Legalities: map[string]string{"modern": "Legal"}}
+	if got := snow.Limit("modern"); got != 1000 {
+		t.Errorf("Snow-Covered Island Limit(modern)=%d; want 1000", got)
+	}
+}
+
+func TestHasKeyword(t *testing.T) {
+	card := Card{Keywords: []string{"First strike", "Partner"}}
+	cases := []struct {
+		kw   string
+		want bool
+	}{
+		{"Partner", true},
+		{"partner", true},
+		{"First strike", true},
+		{"Flying", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		got := card.HasKeyword(c.kw)
+		if got != c.want {
+			t.Errorf("HasKeyword(%q)=%v; want %v", c.kw, got, c.want)
+		}
+	}
+}
+
+func TestCountTribalDecks(t *testing.T) {
+	cards := map[string]Card{
+		"Llanowar Elves":   {Name: "Llanowar Elves", Type: "Creature — Elf Druid"},
+		"Elvish Mystic":    {Name: "Elvish Mystic", Type: "Creature — Elf Druid"},
+		"Grizzly Bears":    {Name: "Grizzly Bears", Type: "Creature — Bear"},
+		"Shapesharer":      {Name: "Shapesharer", Type: "Creature — Shapeshifter", Keywords: []string{"Changeling"}},
+		"Forest":           {Name: "Forest", Type: "Basic Land — Forest"},
+		"Elvish Visionary": {Name: "Elvish Visionary", Type: "Creature — Elf Shaman"},
+	}
+	for name, c := range cards {
+		c.Legalities = map[string]string{"modern": "Legal"}
+		cards[name] = c
+	}
+	// The Elf pool is 3 Elves and a changeling (limit 4 each) plus Forest.
+	want := CountDecks(10, 2, []int{4, 4, 4, 4, 1000})
+	got := CountTribalDecks(10, 2, cards, "modern", "Elf")
+	if got.Cmp(want) != 0 {
+		t.Errorf("CountTribalDecks(Elf)=%v; want %v", got, want)
+	}
+	// A Bear deck only has Grizzly Bears, the changeling, and Forest.
+	want = CountDecks(10, 2, []int{4, 4, 1000})
+	got = CountTribalDecks(10, 2, cards, "modern", "Bear")
+	if got.Cmp(want) != 0 {
+		t.Errorf("CountTribalDecks(Bear)=%v; want %v", got, want)
+	}
+	// Nothing is legal in a format the cards don't list.
+	got = CountTribalDecks(10, 2, cards, "standard", "Elf")
+	if got.Sign() != 0 {
+		t.Errorf("CountTribalDecks(standard)=%v; want 0", got)
+	}
+}
+
+func TestShuffleDeck(t *testing.T) {
+	deck := Deck{Main: map[string]int{"Island": 3, "Opt": 2, "Counterspell": 1}}
+	a := ShuffleDeck(deck, rand.New(rand.NewSource(1)))
+	b := ShuffleDeck(deck, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("ShuffleDeck with the same seed: %v != %v", a, b)
+	}
+	counts := map[string]int{}
+	for _, name := range a {
+		counts[name]++
+	}
+	if !reflect.DeepEqual(counts, deck.Main) {
+		t.Errorf("ShuffleDeck(%v) has counts %v", deck.Main, counts)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	cases := []struct {
+		cards      []string
+		n          int
+		hand, rest []string
+	}{
+		{[]string{"a", "b", "c"}, 2, []string{"a", "b"}, []string{"c"}},
+		{[]string{"a", "b", "c"}, 0, []string{}, []string{"a", "b", "c"}},
+		{[]string{"a", "b", "c"}, 5, []string{"a", "b", "c"}, []string{}},
+		{[]string{}, 1, []string{}, []string{}},
+	}
+	for _, c := range cases {
+		hand, rest := Draw(c.cards, c.n)
+		if !reflect.DeepEqual(hand, c.hand) || !reflect.DeepEqual(rest, c.rest) {
+			t.Errorf("Draw(%v, %d)=%v, %v; want %v, %v", c.cards, c.n, hand, rest, c.hand, c.rest)
+		}
+	}
+}
+
+func TestGoldfishTurns(t *testing.T) {
+	// With one copy of the combo piece in 60 cards, it's at position p
+	// (uniform over 1..60) and is in hand on turn 1 if p <= 7, or on turn p-6
+	// otherwise: (7 + 2+3+...+54) / 60 = 24.85.
+	rng := rand.New(rand.NewSource(1))
+	deck := Deck{Main: map[string]int{"Combo": 1, "Island": 59}}
+	got := GoldfishTurnsRand(deck, []string{"Combo"}, 10000, rng)
+	if math.Abs(got-24.85) > 0.5 {
+		t.Errorf("GoldfishTurnsRand(1 of 60)=%v; want about 24.85", got)
+	}
+	// An opening hand from a deck of Islands always has two of them.
+	deck = Deck{Main: map[string]int{"Island": 60}}
+	if got := GoldfishTurnsRand(deck, []string{"Island", "Island"}, 100, rng); got != 1 {
+		t.Errorf("GoldfishTurnsRand(all Islands)=%v; want 1", got)
+	}
+	if got := GoldfishTurnsRand(deck, []string{"Combo"}, 100, rng); !math.IsInf(got, 1) {
+		t.Errorf("GoldfishTurnsRand(missing card)=%v; want +Inf", got)
+	}
+	deck = Deck{Main: map[string]int{"Combo": 1, "Island": 59}}
+	if got := GoldfishTurnsRand(deck, []string{"Combo", "Combo"}, 100, rng); !math.IsInf(got, 1) {
+		t.Errorf("GoldfishTurnsRand(too few copies)=%v; want +Inf", got)
+	}
+	// The same seed gives the same estimate.
+	deck = Deck{Main: map[string]int{"Combo": 4, "Island": 56}}
+	a := GoldfishTurnsRand(deck, []string{"Combo"}, 100, rand.New(rand.NewSource(7)))
+	b := GoldfishTurnsRand(deck, []string{"Combo"}, 100, rand.New(rand.NewSource(7)))
+	if a != b {
+		t.Errorf("GoldfishTurnsRand with seed 7 gave %v, then %v", a, b)
+	}
+	if got, want := GoldfishTurns(deck, []string{"Combo"}, 100), GoldfishTurnsRand(deck, []string{"Combo"}, 100, rand.New(rand.NewSource(goldfishSeed))); got != want {
+		t.Errorf("GoldfishTurns(4 of 60)=%v; want GoldfishTurnsRand's %v with goldfishSeed", got, want)
+	}
+	if got := GoldfishTurns(deck, []string{"Combo"}, 0); got != 0 {
+		t.Errorf("GoldfishTurns(0 trials)=%v; want 0", got)
+	}
+}
+
+func TestDeckCountsBySize(t *testing.T) {
+	limit := []int{1, 2, 3, 4, 1000}
+	got := DeckCountsBySize(limit, 12)
+	if len(got) != 13 {
+		t.Fatalf("DeckCountsBySize(%v, 12) has %d sizes; want 13", limit, len(got))
+	}
+	for size, c := range got {
+		if want := CountDecks(size, 0, limit); c.Cmp(want) != 0 {
+			t.Errorf("DeckCountsBySize(%v)[%d]=%v; want %v", limit, size, c, want)
+		}
+	}
+}
+
+func TestParseCardsErrors(t *testing.T) {
+	array, err := ioutil.ReadFile("testdata/array.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{array, "expected a JSON object of cards; got an array — did you pass AllPrintings instead of AllCards?"},
+		{[]byte(`"Island"`), "expected a JSON object of cards; got Island"},
+		{[]byte(``), "EOF"},
+	}
+	for _, c := range cases {
+		_, err := ParseCards(c.in)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("ParseCards(%.20q) error=%v; want %q", c.in, err, c.want)
+		}
+	}
+}
+
+func TestCountHighlanderDecks(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":          {Name: "Opt", Legalities: legal},
+		"Counterspell": {Name: "Counterspell", Legalities: map[string]string{"modern": "Banned"}},
+		"Mana Leak":    {Name: "Mana Leak", Legalities: legal},
+		"Island":       {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Mountain":     {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: legal},
+	}
+	cases := []struct {
+		singletonBasics bool
+		want            int64
+	}{
+		// 3 cards from Opt and Mana Leak (0, 1, or 2 of them) plus basics:
+		// 4 + 2*3 + 2 = 12.
+		{false, 12},
+		// 3 of the 4 singletons.
+		{true, 4},
+	}
+	for _, c := range cases {
+		got := CountHighlanderDecks(cards, "modern", 3, c.singletonBasics)
+		if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountHighlanderDecks(singletonBasics=%v)=%v; want %d", c.singletonBasics, got, c.want)
+		}
+	}
+}
+
+func TestCountDecksUnion(t *testing.T) {
+	cards := map[string]Card{
+		"Opt":              {Name: "Opt", Legalities: map[string]string{"modern": "Legal", "pioneer": "Legal"}},
+		"Lightning Bolt":   {Name: "Lightning Bolt", Legalities: map[string]string{"modern": "Legal"}},
+		"Oko":              {Name: "Oko", Legalities: map[string]string{"modern": "Banned", "vintage": "Restricted"}},
+		"Ancestral Recall": {Name: "Ancestral Recall", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Island":           {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"modern": "Legal", "pioneer": "Legal"}},
+	}
+	cases := []struct {
+		a, b  string
+		limit []int
+	}{
+		{"modern", "pioneer", []int{4, 4, 1000}},
+		{"pioneer", "modern", []int{4, 4, 1000}},
+		// Oko is banned in Modern but restricted in Vintage.
+		{"modern", "vintage", []int{4, 4, 1, 1, 1000}},
+	}
+	for _, c := range cases {
+		want := CountDecks(6, 2, c.limit)
+		if got := CountDecksUnion(6, 2, cards, c.a, c.b); got.Cmp(want) != 0 {
+			t.Errorf("CountDecksUnion(%s, %s)=%v; want %v", c.a, c.b, got, want)
+		}
+	}
+}
+
+func TestCountDecksIntersection(t *testing.T) {
+	cards := map[string]Card{
+		"Opt":              {Name: "Opt", Legalities: map[string]string{"standard": "Legal", "pioneer": "Legal"}},
+		"Once Upon a Time": {Name: "Once Upon a Time", Legalities: map[string]string{"standard": "Banned", "pioneer": "Legal"}},
+		"Sol Ring":         {Name: "Sol Ring", Legalities: map[string]string{"standard": "Legal", "pioneer": "Restricted"}},
+		"Island":           {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"standard": "Legal", "pioneer": "Legal"}},
+	}
+	got := CountDecksIntersection(6, 2, cards, "standard", "pioneer")
+	if want := CountDecks(6, 2, []int{4, 1, 1000}); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksIntersection(standard, pioneer)=%v; want %v", got, want)
+	}
+	// Once Upon a Time drops out, so there are fewer decks than in either
+	// format alone.
+	for _, f := range []string{"standard", "pioneer"} {
+		if alone := CountDecks(6, 2, poolLimits(cards, f, func(Card) bool { return true })); got.Cmp(alone) >= 0 {
+			t.Errorf("CountDecksIntersection(standard, pioneer)=%v; want fewer than %s's %v", got, f, alone)
+		}
+	}
+}
+
+func TestCountDecksMaxColors(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":             {Name: "Opt", Legalities: legal, ColorIdentity: []string{"U"}},
+		"Lightning Bolt":  {Name: "Lightning Bolt", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Izzet Charm":     {Name: "Izzet Charm", Legalities: legal, ColorIdentity: []string{"U", "R"}},
+		"Lightning Helix": {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Ornithopter":     {Name: "Ornithopter", Legalities: legal},
+	}
+	// The pool, in order: Opt, Bolt, Charm, Helix, Ornithopter.
+	limit := []int{4, 4, 4, 4, 4}
+	identities := []string{"U", "R", "UR", "RW", ""}
+	for _, max := range []int{0, 1, 2, 3} {
+		want := bruteForce(5, limit, func(copies []int) bool {
+			used := map[rune]bool{}
+			for i, k := range copies {
+				if k > 0 {
+					for _, col := range identities[i] {
+						used[col] = true
+					}
+				}
+			}
+			return len(used) <= max
+		})
+		got := CountDecksMaxColors(5, cards, "modern", max)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksMaxColors(%d)=%v; want %d", max, got, want)
+		}
+	}
+}
+
+func TestCountDecksByIdentity(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":             {Name: "Opt", Legalities: legal, ColorIdentity: []string{"U"}},
+		"Lightning Bolt":  {Name: "Lightning Bolt", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Izzet Charm":     {Name: "Izzet Charm", Legalities: legal, ColorIdentity: []string{"U", "R"}},
+		"Lightning Helix": {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Ornithopter":     {Name: "Ornithopter", Legalities: legal},
+	}
+	// The pool, in order: Opt, Bolt, Charm, Helix, Ornithopter.
+	limit := []int{4, 4, 4, 4, 4}
+	identities := []string{"U", "R", "UR", "WR", ""}
+	// Four Ornithopters aren't a deck, so there are no colorless decks.
+	got := CountDecksByIdentity(5, 0, cards, "modern")
+	for _, identity := range []string{"", "U", "R", "WR", "UR", "WUR"} {
+		want := bruteForce(5, limit, func(copies []int) bool {
+			used := ""
+			for _, col := range colors {
+				for i, k := range copies {
+					if k > 0 && strings.ContainsRune(identities[i], col) {
+						used += string(col)
+						break
+					}
+				}
+			}
+			return used == identity
+		})
+		if c, ok := got[identity]; ok != (want > 0) || ok && c.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksByIdentity()[%q]=%v, %v; want %d", identity, c, ok, want)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf("CountDecksByIdentity() has %d identities; want 5: %v", len(got), got)
+	}
+	// With a sideboard, the identities still share out all the decks.
+	sum := new(big.Int)
+	for _, c := range CountDecksByIdentity(5, 3, cards, "modern") {
+		sum.Add(sum, c)
+	}
+	if want := CountDecks(5, 3, limit); sum.Cmp(want) != 0 {
+		t.Errorf("CountDecksByIdentity(5, 3) adds up to %v; want %v", sum, want)
+	}
+	if within := WithinIdentity(cards, "R"); len(within) != 2 || within["Lightning Bolt"].Name == "" || within["Ornithopter"].Name == "" {
+		t.Errorf("WithinIdentity(R)=%v; want Lightning Bolt and Ornithopter", within)
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	cases := []struct {
+		s, want string
+	}{
+		{"rw", "WR"},
+		{"GWU", "WUG"},
+		{"Boros", "WR"},
+		{"mono-red", "R"},
+		{"Mono-Black", "B"},
+		{"esper", "WUB"},
+		{"C", ""},
+		{"colorless", ""},
+		{"wubrg", "WUBRG"},
+	}
+	for _, c := range cases {
+		if got, err := ParseIdentity(c.s); err != nil || got != c.want {
+			t.Errorf("ParseIdentity(%q)=%q, %v; want %q", c.s, got, err, c.want)
+		}
+	}
+	for _, s := range []string{"", "rr", "rx", "purple"} {
+		if got, err := ParseIdentity(s); !errors.Is(err, ErrBadIdentity) {
+			t.Errorf("ParseIdentity(%q)=%q, %v; want ErrBadIdentity", s, got, err)
+		}
+	}
+}
+
+func TestCountDecksIncluding(t *testing.T) {
+	legal := map[string]string{"standard": "Legal"}
+	cards := map[string]Card{
+		"Lightning Strike": {Name: "Lightning Strike", Legalities: legal},
+		"Shock":            {Name: "Shock", Legalities: legal},
+		"Fire // Ice":      {Name: "Fire // Ice", Legalities: legal},
+		"Mountain":         {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: legal},
+		"Lightning Bolt":   {Name: "Lightning Bolt", Legalities: map[string]string{"standard": "Banned"}},
+	}
+	// The pool, in order: Lightning Strike, Shock, Fire // Ice, Mountain.
+	limit := []int{4, 4, 4, 1000}
+	cases := []struct {
+		include map[string]int
+		atLeast []int
+	}{
+		{map[string]int{"Lightning Strike": 4}, []int{4, 0, 0, 0}},
+		{map[string]int{"lightning strike": 2, "Fire": 1}, []int{2, 0, 1, 0}},
+		{map[string]int{"Shock": 1, "Mountain": 3}, []int{0, 1, 0, 3}},
+		{map[string]int{}, []int{0, 0, 0, 0}},
+	}
+	for _, c := range cases {
+		want := int64(0)
+		EnumerateDecks(6, 2, limit, func(main, side []int) {
+			for i, n := range c.atLeast {
+				if main[i] < n {
+					return
+				}
+			}
+			want++
+		})
+		got, err := CountDecksIncluding(6, 2, cards, "standard", c.include)
+		if err != nil || got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksIncluding(%v)=%v, %v; want %d", c.include, got, err, want)
+		}
+	}
+	for _, include := range []map[string]int{
+		{"Lightning Helix": 1},
+		{"Lightning Bolt": 1},
+		{"Shock": 5},
+		{"Shock": 0},
+		{"Shock": 3, "shock": 2},
+		{"Mountain": 7},
+	} {
+		if got, err := CountDecksIncluding(6, 2, cards, "standard", include); err == nil {
+			t.Errorf("CountDecksIncluding(%v)=%v; want an error", include, got)
+		}
+	}
+}
+
+func TestFindCard(t *testing.T) {
+	cards := map[string]Card{
+		"Fire // Ice":      {Name: "Fire // Ice"},
+		"Lightning Strike": {Name: "Lightning Strike"},
+		"Opt":              {Name: "Opt"},
+		"OPT":              {Name: "OPT"},
+	}
+	for name, want := range map[string]string{"Opt": "Opt", "OPT": "OPT", "LIGHTNING STRIKE": "Lightning Strike", "fire": "Fire // Ice", "fire // ice": "Fire // Ice"} {
+		if c, err := FindCard(cards, name); err != nil || c.Name != want {
+			t.Errorf("FindCard(%q)=%q, %v; want %q", name, c.Name, err, want)
+		}
+	}
+	for _, name := range []string{"opt", "Ice", "Bolt"} {
+		if c, err := FindCard(cards, name); !errors.Is(err, ErrBadDecklist) {
+			t.Errorf("FindCard(%q)=%q, %v; want ErrBadDecklist", name, c.Name, err)
+		}
+	}
+}
+
+func TestCountDecksForcingRestricted(t *testing.T) {
+	cards := map[string]Card{
+		"Black Lotus": {Name: "Black Lotus", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Opt":         {Name: "Opt", Legalities: map[string]string{"vintage": "Legal"}},
+		"Island":      {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"vintage": "Legal"}},
+	}
+	// Decks with Black Lotus are all decks minus those without it.
+	all := CountDecks(6, 2, []int{1, 4, 1000})
+	want := all.Sub(all, CountDecks(6, 2, []int{4, 1000}))
+	got, err := CountDecksForcingRestricted(6, 2, cards, "vintage", "Black Lotus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(want) != 0 {
+		t.Errorf("CountDecksForcingRestricted(Black Lotus)=%v; want %v", got, want)
+	}
+	if _, err := CountDecksForcingRestricted(6, 2, cards, "vintage", "Opt"); !errors.Is(err, ErrNotRestricted) {
+		t.Errorf("CountDecksForcingRestricted(Opt) error %v; want ErrNotRestricted", err)
+	}
+	if _, err := CountDecksForcingRestricted(6, 2, cards, "vintage", "Mox Pearl"); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("CountDecksForcingRestricted(Mox Pearl) error %v; want ErrBadDecklist", err)
+	}
+}
+
+func TestCountBlockDecks(t *testing.T) {
+	cards := map[string]Card{
+		"Wrath of God":    {Name: "Wrath of God", Printings: []string{"LEA", "10E"}},
+		"Lightning Helix": {Name: "Lightning Helix", Printings: []string{"RAV", "MM2"}},
+		"Boros Signet":    {Name: "Boros Signet", Printings: []string{"RAV"}},
+		"Dark Confidant":  {Name: "Dark Confidant", Printings: []string{"RAV"}},
+		"Boros Reckoner":  {Name: "Boros Reckoner", Printings: []string{"GTC"}},
+		"Tarmogoyf":       {Name: "Tarmogoyf", Printings: []string{"FUT"}},
+		"Plains":          {Name: "Plains", Type: "Basic Land — Plains", Printings: []string{"LEA"}},
+	}
+	cases := []struct {
+		sets  []string
+		limit []int
+	}{
+		{[]string{"RAV"}, []int{4, 4, 4, 1000}},
+		{[]string{"RAV", "GPT", "DIS"}, []int{4, 4, 4, 1000}},
+		{[]string{"RTR", "GTC", "DGM"}, []int{4, 1000}},
+		{[]string{}, []int{1000}},
+	}
+	for _, c := range cases {
+		want := CountDecks(6, 2, c.limit)
+		if got := CountBlockDecks(cards, c.sets, 6, 2); got.Cmp(want) != 0 {
+			t.Errorf("CountBlockDecks(%v)=%v; want %v", c.sets, got, want)
+		}
+	}
+}
+
+func TestCountOldSchoolDecks(t *testing.T) {
+	cards := map[string]Card{
+		"Black Lotus":           {Name: "Black Lotus", Printings: []string{"LEA", "LEB", "2ED"}},
+		"Library of Alexandria": {Name: "Library of Alexandria", Printings: []string{"ARN"}},
+		"Chaos Orb":             {Name: "Chaos Orb", Printings: []string{"LEA", "LEB", "2ED"}},
+		"Hypnotic Specter":      {Name: "Hypnotic Specter", Printings: []string{"LEA", "4ED"}},
+		"Necropotence":          {Name: "Necropotence", Printings: []string{"ICE"}},
+		"Swamp":                 {Name: "Swamp", Type: "Basic Land — Swamp", Printings: []string{"LEA"}},
+	}
+	cases := []struct {
+		restricted, banned []string
+		limit              []int
+	}{
+		{nil, nil, []int{4, 4, 4, 4, 1000}},
+		{[]string{"Black Lotus", "Library of Alexandria"}, nil, []int{1, 1, 4, 4, 1000}},
+		// Necropotence is from Ice Age, so restricting it changes nothing.
+		{[]string{"Black Lotus", "Library of Alexandria", "Necropotence"}, []string{"Chaos Orb"}, []int{1, 1, 4, 1000}},
+	}
+	for _, c := range cases {
+		want := CountDecks(6, 2, c.limit)
+		if got := CountOldSchoolDecks(cards, c.restricted, c.banned, 6, 2); got.Cmp(want) != 0 {
+			t.Errorf("CountOldSchoolDecks(restricted=%v, banned=%v)=%v; want %v", c.restricted, c.banned, got, want)
+		}
+	}
+}
+
+func TestCountProjectedStandard(t *testing.T) {
+	legal := map[string]string{"standard": "Legal", "modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":               {Name: "Opt", Legalities: legal, Printings: []string{"INV", "DOM", "ELD"}},
+		"Shivan Fire":       {Name: "Shivan Fire", Legalities: legal, Printings: []string{"DOM"}},
+		"Once Upon a Time":  {Name: "Once Upon a Time", Legalities: map[string]string{"standard": "Banned"}, Printings: []string{"ELD"}},
+		"Bonecrusher Giant": {Name: "Bonecrusher Giant", Legalities: legal, Printings: []string{"ELD"}},
+		"Lightning Bolt":    {Name: "Lightning Bolt", Legalities: map[string]string{"modern": "Legal"}, Printings: []string{"LEA", "M11", "INV"}},
+		"Lurrus":            {Name: "Lurrus", Printings: []string{"IKO"}},
+		"Island":            {Name: "Island", Type: "Basic Land — Island", Legalities: legal, Printings: []string{"LEA", "DOM", "ELD"}},
+	}
+	if got, want := standardSets(cards), map[string]bool{"DOM": true, "ELD": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("standardSets=%v; want %v", got, want)
+	}
+	cases := []struct {
+		out, in []string
+		limit   []int
+	}{
+		{nil, nil, []int{4, 4, 4, 1000}},
+		// Opt survives Dominaria's rotation through its Eldraine printing.
+		{[]string{"DOM"}, nil, []int{4, 4, 1000}},
+		{[]string{"DOM"}, []string{"IKO"}, []int{4, 4, 4, 1000}},
+		{[]string{"DOM", "ELD"}, nil, []int{1000}},
+	}
+	for _, c := range cases {
+		want := CountDecks(6, 2, c.limit)
+		got := CountProjectedStandard(6, 2, cards, c.out, c.in)
+		if got.Cmp(want) != 0 {
+			t.Errorf("CountProjectedStandard(out=%v, in=%v)=%v; want %v", c.out, c.in, got, want)
+		}
+	}
+	now := CountProjectedStandard(6, 2, cards, nil, nil)
+	if rotated := CountProjectedStandard(6, 2, cards, []string{"DOM"}, nil); rotated.Cmp(now) >= 0 {
+		t.Errorf("rotating out Dominaria left %v decks; want fewer than %v", rotated, now)
+	}
+}
+
+func TestCountCanadianHighlander(t *testing.T) {
+	cards := map[string]Card{
+		"Ancestral Recall": {Name: "Ancestral Recall", Type: "Instant", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Sol Ring":         {Name: "Sol Ring", Type: "Artifact", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Opt":              {Name: "Opt", Type: "Instant", Legalities: map[string]string{"vintage": "Legal"}},
+		"Brainstorm":       {Name: "Brainstorm", Type: "Instant", Legalities: map[string]string{"vintage": "Legal"}},
+		"Island":           {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"vintage": "Legal"}},
+		"Oko":              {Name: "Oko", Type: "Legendary Planeswalker — Oko", Legalities: map[string]string{"vintage": "Banned"}},
+	}
+	points := map[string]int{"Ancestral Recall": 3, "Sol Ring": 2}
+	cases := []struct {
+		budget int
+		want   int64
+	}{
+		// 3-card decks from 4 singletons and Island: 1 + 4 + 6 + 4 = 15.
+		{5, 15},
+		// Running both pointed cards costs 5, which rules out the 3 decks
+		// that have both (plus Opt, Brainstorm, or an Island).
+		{4, 12},
+		// Neither pointed card: 3 cards from Opt, Brainstorm, and Islands.
+		{1, 4},
+		// No deck fits a negative budget.
+		{-1, 0},
+	}
+	for _, c := range cases {
+		got := CountCanadianHighlander(cards, points, c.budget, 3)
+		if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountCanadianHighlander(budget=%d)=%v; want %d", c.budget, got, c.want)
+		}
+	}
+}
+
+func TestCountDecksMaxTotalCMC(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":             {Name: "Opt", Legalities: legal, ConvertedManaCost: 1},
+		"Counterspell":    {Name: "Counterspell", Legalities: legal, ConvertedManaCost: 2},
+		"Fact or Fiction": {Name: "Fact or Fiction", Legalities: legal, ConvertedManaCost: 4},
+		"Island":          {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	limit, cmc := []int{4, 4, 4, 1000}, []int{1, 2, 4, 0}
+	for _, max := range []int{0, 3, 8, 40} {
+		want := bruteForce(8, limit, func(copies []int) bool {
+			total := 0
+			for i, k := range copies {
+				total += k * cmc[i]
+			}
+			return total <= max
+		})
+		got := CountDecksMaxTotalCMC(8, cards, "modern", max)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksMaxTotalCMC(%d)=%v; want %d", max, got, want)
+		}
+	}
+	if got := CountDecksMaxTotalCMC(8, cards, "modern", -1); got.Sign() != 0 {
+		t.Errorf("CountDecksMaxTotalCMC(-1)=%v; want 0", got)
+	}
+}
+
+func TestCountPeasantDecks(t *testing.T) {
+	legal := map[string]string{"vintage": "Legal"}
+	cards := map[string]Card{
+		"Counterspell":    {Name: "Counterspell", Legalities: legal, Rarity: "common"},
+		"Opt":             {Name: "Opt", Legalities: legal, Rarity: "common"},
+		"Fact or Fiction": {Name: "Fact or Fiction", Legalities: legal, Rarity: "uncommon"},
+		"Mana Leak":       {Name: "Mana Leak", Legalities: legal, Rarity: "uncommon"},
+		"Force of Will":   {Name: "Force of Will", Legalities: legal, Rarity: "rare"},
+		"Island":          {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	// The pool, in order: two commons, two uncommons, and Island.
+	limit := []int{4, 4, 4, 4, 1000}
+	for _, max := range []int{-1, 0, 3, 5} {
+		want := bruteForce(6, limit, func(copies []int) bool {
+			return max < 0 || copies[2]+copies[3] <= max
+		})
+		got := CountPeasantDecks(6, cards, max)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountPeasantDecks(%d)=%v; want %d", max, got, want)
+		}
+	}
+}
+
+func TestCountDecksCurveFriendly(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":             {Name: "Opt", Legalities: legal, ConvertedManaCost: 1},
+		"Spell Pierce":    {Name: "Spell Pierce", Legalities: legal, ConvertedManaCost: 1},
+		"Counterspell":    {Name: "Counterspell", Legalities: legal, ConvertedManaCost: 2},
+		"Mana Leak":       {Name: "Mana Leak", Legalities: legal, ConvertedManaCost: 2},
+		"Fact or Fiction": {Name: "Fact or Fiction", Legalities: legal, ConvertedManaCost: 4},
+		"Island":          {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	// The pool, in order: two 1s, two 2s, a 4, and Island.
+	limit := []int{4, 4, 4, 4, 4, 1000}
+	cases := []map[int]int{
+		{},
+		{1: 3, 2: 2},
+		{1: 0, 2: 8},
+		{0: 0, 4: 1},
+	}
+	for _, caps := range cases {
+		want := bruteForce(8, limit, func(copies []int) bool {
+			n := map[int]int{1: copies[0] + copies[1], 2: copies[2] + copies[3], 4: copies[4]}
+			for cmc, max := range caps {
+				if n[cmc] > max {
+					return false
+				}
+			}
+			return true
+		})
+		got := CountDecksCurveFriendly(8, cards, "modern", caps)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksCurveFriendly(%v)=%v; want %d", caps, got, want)
+		}
+	}
+}
+
+func TestPips(t *testing.T) {
+	cases := []struct {
+		cost string
+		want map[string]int
+	}{
+		{"", map[string]int{}},
+		{"{1}{U}{U}", map[string]int{"U": 2}},
+		{"{W}{U}{B}{R}{G}", map[string]int{"W": 1, "U": 1, "B": 1, "R": 1, "G": 1}},
+		{"{W/U}{U/P}{X}", map[string]int{"U": 1}},
+	}
+	for _, c := range cases {
+		if got := (Card{ManaCost: c.cost}).Pips(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Pips(%s)=%v; want %v", c.cost, got, c.want)
+		}
+	}
+}
+
+func TestCountDecksByPips(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":                  {Name: "Opt", Legalities: legal, ManaCost: "{U}"},
+		"Counterspell":         {Name: "Counterspell", Legalities: legal, ManaCost: "{U}{U}"},
+		"Lightning Bolt":       {Name: "Lightning Bolt", Legalities: legal, ManaCost: "{R}"},
+		"Izzet Charm":          {Name: "Izzet Charm", Legalities: legal, ManaCost: "{U}{R}"},
+		"Swords to Plowshares": {Name: "Swords to Plowshares", Legalities: legal, ManaCost: "{W}"},
+		"Ornithopter":          {Name: "Ornithopter", Legalities: legal, ManaCost: "{0}"},
+		"Island":               {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	// The pool, in order: Opt, Counterspell, Bolt, Charm, Swords,
+	// Ornithopter, Island.
+	limit := []int{4, 4, 4, 4, 4, 4, 1000}
+	pips := [][2]int{{1, 0}, {2, 0}, {0, 1}, {1, 1}, {0, 0}, {0, 0}, {0, 0}}
+	targets := []map[string]int{{"U": 3, "R": 2}, {"U": 0}, {"U": 4}, {"R": 1, "B": 0}}
+	for _, target := range targets {
+		want := bruteForce(6, limit, func(copies []int) bool {
+			if copies[4] > 0 && target["W"] == 0 {
+				return false
+			}
+			var u, r int
+			for i, k := range copies {
+				u += k * pips[i][0]
+				r += k * pips[i][1]
+			}
+			return u == target["U"] && r == target["R"]
+		})
+		got := CountDecksByPips(6, cards, "modern", target)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksByPips(%v)=%v; want %d", target, got, want)
+		}
+	}
+}
+
+func TestCountDecksPowerBudget(t *testing.T) {
+	power, err := ReadPowerRatings(strings.NewReader("# name,power\nSol Ring,9\n\"Omnath, Locus of Creation\",6\nOpt, 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"Sol Ring": 9, "Omnath, Locus of Creation": 6, "Opt": 2}; !reflect.DeepEqual(power, want) {
+		t.Errorf("ReadPowerRatings=%v; want %v", power, want)
+	}
+	for _, bad := range []string{"Sol Ring\n", "Sol Ring,high\n", "Sol Ring,-1\n"} {
+		if _, err := ReadPowerRatings(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadPowerRatings(%q): no error", bad)
+		}
+	}
+	legal := map[string]string{"commander": "Legal"}
+	cards := map[string]Card{
+		"Sol Ring":                  {Name: "Sol Ring", Legalities: legal},
+		"Omnath, Locus of Creation": {Name: "Omnath, Locus of Creation", Legalities: legal},
+		"Opt":                       {Name: "Opt", Legalities: legal},
+		"Island":                    {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+	}
+	// The pool, in order: Sol Ring, Omnath, Opt, Island.
+	limit, cost := []int{4, 4, 4, 1000}, []int{9, 6, 2, 0}
+	for _, budget := range []int{-1, 0, 8, 15, 100} {
+		want := bruteForce(5, limit, func(copies []int) bool {
+			total := 0
+			for i, k := range copies {
+				total += k * cost[i]
+			}
+			return total <= budget
+		})
+		got := CountDecksPowerBudget(5, cards, "commander", power, budget)
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksPowerBudget(%d)=%v; want %d", budget, got, want)
+		}
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/suspended.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards, err := ParseCards(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ValidateData(cards)
+	want := DataReport{
+		Cards:    4,
+		Statuses: map[string]int{"Legal": 3, "Restricted": 1, "Banned": 1, "Suspended": 1},
+		Unnamed:  []string{"Mystery"},
+		Unknown:  []string{"Omnath, Locus of Creation: historic=Suspended"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateData()=%+v; want %+v", got, want)
+	}
+	var buf bytes.Buffer
+	got.Print(&buf)
+	if !strings.Contains(buf.String(), "unknown legality status (counted as banned) for Omnath, Locus of Creation: historic=Suspended") {
+		t.Errorf("Print() doesn't flag the Suspended status:\n%s", buf.String())
+	}
+}
+
+func TestLimitStatuses(t *testing.T) {
+	cases := []struct {
+		card   Card
+		future bool
+		want   int
+	}{
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Legal"}}, false, 4},
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Restricted"}}, false, 1},
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Banned"}}, false, 0},
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Suspended"}}, true, 0},
+		{Card{Name: "Opt", Legalities: map[string]string{}}, true, 0},
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Future"}}, false, 0},
+		{Card{Name: "Opt", Legalities: map[string]string{"standard": "Future"}}, true, 4},
+		{Card{Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"standard": "Future"}}, true, 1000},
+	}
+	saved := defaults
+	defer func() { defaults = saved }()
+	for _, c := range cases {
+		defaults = saved
+		if c.future {
+			SetDefaults(WithFuture())
+		}
+		got := c.card.Limit("standard")
+		if got != c.want {
+			t.Errorf("Limit(%s, %v, future=%v)=%d; want %d", c.card.Name, c.card.Legalities, c.future, got, c.want)
+		}
+	}
+	if _, ok := DefaultStatusLimits["Future"]; ok {
+		t.Errorf("withFuture modified DefaultStatusLimits")
+	}
+}
+
+func TestCopiesAllowed(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cases := []struct {
+		card Card
+		want int
+	}{
+		{Card{Name: "Relentless Rats", Text: "A deck can have any number of cards named Relentless Rats.\nRelentless Rats gets +1/+1 for each other creature you control named Relentless Rats."}, 1000},
+		{Card{Name: "Dragon's Approach", Text: "Dragon's Approach deals 3 damage to each opponent.\nA deck can have any number of cards named Dragon's Approach."}, 1000},
+		{Card{Name: "Seven Dwarves", Text: "Seven Dwarves gets +1/+1 for each other creature named Seven Dwarves you control.\nA deck can have up to seven cards named Seven Dwarves."}, 7},
+		{Card{Name: "Shadowborn Apostle"}, 1000}, // No text: from copiesByName.
+		{Card{Name: "Opt", Text: "Scry 1.\nDraw a card."}, 0},
+		{Card{Name: "Opt"}, 0},
+	}
+	for _, c := range cases {
+		if got := c.card.CopiesAllowed(); got != c.want {
+			t.Errorf("%s: CopiesAllowed()=%d; want %d", c.card.Name, got, c.want)
+		}
+		want := c.want
+		if want == 0 {
+			want = 4
+		}
+		c.card.Legalities = legal
+		if got := c.card.Limit("modern"); got != want {
+			t.Errorf("%s: Limit(modern)=%d; want %d", c.card.Name, got, want)
+		}
+		c.card.Legalities = map[string]string{"modern": "Restricted"}
+		if got := c.card.Limit("modern"); got != 1 {
+			t.Errorf("%s: Limit(modern) when restricted=%d; want 1", c.card.Name, got)
+		}
+	}
+}
+
+func TestCountDecksWithSet(t *testing.T) {
+	legal := map[string]string{"standard": "Legal"}
+	cards := map[string]Card{
+		"Opt":    {Name: "Opt", Legalities: legal, Printings: []string{"XLN", "DOM", "ELD"}},
+		"Shock":  {Name: "Shock", Legalities: legal, Printings: []string{"M19", "ELD"}},
+		"Duress": {Name: "Duress", Legalities: legal, Printings: []string{"M19"}},
+		"Island": {Name: "Island", Type: "Basic Land — Island", Legalities: legal, Printings: []string{"M19"}},
+	}
+	cases := []struct {
+		set  string
+		want *big.Int
+	}{
+		// Everything minus the decks of Duress and Islands.
+		{"ELD", new(big.Int).Sub(CountDecks(6, 2, []int{4, 4, 4, 1000}), CountDecks(6, 2, []int{4, 1000}))},
+		{"M19", new(big.Int).Sub(CountDecks(6, 2, []int{4, 4, 4, 1000}), CountDecks(6, 2, []int{4}))},
+		{"XXX", big.NewInt(0)},
+	}
+	for _, c := range cases {
+		got := CountDecksWithSet(6, 2, cards, "standard", c.set)
+		if got.Cmp(c.want) != 0 {
+			t.Errorf("CountDecksWithSet(%s)=%v; want %v", c.set, got, c.want)
+		}
+	}
+}
+
+func TestCountCardPairs(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Lightning Helix":    {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Boros Charm":        {Name: "Boros Charm", Legalities: legal, ColorIdentity: []string{"W", "R"}},
+		"Lightning Bolt":     {Name: "Lightning Bolt", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Shock":              {Name: "Shock", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Skewer the Critics": {Name: "Skewer the Critics", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Ornithopter":        {Name: "Ornithopter", Legalities: legal},
+		"Ancestral Recall":   {Name: "Ancestral Recall", Legalities: map[string]string{"modern": "Banned"}, ColorIdentity: []string{"U"}},
+	}
+	cases := []struct {
+		same, ordered bool
+		want          int64
+	}{
+		{false, true, 6 * 5},
+		{false, false, 6 * 5 / 2},
+		// RW: 2*1, R: 3*2, colorless: 0.
+		{true, true, 2 + 6},
+		{true, false, 1 + 3},
+	}
+	for _, c := range cases {
+		got := CountCardPairs(cards, "modern", c.same, c.ordered)
+		if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountCardPairs(same=%v, ordered=%v)=%v; want %d", c.same, c.ordered, got, c.want)
+		}
+	}
+}
+
+func TestCountCommanderDecks(t *testing.T) {
+	both := map[string]string{"commander": "Legal", "brawl": "Legal"}
+	cards := map[string]Card{
+		"Krenko, Mob Boss": {Name: "Krenko, Mob Boss", Type: "Legendary Creature — Goblin Warrior",
+			Legalities: both, ColorIdentity: []string{"R"}},
+		"Jace, Vryn's Prodigy": {Name: "Jace, Vryn's Prodigy", Type: "Legendary Creature — Human Wizard",
+			Legalities: both, ColorIdentity: []string{"U"}},
+		"Shock":        {Name: "Shock", Type: "Instant", Legalities: both, ColorIdentity: []string{"R"}},
+		"Counterspell": {Name: "Counterspell", Type: "Instant", Legalities: both, ColorIdentity: []string{"U"}},
+		"Sol Ring":     {Name: "Sol Ring", Type: "Artifact", Legalities: map[string]string{"commander": "Legal"}},
+		"Mountain":     {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: both, ColorIdentity: []string{"R"}},
+	}
+	cases := []struct {
+		format   string
+		deckSize int
+		want     int64
+	}{
+		// Krenko's 99 are Shock and/or Sol Ring plus Mountains; Jace can't
+		// fill a deck without Islands.
+		{"commander", 100, 4},
+		// Sol Ring isn't in the Brawl pool.
+		{"brawl", 60, 2},
+		// Krenko plus one card (Shock or Mountain); Jace plus Counterspell.
+		{"brawl", 2, 3},
+		{"brawl", 1, 2},
+	}
+	for _, c := range cases {
+		got := countCommanderDecks(cards, c.format, c.deckSize)
+		if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("countCommanderDecks(%s, %d)=%v; want %d", c.format, c.deckSize, got, c.want)
+		}
+	}
+	if got := CountBrawlDecks(cards); got.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("CountBrawlDecks()=%v; want 2", got)
+	}
+}
+
+// bruteForce counts the numMain-card decks from limit for which ok returns
+// true, by enumerating the number of copies of each card.
+func bruteForce(numMain int, limit []int, ok func(copies []int) bool) int64 {
+	copies := make([]int, len(limit))
+	var count func(i, left int) int64
+	count = func(i, left int) int64 {
+		if i == len(limit) {
+			if left == 0 && ok(copies) {
+				return 1
+			}
+			return 0
+		}
+		n := int64(0)
+		for k := 0; k <= limit[i] && k <= left; k++ {
+			copies[i] = k
+			n += count(i+1, left-k)
+		}
+		copies[i] = 0
+		return n
+	}
+	return count(0, numMain)
+}
+
+func TestCountDecksMaxDistinctNonland(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Island":         {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Steam Vents":    {Name: "Steam Vents", Type: "Land — Island Mountain", Legalities: legal},
+		"Opt":            {Name: "Opt", Type: "Instant", Legalities: legal},
+		"Lightning Bolt": {Name: "Lightning Bolt", Type: "Instant", Legalities: legal},
+		"Ponder":         {Name: "Ponder", Type: "Sorcery", Legalities: map[string]string{"modern": "Restricted"}},
+	}
+	limit := []int{20, 4, 4, 4, 1} // Island, Steam Vents, Opt, Lightning Bolt, Ponder.
+	for numMain := 0; numMain <= 10; numMain++ {
+		for maxDistinct := -1; maxDistinct <= 3; maxDistinct++ {
+			want := bruteForce(numMain, limit, func(copies []int) bool {
+				n := 0
+				for _, k := range copies[2:] {
+					if k > 0 {
+						n++
+					}
+				}
+				return n <= maxDistinct
+			})
+			got := CountDecksMaxDistinctNonland(numMain, cards, "modern", maxDistinct)
+			if got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("CountDecksMaxDistinctNonland(%d, %d)=%v; want %d", numMain, maxDistinct, got, want)
+			}
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	for _, st := range selfTests {
+		got := CountDecks(st.numMain, st.numSide, st.limit)
+		if got.Cmp(big.NewInt(st.want)) != 0 {
+			t.Errorf("CountDecks(%d, %d, %v)=%v; want %d", st.numMain, st.numSide, st.limit, got, st.want)
+		}
+	}
+	var buf bytes.Buffer
+	if !SelfTest(&buf) {
+		t.Errorf("SelfTest() failed:\n%s", buf.String())
+	}
+	if n := strings.Count(buf.String(), "PASS"); n != len(selfTests) {
+		t.Errorf("SelfTest() printed %d PASS lines; want %d:\n%s", n, len(selfTests), buf.String())
+	}
+}
+
+func TestCountDecksFromNames(t *testing.T) {
+	cards, err := ParseCards(sampleJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		names []string
+		want  *big.Int
+	}{
+		{[]string{"Island"}, big.NewInt(1)},
+		{[]string{"Island", "Island"}, big.NewInt(1)},
+		{[]string{"Island", "Llanowar Elves"}, CountDecks(60, 15, []int{1000, 4})},
+		{[]string{}, big.NewInt(0)},
+	}
+	for _, c := range cases {
+		got, err := CountDecksFromNames(60, 15, cards, "modern", c.names)
+		if err != nil {
+			t.Errorf("CountDecksFromNames(%q) error: %v", c.names, err)
+			continue
+		}
+		if got.Cmp(c.want) != 0 {
+			t.Errorf("CountDecksFromNames(%q)=%v; want %v", c.names, got, c.want)
+		}
+	}
+	if _, err := CountDecksFromNames(60, 15, cards, "modern", []string{"Island", "Islnad"}); err == nil {
+		t.Errorf("CountDecksFromNames(misspelled name) succeeded; want error")
+	}
+}
+
+func TestBasicCap(t *testing.T) {
+	data := []byte(`{
+		"Plains": {"name": "Plains", "type": "Basic Land — Plains", "legalities": {"modern": "Legal"}},
+		"Island": {"name": "Island", "type": "Basic Land — Island", "legalities": {"modern": "Legal"}},
+		"Opt": {"name": "Opt", "type": "Instant", "legalities": {"modern": "Legal"}}
+	}`)
+	saved := defaults
+	defer func() { defaults = saved }()
+	cases := []struct {
+		cap  int
+		want int64
+	}{
+		// k Opts and 60-k basics, at most 30 of each basic: 1+2+3+4+5 ways.
+		{30, 15},
+		// Two basics capped at 20 and 4 Opts make at most 44 cards.
+		{20, 0},
+	}
+	uncapped := countFor(t, data)
+	for _, c := range cases {
+		SetDefaults(WithBasicCap(c.cap))
+		got := countFor(t, data)
+		if got.Cmp(big.NewInt(c.want)) != 0 || got.Cmp(uncapped) >= 0 {
+			t.Errorf("CountDecks with WithBasicCap(%d)=%v; want %d, fewer than %v", c.cap, got, c.want, uncapped)
+		}
+	}
+}
+
+// countFor counts the 60-card Modern decks in a card data file.
+func countFor(t *testing.T, data []byte) *big.Int {
+	limits, err := FormatLimits(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CountDecks(60, 0, limits["modern"])
+}
+
+func TestRebalancedCards(t *testing.T) {
+	legal := map[string]string{"pioneer": "Legal", "historic": "Legal"}
+	cards := map[string]Card{
+		"Luminarch Aspirant":   {Name: "Luminarch Aspirant", Type: "Creature — Human Cleric", Legalities: legal},
+		"A-Luminarch Aspirant": {Name: "A-Luminarch Aspirant", Type: "Creature — Human Cleric", Legalities: legal},
+		"Plains":               {Name: "Plains", Type: "Basic Land — Plains", Legalities: legal},
+	}
+	limits := LimitsByFormat(cards)
+	if got, want := len(limits["historic"]), 3; got != want {
+		t.Errorf("historic has %d legal cards; want %d", got, want)
+	}
+	if got, want := len(limits["pioneer"]), 2; got != want {
+		t.Errorf("pioneer has %d legal cards; want %d", got, want)
+	}
+	historic := CountDecks(8, 0, limits["historic"])
+	pioneer := CountDecks(8, 0, limits["pioneer"])
+	if historic.Cmp(pioneer) <= 0 {
+		t.Errorf("historic count %v <= pioneer count %v", historic, pioneer)
+	}
+}
+
+func TestCountGuildDecks(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Azorius Charm":   {Name: "Azorius Charm", Legalities: legal, ColorIdentity: []string{"W", "U"}},
+		"Opt":             {Name: "Opt", Legalities: legal, ColorIdentity: []string{"U"}},
+		"Path to Exile":   {Name: "Path to Exile", Legalities: legal, ColorIdentity: []string{"W"}},
+		"Lightning Helix": {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Ornithopter":     {Name: "Ornithopter", Legalities: legal},
+		"Island":          {Name: "Island", Type: "Basic Land — Island", Legalities: legal, ColorIdentity: []string{"U"}},
+		"Mountain":        {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: legal, ColorIdentity: []string{"R"}},
+	}
+	cases := []struct {
+		colors string
+		limit  []int
+	}{
+		{"WU", []int{4, 4, 4, 4, 1000}},
+		{"UW", []int{4, 4, 4, 4, 1000}},
+		{"RW", []int{4, 4, 4, 1000}},
+		{"BG", []int{4}},
+	}
+	for _, c := range cases {
+		want := CountDecks(6, 2, c.limit)
+		got := CountGuildDecks(cards, "modern", c.colors, 6, 2)
+		if got.Cmp(want) != 0 {
+			t.Errorf("CountGuildDecks(%s)=%v; want %v", c.colors, got, want)
+		}
+	}
+}
+
+func TestFormatCase(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/mixedcase.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := FormatLimits(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := []string{}
+	for f := range limits {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	if want := []string{"historicbrawl", "modern", "standard"}; !reflect.DeepEqual(formats, want) {
+		t.Errorf("formats=%v; want %v", formats, want)
+	}
+	// Field of the Dead's "STANDARD": "Banned" wins over "standard": "Legal".
+	if got, want := len(limits["standard"]), 3; got != want {
+		t.Errorf("len(limits[standard])=%d; want %d", got, want)
+	}
+	cards, err := ParseCards(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"standard", "Standard", "STANDARD"} {
+		limit, err := LegalLimits(cards, f)
+		if err != nil {
+			t.Errorf("LegalLimits(%s): %v", f, err)
+		} else if len(limit) != 3 {
+			t.Errorf("len(LegalLimits(%s))=%d; want 3", f, len(limit))
+		}
+	}
+	if CanonicalFormat("Historic Brawl") != "historicbrawl" {
+		t.Errorf("CanonicalFormat(Historic Brawl)=%q; want historicbrawl", CanonicalFormat("Historic Brawl"))
+	}
+}
+
+func TestCountDecksSideLimits(t *testing.T) {
+	// With equal limits, it's CountDecks.
+	for _, st := range selfTests {
+		got, err := CountDecksSideLimits(st.numMain, st.numSide, st.limit, st.limit)
+		if err != nil || got.Cmp(big.NewInt(st.want)) != 0 {
+			t.Errorf("CountDecksSideLimits(%d, %d, %v, %v)=%v, %v; want %d", st.numMain, st.numSide, st.limit, st.limit, got, err, st.want)
+		}
+	}
+	// Card B is sideboard-only: the main deck is AA and the sideboard is A,
+	// B, or empty.  With one sideboard slot, A or B.
+	mainLimit, sideLimit := []int{3, 0}, []int{3, 1}
+	cases := []struct {
+		numMain, numSide int
+		want             int64
+	}{
+		{2, 0, 1},
+		{2, 1, 2},
+		{0, 1, 2},
+		{0, 2, 2}, // AA or AB.
+		{3, 1, 1}, // AAA, B.
+	}
+	for _, c := range cases {
+		got, err := CountDecksSideLimits(c.numMain, c.numSide, mainLimit, sideLimit)
+		if err != nil || got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountDecksSideLimits(%d, %d, %v, %v)=%v, %v; want %d", c.numMain, c.numSide, mainLimit, sideLimit, got, err, c.want)
+		}
+	}
+	// A card with limits 4 and 1 has at most 4 copies in all, not 5.
+	for _, c := range []struct {
+		numMain, numSide int
+		want             int64
+	}{{3, 1, 1}, {4, 0, 1}, {4, 1, 0}, {0, 2, 0}} {
+		got, err := CountDecksSideLimits(c.numMain, c.numSide, []int{4}, []int{1})
+		if err != nil || got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountDecksSideLimits(%d, %d, [4], [1])=%v, %v; want %d", c.numMain, c.numSide, got, err, c.want)
+		}
+	}
+	if _, err := CountDecksSideLimits(2, 1, []int{1, 1}, []int{1}); !errors.Is(err, ErrBadLimits) {
+		t.Errorf("CountDecksSideLimits([1 1], [1]) err=%v; want ErrBadLimits", err)
+	}
+	if _, err := CountDecksSideLimits(-1, 1, []int{1}, []int{1}); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("CountDecksSideLimits(-1, 1) err=%v; want ErrDeckSize", err)
+	}
+}
+
+func TestCountVintageWithoutPower(t *testing.T) {
+	restricted := map[string]string{"vintage": "Restricted"}
+	cards := map[string]Card{
+		"Black Lotus": {Name: "Black Lotus", Legalities: restricted},
+		"Time Walk":   {Name: "Time Walk", Legalities: restricted},
+		"Sol Ring":    {Name: "Sol Ring", Legalities: restricted},
+		"Opt":         {Name: "Opt", Legalities: map[string]string{"vintage": "Legal"}},
+		"Island":      {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"vintage": "Legal"}},
+	}
+	got := CountVintageWithoutPower(6, 2, cards)
+	if want := CountDecks(6, 2, []int{1, 4, 1000}); got.Cmp(want) != 0 {
+		t.Errorf("CountVintageWithoutPower=%v; want %v", got, want)
+	}
+	if all := CountDecksWhere(6, 2, cards, "vintage", func(Card) bool { return true }); got.Cmp(all) >= 0 {
+		t.Errorf("CountVintageWithoutPower=%v; want fewer than Vintage's %v", got, all)
+	}
+}
+
+func TestIsLargeCount(t *testing.T) {
+	cards := func(n, lim int) []int {
+		limit := make([]int, n)
+		for i := range limit {
+			limit[i] = lim
+		}
+		return limit
+	}
+	// CountDecks's work depends on the limits' classes, not the cards.
+	cases := []struct {
+		numMain, numSide int
+		limit            []int
+		want             bool
+	}{
+		{60, 15, append(cards(2500, 4), cards(5, 1000)...), false},              // Standard-sized.
+		{60, 15, append(append(cards(20000, 4), cards(40, 1)...), 1000), false}, // Modern-sized.
+		{60, 15, cards(200, 1000), false},
+		{300, 100, append(append(cards(20000, 4), cards(40, 1)...), 1000), true},
+		{300, 100, cards(20000, 4), false},
+		{1000, 1000, cards(10, 3000), true},
+	}
+	for _, c := range cases {
+		if got := IsLargeCount(c.numMain, c.numSide, c.limit); got != c.want {
+			t.Errorf("IsLargeCount(%d, %d, %d cards)=%v; want %v", c.numMain, c.numSide, len(c.limit), got, c.want)
+		}
+	}
+}
+
+func TestCountDecksOneZone(t *testing.T) {
+	for _, st := range selfTests {
+		var want int64
+		EnumerateDecks(st.numMain, st.numSide, st.limit, func(main, side []int) {
+			for i := range main {
+				if main[i] > 0 && side[i] > 0 {
+					return
+				}
+			}
+			want++
+		})
+		if got := CountDecksOneZone(st.numMain, st.numSide, st.limit); got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksOneZone(%d, %d, %v)=%v; want %d", st.numMain, st.numSide, st.limit, got, want)
+		}
+	}
+	// With limit [1,2,3], 2 main and 1 side: AB|C, AC|B, BB|A, BB|C, BC|A,
+	// CC|A, CC|B.
+	if got := CountDecksOneZone(2, 1, []int{1, 2, 3}); got.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("CountDecksOneZone(2, 1, [1 2 3])=%v; want 7", got)
+	}
+}
+
+func TestCountDisjointDeckPairs(t *testing.T) {
+	cases := []struct {
+		numMain, numSide int
+		limit            []int
+	}{
+		{1, 0, []int{1, 1}},
+		{2, 1, []int{1, 2, 3}},
+		{2, 1, []int{1, 2, 3, 4}},
+		{3, 0, []int{2, 2, 1, 1}},
+		{0, 0, []int{4}},
+	}
+	for _, c := range cases {
+		var decks [][]int // Copies of each card in each deck, main and side.
+		EnumerateDecks(c.numMain, c.numSide, c.limit, func(main, side []int) {
+			copies := make([]int, len(main))
+			for i := range main {
+				copies[i] = main[i] + side[i]
+			}
+			decks = append(decks, copies)
+		})
+		var want int64
+		for _, a := range decks {
+		pairs:
+			for _, b := range decks {
+				for i := range a {
+					if a[i] > 0 && b[i] > 0 {
+						continue pairs
+					}
+				}
+				want++
+			}
+		}
+		if got := CountDisjointDeckPairs(c.numMain, c.numSide, c.limit); got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDisjointDeckPairs(%d, %d, %v)=%v; want %d", c.numMain, c.numSide, c.limit, got, want)
+		}
+	}
+}
+
+func TestCountDecksForbiddenPair(t *testing.T) {
+	for _, st := range selfTests {
+		for a := range st.limit {
+			for b := a + 1; b < len(st.limit); b++ {
+				var want int64
+				EnumerateDecks(st.numMain, st.numSide, st.limit, func(main, side []int) {
+					if main[a]+side[a] == 0 || main[b]+side[b] == 0 {
+						want++
+					}
+				})
+				got := CountDecksForbiddenPair(st.numMain, st.numSide, st.limit, a, b)
+				if got.Cmp(big.NewInt(want)) != 0 {
+					t.Errorf("CountDecksForbiddenPair(%d, %d, %v, %d, %d)=%v; want %d", st.numMain, st.numSide, st.limit, a, b, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCountDecksThemeCore(t *testing.T) {
+	limit := []int{4, 4, 4, 1, 1000}
+	cases := []struct {
+		theme    []int
+		minFours int
+	}{
+		{[]int{0, 1}, 1},
+		{[]int{0, 1}, 2},
+		{[]int{0, 1}, 0},
+		{[]int{0, 3}, 1},
+		{[]int{0, 1, 2}, 2},
+		{[]int{4}, 1}, // One unlimited card: exactly 4 copies.
+	}
+	for _, c := range cases {
+		for _, numMain := range []int{4, 9} {
+			want := bruteForce(numMain, limit, func(copies []int) bool {
+				fours := 0
+				for _, i := range c.theme {
+					if copies[i] == 4 {
+						fours++
+					}
+				}
+				return fours >= c.minFours
+			})
+			got := CountDecksThemeCore(numMain, limit, c.theme, c.minFours)
+			if got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("CountDecksThemeCore(%d, %v, %v, %d)=%v; want %d", numMain, limit, c.theme, c.minFours, got, want)
+			}
+		}
+	}
+}
+
+func TestCountDecksCapPerCard(t *testing.T) {
+	for _, st := range selfTests {
+		for max := 0; max <= 3; max++ {
+			clamped := []int{}
+			for _, lim := range st.limit {
+				if lim > max {
+					lim = max
+				}
+				clamped = append(clamped, lim)
+			}
+			got := CountDecksCapPerCard(st.numMain, st.numSide, max, st.limit)
+			if want := CountDecks(st.numMain, st.numSide, clamped); got.Cmp(want) != 0 {
+				t.Errorf("CountDecksCapPerCard(%d, %d, %d, %v)=%v; want %v", st.numMain, st.numSide, max, st.limit, got, want)
+			}
+			var brute int64
+			EnumerateDecks(st.numMain, st.numSide, st.limit, func(main, side []int) {
+				for i := range main {
+					if main[i]+side[i] > max {
+						return
+					}
+				}
+				brute++
+			})
+			if got.Cmp(big.NewInt(brute)) != 0 {
+				t.Errorf("CountDecksCapPerCard(%d, %d, %d, %v)=%v; brute force says %d", st.numMain, st.numSide, max, st.limit, got, brute)
+			}
+		}
+	}
+}
+
+func TestFormatAliases(t *testing.T) {
+	data := []byte(`{
+		"Sol Ring": {"name": "Sol Ring", "type": "Artifact", "legalities": {"duelcommander": "Banned", "edh": "Legal"}},
+		"Opt": {"name": "Opt", "type": "Instant", "legalities": {"duel": "Legal", "commander": "Legal", "pauper": "Legal"}}
+	}`)
+	AddFormatAlias("pdh", "pauper")
+	defer delete(formatAliases, "pdh")
+	cards, err := ParseCards(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		format string
+		want   []int
+	}{
+		{"duel", []int{4}},
+		{"Duel Commander", []int{4}},
+		{"EDH", []int{4, 4}},
+		{"commander", []int{4, 4}},
+		{"PDH", []int{4}},
+	}
+	for _, c := range cases {
+		got, err := LegalLimits(cards, c.format)
+		if err != nil {
+			t.Errorf("LegalLimits(%s): %v", c.format, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("LegalLimits(%s)=%v; want %v", c.format, got, c.want)
+		}
+	}
+}
+
+func TestCountDecksWhere(t *testing.T) {
+	cards, err := ParseCards([]byte(sampleJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := func(Card) bool { return true }
+	if got, want := CountDecksWhere(6, 2, cards, "modern", all), CountDecks(6, 2, poolLimits(cards, "modern", all)); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksWhere(all)=%v; want %v", got, want)
+	}
+	green := func(c Card) bool { return c.withinIdentity("G") }
+	if got, want := CountDecksWhere(6, 2, cards, "modern", green), CountGuildDecks(cards, "modern", "G", 6, 2); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksWhere(green)=%v; want %v", got, want)
+	}
+	lands := DeckCountsBySize(poolLimits(cards, "modern", Card.IsLand), 6)[6]
+	if got := CountDecksWhere(6, 0, cards, "modern", Card.IsLand); got.Cmp(lands) != 0 {
+		t.Errorf("CountDecksWhere(lands)=%v; want %v", got, lands)
+	}
+}
+
+func TestCountDecksProgress(t *testing.T) {
+	for _, st := range selfTests {
+		calls, last := 0, 0
+		got := CountDecksProgress(st.numMain, st.numSide, st.limit, func(done, total int) {
+			calls++
+			if done <= last || done > total || total != len(st.limit) {
+				t.Errorf("progress(%d, %d) on call %d, after %d", done, total, calls, last)
+			}
+			last = done
+		})
+		if got.Cmp(big.NewInt(st.want)) != 0 {
+			t.Errorf("CountDecksProgress(%d, %d, %v)=%v; want %d", st.numMain, st.numSide, st.limit, got, st.want)
+		}
+		// A call for each class at most, ending with all the cards.
+		if calls == 0 || calls > len(LimitClasses(st.numMain, st.numSide, st.limit)) || last != len(st.limit) {
+			t.Errorf("CountDecksProgress(%v) called progress %d times, last with %d", st.limit, calls, last)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	cards, err := ParseCards(sampleJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit, err := LegalLimits(cards, "modern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Count(cards, DeckSpec{Format: "Modern", Main: 6, Side: 2})
+	if want := CountDecks(6, 2, limit); err != nil || got.Cmp(want) != 0 {
+		t.Errorf("Count(modern, 6+2)=%v, %v; want %v", got, err, want)
+	}
+	for _, st := range selfTests {
+		got, err := CountLimits(st.limit, DeckSpec{Main: st.numMain, Side: st.numSide})
+		if err != nil || got.Cmp(big.NewInt(st.want)) != 0 {
+			t.Errorf("CountLimits(%v, %d+%d)=%v, %v; want %d", st.limit, st.numMain, st.numSide, got, err, st.want)
+		}
+	}
+	if _, err := Count(cards, DeckSpec{Format: "frontier", Main: 60}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Count(frontier) error %v; want ErrUnknownFormat", err)
+	}
+	if _, err := Count(cards, DeckSpec{Format: "modern", Main: -1}); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("Count(main -1) error %v; want ErrDeckSize", err)
+	}
+	capped, err := Count(cards, DeckSpec{Format: "modern", Main: 6}, WithBasicCap(1))
+	if uncapped := CountDecks(6, 0, limit); err != nil || capped.Cmp(uncapped) >= 0 {
+		t.Errorf("Count(WithBasicCap(1))=%v, %v; want fewer than %v", capped, err, uncapped)
+	}
+	if got := cards["Island"].Limit("modern"); got != 1000 {
+		t.Errorf("after Count(WithBasicCap(1)), Island Limit(modern)=%d; want 1000", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CountLimits(limit, DeckSpec{Main: 6}, WithContext(ctx)); err != context.Canceled {
+		t.Errorf("CountLimits(canceled) error %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestCountDecksMinMulticolor(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Lightning Helix": {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Boros Charm":     {Name: "Boros Charm", Legalities: map[string]string{"modern": "Restricted"}, ColorIdentity: []string{"R", "W"}},
+		"Lightning Bolt":  {Name: "Lightning Bolt", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Ornithopter":     {Name: "Ornithopter", Legalities: legal},
+	}
+	limit := []int{4, 1, 4, 4} // Helix, Charm, Bolt, Ornithopter.
+	for numMain := 0; numMain <= 8; numMain++ {
+		for minMulti := 0; minMulti <= 6; minMulti++ {
+			want := bruteForce(numMain, limit, func(copies []int) bool { return copies[0]+copies[1] >= minMulti })
+			got := CountDecksMinMulticolor(numMain, cards, "modern", minMulti)
+			if got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("CountDecksMinMulticolor(%d, %d)=%v; want %d", numMain, minMulti, got, want)
+			}
+		}
+	}
+}
+
+func TestLimitHistogram(t *testing.T) {
+	cards := map[string]Card{
+		"Island":       {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"vintage": "Legal"}},
+		"Swamp":        {Name: "Swamp", Type: "Basic Land — Swamp", Legalities: map[string]string{"vintage": "Legal"}},
+		"Black Lotus":  {Name: "Black Lotus", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Opt":          {Name: "Opt", Legalities: map[string]string{"vintage": "Legal"}},
+		"Brainstorm":   {Name: "Brainstorm", Legalities: map[string]string{"vintage": "Legal"}},
+		"Counterspell": {Name: "Counterspell", Legalities: map[string]string{"vintage": "Legal"}},
+		"Shahrazad":    {Name: "Shahrazad", Legalities: map[string]string{"vintage": "Banned"}},
+	}
+	named := NamedLimits(cards, "vintage")
+	if len(named) != 6 || named[0] != (NamedLimit{"Black Lotus", 1}) {
+		t.Errorf("NamedLimits()=%v", named)
+	}
+	got := LimitHistogram(named)
+	want := map[int]int{1: 1, 4: 3, 1000: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LimitHistogram()=%v; want %v", got, want)
+	}
+}
+
+func TestCountDecksAllRestricted(t *testing.T) {
+	cards := map[string]Card{
+		"Black Lotus":      {Name: "Black Lotus", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Ancestral Recall": {Name: "Ancestral Recall", Legalities: map[string]string{"vintage": "Restricted"}},
+		"Opt":              {Name: "Opt", Legalities: map[string]string{"vintage": "Legal"}},
+		"Island":           {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"vintage": "Legal"}},
+	}
+	limit := []int{1, 1, 4, 1000} // Lotus, Ancestral, Opt, Island.
+	for numMain := 0; numMain <= 6; numMain++ {
+		for numSide := 0; numSide <= 2; numSide++ {
+			want := int64(0)
+			EnumerateDecks(numMain, numSide, limit, func(main, side []int) {
+				if main[0]+side[0] == 1 && main[1]+side[1] == 1 {
+					want++
+				}
+			})
+			got := CountDecksAllRestricted(numMain, numSide, cards, "vintage")
+			if got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("CountDecksAllRestricted(%d, %d)=%v; want %d", numMain, numSide, got, want)
+			}
+		}
+	}
+	if got := CountDecksAllRestricted(1, 0, cards, "vintage"); got.Sign() != 0 {
+		t.Errorf("CountDecksAllRestricted(1, 0)=%v; want 0", got)
+	}
+	// Formats are matched as Limit matches them.
+	if got, want := CountDecksAllRestricted(2, 0, cards, "Vintage"), CountDecksAllRestricted(2, 0, cards, "vintage"); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksAllRestricted(2, 0, \"Vintage\")=%v; want %v", got, want)
+	}
+}
+
+func TestParseCardDataWrapped(t *testing.T) {
+	var limits []map[string][]int
+	var metas []Meta
+	for _, name := range []string{"testdata/flat.json", "testdata/wrapped.json", "testdata/atomic.json"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ParseCardData(data)
+		if err != nil {
+			t.Fatalf("ParseCardData(%s): %v", name, err)
+		}
+		lim := LimitsByFormat(d.Cards)
+		for _, l := range lim {
+			sort.Ints(l)
+		}
+		limits = append(limits, lim)
+		metas = append(metas, d.Meta)
+	}
+	if !reflect.DeepEqual(limits[0], limits[1]) {
+		t.Errorf("flat limits %v != wrapped limits %v", limits[0], limits[1])
+	}
+	if !reflect.DeepEqual(limits[0], limits[2]) {
+		t.Errorf("flat limits %v != v5 limits %v", limits[0], limits[2])
+	}
+	if want := (Meta{}); metas[0] != want {
+		t.Errorf("flat meta=%+v; want %+v", metas[0], want)
+	}
+	if want := (Meta{"4.6.3+20200508", "2020-05-08"}); metas[1] != want {
+		t.Errorf("wrapped meta=%+v; want %+v", metas[1], want)
+	}
+	if want := (Meta{"5.2.0+20210101", "2021-01-01"}); metas[2] != want {
+		t.Errorf("v5 meta=%+v; want %+v", metas[2], want)
+	}
+}
+
+func TestParseCardDataV5(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/atomic.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ParseCardData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Cards["Opt"].CMC(); got != 1 {
+		t.Errorf("Opt CMC()=%v; want 1 (from manaValue)", got)
+	}
+	if got := d.Cards["Black Lotus"].Limit("vintage"); got != 1 {
+		t.Errorf("Black Lotus Limit(vintage)=%v; want 1 (from the first face)", got)
+	}
+	if _, err := ParseCardData([]byte(`{"data": {"Opt": []}}`)); err == nil {
+		t.Errorf("ParseCardData(card with no faces) succeeded; want error")
+	}
+}
+
+func TestCountDecksWeightedByPrintings(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":    {Name: "Opt", Legalities: legal, Printings: []string{"XLN", "DOM", "ELD", "STA"}},
+		"Shock":  {Name: "Shock", Legalities: legal, Printings: []string{"M19", "ELD", "STA"}},
+		"Ponder": {Name: "Ponder", Legalities: map[string]string{"modern": "Restricted"}},
+		"Island": {Name: "Island", Type: "Basic Land — Island", Legalities: legal, Printings: []string{"M19", "M20"}},
+	}
+	limit := []int{4, 4, 1, 1000}
+	printings := []int64{4, 3, 1, 2}
+	for numMain := 0; numMain <= 8; numMain++ {
+		want := int64(0)
+		bruteForce(numMain, limit, func(copies []int) bool {
+			w := int64(1)
+			for i, k := range copies {
+				for j := 0; j < k; j++ {
+					w *= printings[i]
+				}
+			}
+			want += w
+			return true
+		})
+		got := CountDecksWeightedByPrintings(numMain, cards, "modern")
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksWeightedByPrintings(%d)=%v; want %d", numMain, got, want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	cards, err := ParseCards(sampleJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards["Black Lotus"] = Card{Name: "Black Lotus", Legalities: map[string]string{"vintage": "Banned"}}
+	_, errUnknownFormat := LegalLimits(cards, "pauper")
+	_, errEmptyPool := LegalLimits(cards, "vintage")
+	_, errBadName := CountDecksFromNames(60, 15, cards, "modern", []string{"Islnad"})
+	_, errBadDeck := ParseDeck(strings.NewReader("4 Lightning Bolt\nfour Opt\n"))
+	_, errArray := ParseCards([]byte(`[]`))
+	_, errBadCard := ParseCards([]byte(`{"Island": {"name": 7}}`))
+	_, errBadData := ParseCards([]byte(`{"meta": {}, "data": []}`))
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"LegalLimits(unknown format)", errUnknownFormat, ErrUnknownFormat},
+		{"LegalLimits(nothing legal)", errEmptyPool, ErrEmptyPool},
+		{"CountDecksFromNames(misspelled)", errBadName, ErrBadDecklist},
+		{"ParseDeck(bad count)", errBadDeck, ErrBadDecklist},
+		{"ParseCards(array)", errArray, ErrSchema},
+		{"ParseCards(bad card)", errBadCard, ErrSchema},
+		{"ParseCards(bad data)", errBadData, ErrSchema},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.err, c.want) {
+			t.Errorf("%s error=%v; want %v", c.name, c.err, c.want)
+		}
+	}
+	if _, err := LegalLimits(cards, "modern"); err != nil {
+		t.Errorf("LegalLimits(modern) error: %v", err)
+	}
+}
+
+func TestParseDeck(t *testing.T) {
+	in := `// Mono-blue
+4 Opt
+20 Island
+2x Counterspell
+
+Sideboard
+3 Negate
+SB: 1 Opt
+`
+	got, err := ParseDeck(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Deck{
+		Main: map[string]int{"Opt": 4, "Island": 20, "Counterspell": 2},
+		Side: map[string]int{"Negate": 3, "Opt": 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDeck()=%v; want %v", got, want)
+	}
+	// Arena's exports name the companion and the main deck.
+	in = "Companion\n1 Lurrus of the Dream-Den\n\nDeck\n4 Opt\n\nSideboard\n1 Lurrus of the Dream-Den\n"
+	got, err = ParseDeck(strings.NewReader(in))
+	want = Deck{
+		Main:      map[string]int{"Opt": 4},
+		Side:      map[string]int{"Lurrus of the Dream-Den": 2},
+		Companion: "Lurrus of the Dream-Den",
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDeck(Arena)=%v, %v; want %v", got, err, want)
+	}
+	if _, err := ParseDeck(strings.NewReader("Companion\n1 Lurrus of the Dream-Den\n1 Yorion, Sky Nomad\n")); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("ParseDeck(two companions) err=%v; want ErrBadDecklist", err)
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	text := "# What if?\nmodern: unban Splinter Twin\n\nBAN Oko, Thief of Crowns\nrestrict Circle of Protection: Red\n"
+	want := []Override{
+		{"modern", "Splinter Twin", "Legal"},
+		{"", "Oko, Thief of Crowns", "Banned"},
+		{"", "Circle of Protection: Red", "Restricted"},
+	}
+	got, err := ParseOverrides([]byte(text))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOverrides(text)=%v, %v; want %v", got, err, want)
+	}
+	js := `[{"format": "modern", "name": "Splinter Twin", "status": "Legal"}, {"name": "Oko, Thief of Crowns", "status": "Banned"}, {"name": "Circle of Protection: Red", "status": "Restricted"}]`
+	got, err = ParseOverrides([]byte(js))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOverrides(JSON)=%v, %v; want %v", got, err, want)
+	}
+	for _, bad := range []string{"unban", "legalize Opt", "modern: Opt", `[{"name": "Opt", "status": "Suspended"}]`, `[{"status": "Legal"}]`, `[{`} {
+		if _, err := ParseOverrides([]byte(bad)); !errors.Is(err, ErrBadOverride) {
+			t.Errorf("ParseOverrides(%q) error %v; want ErrBadOverride", bad, err)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	cards := map[string]Card{
+		"Splinter Twin": {Name: "Splinter Twin", Legalities: map[string]string{"modern": "Banned", "legacy": "Legal"}},
+		"Brainstorm":    {Name: "Brainstorm", Legalities: map[string]string{"legacy": "Legal", "vintage": "Legal"}},
+		"Opt":           {Name: "Opt", Legalities: map[string]string{"modern": "Legal"}},
+	}
+	overrides := []Override{
+		{"Modern", "Splinter Twin", "Legal"},
+		{"", "Brainstorm", "Restricted"},
+		{"legacy", "Brainstorm", "Banned"},
+	}
+	got, err := ApplyOverrides(cards, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, format string
+		want         int
+	}{
+		{"Splinter Twin", "modern", 4},
+		{"Splinter Twin", "legacy", 4},
+		{"Brainstorm", "vintage", 1},
+		{"Brainstorm", "legacy", 0},
+		{"Opt", "modern", 4},
+	}
+	for _, c := range cases {
+		if lim := got[c.name].Limit(c.format); lim != c.want {
+			t.Errorf("after overrides, %s Limit(%s)=%d; want %d", c.name, c.format, lim, c.want)
+		}
+	}
+	if cards["Splinter Twin"].Legalities["modern"] != "Banned" || cards["Brainstorm"].Legalities["legacy"] != "Legal" {
+		t.Errorf("ApplyOverrides changed its argument: %v", cards)
+	}
+	if _, err := ApplyOverrides(cards, []Override{{"", "Splinter Twins", "Legal"}}); !errors.Is(err, ErrBadOverride) {
+		t.Errorf("ApplyOverrides(unknown card) error %v; want ErrBadOverride", err)
+	}
+}
+
+func TestParseBanHistory(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/history.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseBanHistory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := `{"changes": [
+		{"date": "2015-01-19", "format": "modern", "name": "Birthing Pod", "status": "Banned"},
+		{"date": "2015-01-19", "format": "modern", "name": "Treasure Cruise", "status": "Banned"},
+		{"date": "2018-02-12", "format": "modern", "name": "Jace, the Mind Sculptor", "status": "Legal"},
+		{"date": "2019-08-26", "format": "modern", "name": "Hogaak, Arisen Necropolis", "status": "Banned"}
+	], "releases": {"DTK": "2015-03-27", "M20": "2019-07-12"}}`
+	want, err := ParseBanHistory([]byte(js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseBanHistory(text)=%+v; want %+v", got, want)
+	}
+	for _, bad := range []string{"2015-01-19 ban", "yesterday ban Opt", "2015-13-01 release DTK", `{"changes": [{"date": "2015-01-19", "name": "Opt"}]}`} {
+		if _, err := ParseBanHistory([]byte(bad)); !errors.Is(err, ErrBadOverride) {
+			t.Errorf("ParseBanHistory(%q) error %v; want ErrBadOverride", bad, err)
+		}
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/history.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParseBanHistory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modern := func(status string) map[string]string { return map[string]string{"modern": status} }
+	cards := map[string]Card{
+		"Birthing Pod":              {Name: "Birthing Pod", Legalities: modern("Banned"), Printings: []string{"NPH"}},
+		"Treasure Cruise":           {Name: "Treasure Cruise", Legalities: modern("Banned"), Printings: []string{"KTK"}},
+		"Jace, the Mind Sculptor":   {Name: "Jace, the Mind Sculptor", Legalities: modern("Legal"), Printings: []string{"WWK"}},
+		"Hogaak, Arisen Necropolis": {Name: "Hogaak, Arisen Necropolis", Legalities: modern("Banned"), Printings: []string{"MH1"}},
+		"Dragonlord Ojutai":         {Name: "Dragonlord Ojutai", Legalities: modern("Legal"), Printings: []string{"DTK"}},
+		"Opt":                       {Name: "Opt", Legalities: modern("Legal"), Printings: []string{"INV", "M20"}},
+	}
+	cases := []struct {
+		date string
+		want map[string]int // Modern limits; missing cards weren't printed yet.
+	}{
+		// The history doesn't list MH1's release, so Hogaak is always kept.
+		{"2015-01-01", map[string]int{"Birthing Pod": 4, "Treasure Cruise": 4, "Jace, the Mind Sculptor": 0, "Hogaak, Arisen Necropolis": 4, "Opt": 4}},
+		{"2015-01-19", map[string]int{"Birthing Pod": 0, "Treasure Cruise": 0, "Jace, the Mind Sculptor": 0, "Hogaak, Arisen Necropolis": 4, "Opt": 4}},
+		{"2018-06-01", map[string]int{"Birthing Pod": 0, "Treasure Cruise": 0, "Jace, the Mind Sculptor": 4, "Hogaak, Arisen Necropolis": 4, "Dragonlord Ojutai": 4, "Opt": 4}},
+		{"2020-01-01", map[string]int{"Birthing Pod": 0, "Treasure Cruise": 0, "Jace, the Mind Sculptor": 4, "Hogaak, Arisen Necropolis": 0, "Dragonlord Ojutai": 4, "Opt": 4}},
+	}
+	for _, c := range cases {
+		past, err := h.AsOf(cards, c.date)
+		if err != nil {
+			t.Fatalf("AsOf(%s): %v", c.date, err)
+		}
+		got := map[string]int{}
+		for name, card := range past {
+			got[name] = card.Limit("modern")
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("AsOf(%s) limits=%v; want %v", c.date, got, c.want)
+		}
+	}
+	if cards["Birthing Pod"].Legalities["modern"] != "Banned" {
+		t.Errorf("AsOf changed its argument")
+	}
+	if _, err := h.AsOf(cards, "2015/01/01"); err == nil {
+		t.Errorf("AsOf(2015/01/01) succeeded; want error")
+	}
+}
+
+func TestCountAllCommanderDecks(t *testing.T) {
+	legal := map[string]string{"commander": "Legal"}
+	cards := map[string]Card{
+		"Tymna the Weaver": {Name: "Tymna the Weaver", Type: "Legendary Creature — Human Cleric",
+			Keywords: []string{"Lifelink", "Partner"}, ColorIdentity: []string{"W"}},
+		"Kraum, Ludevic's Opus": {Name: "Kraum, Ludevic's Opus", Type: "Legendary Creature — Zombie Horror",
+			Keywords: []string{"Flying", "Haste", "Partner"}, ColorIdentity: []string{"R"}},
+		"Wilson, Refined Grizzly": {Name: "Wilson, Refined Grizzly", Type: "Legendary Creature — Bear Warrior",
+			Keywords: []string{"Choose a Background"}, ColorIdentity: []string{"G"}},
+		"Raised by Giants": {Name: "Raised by Giants", Type: "Legendary Enchantment — Background",
+			ColorIdentity: []string{"G"}},
+		"Shock":           {Name: "Shock", Type: "Instant", ColorIdentity: []string{"R"}},
+		"Lightning Helix": {Name: "Lightning Helix", Type: "Instant", ColorIdentity: []string{"R", "W"}},
+		"Mountain":        {Name: "Mountain", Type: "Basic Land — Mountain", ColorIdentity: []string{"R"}},
+		"Plains":          {Name: "Plains", Type: "Basic Land — Plains", ColorIdentity: []string{"W"}},
+		"Forest":          {Name: "Forest", Type: "Basic Land — Forest", ColorIdentity: []string{"G"}},
+	}
+	for name, c := range cards {
+		c.Legalities = legal
+		cards[name] = c
+	}
+	// Kraum: Shock or not, plus Mountains (2).  Tymna: Plains (1).  Kraum
+	// and Tymna: 98 cards from Shock, Helix, Mountains, and Plains, i.e.
+	// 99 + 2*98 + 97 = 392.  Wilson: Raised by Giants or not, plus Forests
+	// (2).  Wilson and Raised by Giants: Forests (1).
+	want := big.NewInt(2 + 1 + 392 + 2 + 1)
+	if got := CountAllCommanderDecks(cards, "commander"); got.Cmp(want) != 0 {
+		t.Errorf("CountAllCommanderDecks()=%v; want %v", got, want)
+	}
+	// Without partners or backgrounds, only the single commanders count.
+	want = big.NewInt(2 + 1 + 2)
+	if got := countCommanderDecks(cards, "commander", 100); got.Cmp(want) != 0 {
+		t.Errorf("countCommanderDecks()=%v; want %v", got, want)
+	}
+
+	cases := []struct {
+		names []string
+		want  int64
+	}{
+		{[]string{"Kraum, Ludevic's Opus"}, 2},
+		{[]string{"Tymna the Weaver", "Kraum, Ludevic's Opus"}, 392},
+		{[]string{"Raised by Giants", "Wilson, Refined Grizzly"}, 1},
+	}
+	for _, c := range cases {
+		got, err := CountDecksForCommander(cards, "commander", c.names...)
+		if err != nil {
+			t.Errorf("CountDecksForCommander(%q): %v", c.names, err)
+		} else if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountDecksForCommander(%q)=%v; want %d", c.names, got, c.want)
+		}
+	}
+	for _, names := range [][]string{{"Shock"}, {"Wilson, Refined Grizzly", "Tymna the Weaver"}, {"Sol Ring"}, {}} {
+		if _, err := CountDecksForCommander(cards, "commander", names...); !errors.Is(err, ErrBadDecklist) {
+			t.Errorf("CountDecksForCommander(%q) error %v; want ErrBadDecklist", names, err)
+		}
+	}
+}
+
+var long = flag.Bool("long", false, "run the Vintage benchmark on testdata/AllCards.json, which takes minutes")
+
+// benchLimits returns the limits in testdata/name, skipping b if the file
+// isn't there.
+func benchLimits(b *testing.B, name string) map[string][]int {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if os.IsNotExist(err) {
+		b.Skipf("no %s; download it from https://mtgjson.com/json/AllCards.json", name)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	limits, err := FormatLimits(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return limits
+}
+
+func benchmarkCountDecks(b *testing.B, limit []int) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CountDecks(60, 15, limit)
+	}
+}
+
+// BenchmarkCountDecks counts each format in the small committed fixture.
+func BenchmarkCountDecks(b *testing.B) {
+	limits := benchLimits(b, "bench.json")
+	for _, f := range []string{"standard", "modern", "legacy", "vintage"} {
+		b.Run(f, func(b *testing.B) { benchmarkCountDecks(b, limits[f]) })
+	}
+}
+
+// BenchmarkCountDecksAllCards counts each format in the real data, if it's
+// in testdata.  Vintage only runs with -long.
+func BenchmarkCountDecksAllCards(b *testing.B) {
+	limits := benchLimits(b, "AllCards.json")
+	for _, f := range []string{"standard", "modern", "legacy", "vintage"} {
+		b.Run(f, func(b *testing.B) {
+			if f == "vintage" && !*long {
+				b.Skip("skipping Vintage without -long")
+			}
+			benchmarkCountDecks(b, limits[f])
+		})
+	}
+}
+
+func BenchmarkFormatLimits(b *testing.B) {
+	data, err := ioutil.ReadFile("testdata/bench.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := FormatLimits(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCountDecksBySplit(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Forest":             {Name: "Forest", Type: "Basic Land — Forest", Legalities: legal},
+		"Dryad Arbor":        {Name: "Dryad Arbor", Type: "Land Creature — Forest Dryad", Legalities: legal},
+		"Llanowar Elves":     {Name: "Llanowar Elves", Type: "Creature — Elf Druid", Legalities: legal},
+		"Tarmogoyf":          {Name: "Tarmogoyf", Type: "Creature — Lhurgoyf", Legalities: legal},
+		"Giant Growth":       {Name: "Giant Growth", Type: "Instant", Legalities: legal},
+		"Green Sun's Zenith": {Name: "Green Sun's Zenith", Type: "Sorcery", Legalities: map[string]string{"modern": "Restricted"}},
+	}
+	limit := []int{12, 4, 4, 4, 4, 1} // Forest, Arbor, Elves, Goyf, Growth, GSZ.
+	for lands := 0; lands <= 4; lands++ {
+		for creatures := 0; creatures <= 4; creatures++ {
+			for others := 0; others <= 4; others++ {
+				numMain := lands + creatures + others
+				want := bruteForce(numMain, limit, func(copies []int) bool {
+					return copies[0]+copies[1] == lands && copies[2]+copies[3] == creatures
+				})
+				got, err := CountDecksBySplit(numMain, cards, "modern", lands, creatures, others)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Cmp(big.NewInt(want)) != 0 {
+					t.Errorf("CountDecksBySplit(%d/%d/%d)=%v; want %d", lands, creatures, others, got, want)
+				}
+			}
+		}
+	}
+	if _, err := CountDecksBySplit(60, cards, "modern", 24, 22, 15); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("CountDecksBySplit(24+22+15 != 60) err=%v; want ErrDeckSize", err)
+	}
+	if _, err := CountDecksBySplit(1, cards, "modern", 2, -1, 0); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("CountDecksBySplit(2/-1/0) err=%v; want ErrDeckSize", err)
+	}
+	// Creatures are found by card type, from mtgjson's types if it has them.
+	cards = map[string]Card{"Grizzly Bears": {Name: "Grizzly Bears", Types: []string{"Creature"}, Legalities: legal}}
+	if got, err := CountDecksBySplit(2, cards, "modern", 0, 2, 0); err != nil || got.Int64() != 1 {
+		t.Errorf("CountDecksBySplit(0/2/0, types only)=%v, %v; want 1", got, err)
+	}
+}
+
+func TestWalkCards(t *testing.T) {
+	for _, name := range []string{"testdata/bench.json", "testdata/flat.json", "testdata/wrapped.json", "testdata/atomic.json"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cards, err := ParseCards(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		visits := map[string]int{}
+		err = WalkCards(bytes.NewReader(data), func(c Card) error {
+			visits[c.Name]++
+			if !reflect.DeepEqual(c, cards[c.Name]) {
+				t.Errorf("%s: WalkCards visited %+v; want %+v", name, c, cards[c.Name])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("WalkCards(%s) error: %v", name, err)
+		}
+		for n := range cards {
+			if visits[n] != 1 {
+				t.Errorf("WalkCards(%s) visited %q %d times; want once", name, n, visits[n])
+			}
+		}
+		if len(visits) != len(cards) {
+			t.Errorf("WalkCards(%s) visited %d cards; want %d", name, len(visits), len(cards))
+		}
+	}
+	stop := errors.New("stop")
+	n := 0
+	err := WalkCards(bytes.NewReader(sampleJSON), func(Card) error { n++; return stop })
+	if err != stop || n != 1 {
+		t.Errorf("WalkCards(fn fails) visited %d cards and returned %v; want 1, %v", n, err, stop)
+	}
+	if err := WalkCards(strings.NewReader(`[]`), func(Card) error { return nil }); !errors.Is(err, ErrSchema) {
+		t.Errorf("WalkCards(array) error=%v; want %v", err, ErrSchema)
+	}
+}
+
+func TestCountDecksByTypes(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Island":            {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Dryad Arbor":       {Name: "Dryad Arbor", Type: "Land Creature — Forest Dryad", Legalities: legal},
+		"Llanowar Elves":    {Name: "Llanowar Elves", Type: "Creature — Elf Druid", Types: []string{"Creature"}, Legalities: legal},
+		"Tarmogoyf":         {Name: "Tarmogoyf", Type: "Creature — Lhurgoyf", Legalities: legal},
+		"Opt":               {Name: "Opt", Type: "Instant", Legalities: legal},
+		"Ornithopter":       {Name: "Ornithopter", Type: "Artifact Creature — Thopter", Legalities: legal},
+		"Sol Ring":          {Name: "Sol Ring", Type: "Artifact", Legalities: map[string]string{"modern": "Banned"}},
+		"Ghostly Prison":    {Name: "Ghostly Prison", Type: "Enchantment", Legalities: legal},
+		"Force of Negation": {Name: "Force of Negation", Type: "Instant", Legalities: legal},
+	}
+	// The pool, in order: Island, Dryad Arbor, the three other creatures,
+	// and the three others.
+	limit := []int{1000, 4, 4, 4, 4, 4, 4, 4}
+	isLand := []bool{true, true, false, false, false, false, false, false}
+	isCreature := []bool{false, true, true, true, true, false, false, false}
+	cases := []struct {
+		ranges []TypeRange
+		ok     func(lands, creatures int) bool
+	}{
+		{[]TypeRange{{"Land", 2, 4}}, func(l, c int) bool { return l >= 2 && l <= 4 }},
+		{[]TypeRange{{"land", 3, 3}, {"Creature", 0, 2}}, func(l, c int) bool { return l == 3 && c <= 2 }},
+		{[]TypeRange{{"Creature", 1, 6}, {"Land", 0, 2}}, func(l, c int) bool { return c >= 1 && l <= 2 }},
+		{nil, func(l, c int) bool { return true }},
+	}
+	for _, c := range cases {
+		// A card counts toward the first range's type it has.
+		landFirst := len(c.ranges) == 0 || strings.EqualFold(c.ranges[0].Type, "Land")
+		want := int64(0)
+		EnumerateDecks(6, 2, limit, func(main, side []int) {
+			lands, creatures := 0, 0
+			for i, n := range main {
+				switch {
+				case isLand[i] && (landFirst || !isCreature[i]):
+					lands += n
+				case isCreature[i]:
+					creatures += n
+				}
+			}
+			if c.ok(lands, creatures) {
+				want++
+			}
+		})
+		got, err := CountDecksByTypes(6, 2, cards, "modern", c.ranges)
+		if err != nil || got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksByTypes(%v)=%v, %v; want %d", c.ranges, got, err, want)
+		}
+	}
+	// An exact split is CountDecksBySplit's.
+	want, err := CountDecksBySplit(7, cards, "modern", 3, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := CountDecksByTypes(7, 0, cards, "modern", []TypeRange{{"Land", 3, 3}, {"Creature", 2, 2}})
+	if err != nil || got.Cmp(want) != 0 {
+		t.Errorf("CountDecksByTypes(7, 0, 3 lands, 2 creatures)=%v, %v; want CountDecksBySplit's %v", got, err, want)
+	}
+	for _, ranges := range [][]TypeRange{{{"Land", 3, 2}}, {{"Land", -1, 2}}, {{"Land", 1, 2}, {"LAND", 0, 3}}} {
+		if _, err := CountDecksByTypes(6, 2, cards, "modern", ranges); !errors.Is(err, ErrBadTypeRange) {
+			t.Errorf("CountDecksByTypes(%v) err=%v; want ErrBadTypeRange", ranges, err)
+		}
+	}
+}
+
+func TestCountDecksByCurve(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Island":          {Name: "Island", Type: "Basic Land — Island", Legalities: legal},
+		"Mutavault":       {Name: "Mutavault", Type: "Land", Legalities: legal},
+		"Ornithopter":     {Name: "Ornithopter", Type: "Artifact Creature — Thopter", Legalities: legal},
+		"Opt":             {Name: "Opt", Type: "Instant", ConvertedManaCost: 1, Legalities: legal},
+		"Lightning Bolt":  {Name: "Lightning Bolt", Type: "Instant", ConvertedManaCost: 1, Legalities: legal},
+		"Counterspell":    {Name: "Counterspell", Type: "Instant", ConvertedManaCost: 2, Legalities: legal},
+		"Fact or Fiction": {Name: "Fact or Fiction", Type: "Instant", ConvertedManaCost: 4, Legalities: legal},
+		"Emrakul":         {Name: "Emrakul", Type: "Legendary Creature — Eldrazi", ConvertedManaCost: 15, Legalities: legal},
+		"Sol Ring":        {Name: "Sol Ring", Type: "Artifact", ConvertedManaCost: 1, Legalities: map[string]string{"modern": "Banned"}},
+	}
+	// The pool, in order, with each card's mana value, or -1 for lands.
+	limit := []int{1000, 4, 4, 4, 4, 4, 4, 4}
+	value := []int{-1, -1, 0, 1, 1, 2, 4, 15}
+	cases := []struct {
+		ranges []CurveRange
+		ok     func(byValue map[int]int) bool
+	}{
+		{[]CurveRange{{1, 1, 2, 6}}, func(v map[int]int) bool { return v[1] >= 2 }},
+		{[]CurveRange{{0, 1, 1, 3}, {4, -1, 0, 1}}, func(v map[int]int) bool {
+			return v[0]+v[1] >= 1 && v[0]+v[1] <= 3 && v[4]+v[15] <= 1
+		}},
+		{[]CurveRange{{2, 15, 3, 3}}, func(v map[int]int) bool { return v[2]+v[4]+v[15] == 3 }},
+		{nil, func(map[int]int) bool { return true }},
+	}
+	for _, c := range cases {
+		want := int64(0)
+		EnumerateDecks(6, 2, limit, func(main, side []int) {
+			byValue := map[int]int{}
+			for i, n := range main {
+				byValue[value[i]] += n
+			}
+			if c.ok(byValue) {
+				want++
+			}
+		})
+		got, err := CountDecksByCurve(6, 2, cards, "modern", c.ranges)
+		if err != nil || got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("CountDecksByCurve(%v)=%v, %v; want %d", c.ranges, got, err, want)
+		}
+	}
+	for _, ranges := range [][]CurveRange{
+		{{1, 1, 3, 2}}, {{1, 1, -1, 2}}, {{3, 2, 0, 2}}, {{-1, 1, 0, 2}},
+		{{1, 2, 0, 2}, {2, 2, 0, 3}}, {{5, -1, 0, 2}, {1, 6, 0, 3}},
+	} {
+		if _, err := CountDecksByCurve(6, 2, cards, "modern", ranges); !errors.Is(err, ErrBadCurveRange) {
+			t.Errorf("CountDecksByCurve(%v) err=%v; want ErrBadCurveRange", ranges, err)
+		}
+	}
+	if got := (CurveRange{5, -1, 0, 4}).String(); got != "5+: 0-4" {
+		t.Errorf("CurveRange.String()=%q; want %q", got, "5+: 0-4")
+	}
+}
+
+func TestCountDecksColorLockedSideboard(t *testing.T) {
+	legal := map[string]string{"modern": "Legal"}
+	cards := map[string]Card{
+		"Opt":             {Name: "Opt", Legalities: legal, ColorIdentity: []string{"U"}},
+		"Lightning Bolt":  {Name: "Lightning Bolt", Legalities: legal, ColorIdentity: []string{"R"}},
+		"Lightning Helix": {Name: "Lightning Helix", Legalities: legal, ColorIdentity: []string{"R", "W"}},
+		"Ornithopter":     {Name: "Ornithopter", Legalities: legal},
+		"Ponder":          {Name: "Ponder", Legalities: map[string]string{"modern": "Restricted"}, ColorIdentity: []string{"U"}},
+	}
+	limit := []int{4, 4, 4, 4, 1} // Opt, Bolt, Helix, Ornithopter, Ponder.
+	// Their identities, as bits: U, R, W.
+	identity := []int{1, 2, 2 | 4, 0, 1}
+	for _, colors := range []string{"UR", "U", ""} {
+		mask := 0
+		for k, c := range "URW" {
+			if strings.ContainsRune(colors, c) {
+				mask |= 1 << k
+			}
+		}
+		for numMain := 0; numMain <= 5; numMain++ {
+			for numSide := 0; numSide <= 3; numSide++ {
+				want := int64(0)
+				EnumerateDecks(numMain, numSide, limit, func(main, side []int) {
+					mainIdentity := 0
+					for i, k := range main {
+						if k > 0 {
+							mainIdentity |= identity[i]
+						}
+					}
+					for i, k := range side {
+						if k > 0 && identity[i]&^mask != 0 {
+							return
+						}
+					}
+					if mainIdentity == mask {
+						want++
+					}
+				})
+				got := CountDecksColorLockedSideboard(numMain, numSide, cards, "modern", colors)
+				if got.Cmp(big.NewInt(want)) != 0 {
+					t.Errorf("CountDecksColorLockedSideboard(%d, %d, %q)=%v; want %d", numMain, numSide, colors, got, want)
+				}
+				if all := CountDecks(numMain, numSide, limit); got.Cmp(all) > 0 {
+					t.Errorf("CountDecksColorLockedSideboard(%d, %d, %q)=%v > CountDecks()=%v", numMain, numSide, colors, got, all)
+				}
+			}
+		}
+	}
+	// An off-color main deck card rules a deck out: of the one-card main
+	// decks, only Opt and Ponder are mono-blue, not Helix.
+	if got := CountDecksColorLockedSideboard(1, 0, cards, "modern", "U"); got.Int64() != 2 {
+		t.Errorf("CountDecksColorLockedSideboard(1, 0, U)=%v; want 2", got)
+	}
+}
+
+func TestCountDecksByClass(t *testing.T) {
+	if got, want := LimitClasses(3, 1, []int{4, 1, 0, 4, 1000, 75}), map[int]int{1: 1, 4: 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LimitClasses(3, 1)=%v; want %v", got, want)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 30; i++ {
+		classes := map[int]int{}
+		limit := []int{}
+		for j := rng.Intn(4); j >= 0; j-- {
+			lim, n := []int{1, 2, 4, 7, 9, 1000}[rng.Intn(6)], rng.Intn(300)
+			classes[lim] += n
+			for k := 0; k < n; k++ {
+				limit = append(limit, lim)
+			}
+		}
+		numMain, numSide := rng.Intn(20), rng.Intn(8)
+		got := CountDecksByClass(numMain, numSide, classes)
+		want := CountDecksProgress(numMain, numSide, limit, func(int, int) {})
+		if got.Cmp(want) != 0 {
+			t.Errorf("CountDecksByClass(%d, %d, %v)=%v; want %v", numMain, numSide, classes, got, want)
+		}
+	}
+	if got := CountDecksByClass(0, 0, nil); got.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("CountDecksByClass(0, 0, nil)=%v; want 1", got)
+	}
+	if got := CountDecksByClass(1, 0, map[int]int{4: 0}); got.Sign() != 0 {
+		t.Errorf("CountDecksByClass(1, 0, no cards)=%v; want 0", got)
+	}
+}
+
+func TestMemo(t *testing.T) {
+	if got, want := Fingerprint(60, 15, map[int]int{4: 18000, 1: 40, 7: 0}), "60+15:1x40,4x18000"; got != want {
+		t.Errorf("Fingerprint()=%q; want %q", got, want)
+	}
+	// Limits past the deck size count the same, so they share a fingerprint.
+	if a, b := Fingerprint(3, 1, LimitClasses(3, 1, []int{4, 1000, 0})), Fingerprint(3, 1, LimitClasses(3, 1, []int{4, 4})); a != b {
+		t.Errorf("Fingerprint(4, 1000, 0)=%q; want Fingerprint(4, 4)=%q", a, b)
+	}
+	memo := NewMemo()
+	saved := defaults
+	defer func() { defaults = saved }()
+	SetDefaults(WithMemo(memo))
+	limit := []int{1, 2, 3}
+	want := CountDecks(3, 1, limit)
+	if memo.Len() != 1 {
+		t.Fatalf("after CountDecks, memo has %d counts; want 1", memo.Len())
+	}
+	// A count in the memo is served from it, whichever counter asks.
+	fp := Fingerprint(3, 1, LimitClasses(3, 1, limit))
+	memo.Put(fp, big.NewInt(99))
+	if got := CountDecksProgress(3, 1, limit, func(int, int) {}); got.Int64() != 99 {
+		t.Errorf("CountDecksProgress with a memo=%v; want 99", got)
+	}
+	if got, err := CountLimits(limit, DeckSpec{Main: 3, Side: 1}); err != nil || got.Int64() != 99 {
+		t.Errorf("CountLimits with a memo=%v, %v; want 99", got, err)
+	}
+	memo.Put(fp, want)
+	var buf bytes.Buffer
+	if err := WriteMemo(&buf, memo); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMemo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := read.Get(fp); !ok || got.Cmp(want) != 0 {
+		t.Errorf("ReadMemo(WriteMemo()).Get()=%v, %v; want %v, true", got, ok, want)
+	}
+	// Another version's counts are dropped; a malformed file is an error.
+	if m, err := ReadMemo(strings.NewReader(`{"version": 0, "counts": {"3+1:1x1": "4"}}`)); err != nil || m.Len() != 0 {
+		t.Errorf("ReadMemo(version 0) has %d counts, %v; want none", m.Len(), err)
+	}
+	if _, err := ReadMemo(strings.NewReader(`{"version": 1, "counts": {"3+1:1x1": "four"}}`)); !errors.Is(err, ErrSchema) {
+		t.Errorf("ReadMemo(bad count) err=%v; want ErrSchema", err)
+	}
+}
+
+func TestCountDecksByDistinct(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		numMain, numSide := rng.Intn(6), rng.Intn(3)
+		limit := make([]int, rng.Intn(6))
+		for i := range limit {
+			limit[i] = 1 + rng.Intn(5)
+		}
+		want := make([]int64, len(limit)+1)
+		EnumerateDecks(numMain, numSide, limit, func(main, side []int) {
+			k := 0
+			for i := range main {
+				if main[i]+side[i] > 0 {
+					k++
+				}
+			}
+			want[k]++
+		})
+		got := CountDecksByDistinct(numMain, numSide, limit)
+		for k, c := range got {
+			if c.Cmp(big.NewInt(want[k])) != 0 {
+				t.Errorf("CountDecksByDistinct(%d, %d, %v)[%d]=%v; want %d", numMain, numSide, limit, k, c, want[k])
+			}
+		}
+		for k := len(got); k < len(want); k++ {
+			if want[k] != 0 {
+				t.Errorf("CountDecksByDistinct(%d, %d, %v) has no element %d; want %d", numMain, numSide, limit, k, want[k])
+			}
+		}
+	}
+	// 75 cards at up to 4 copies each take at least 19 names.
+	limit := make([]int, 20)
+	for i := range limit {
+		limit[i] = 4
+	}
+	got := CountDecksByDistinct(60, 15, limit)
+	if got[18].Sign() != 0 || got[19].Sign() == 0 {
+		t.Errorf("CountDecksByDistinct(60, 15, 20 cards at 4)[18:20]=%v; want 0 and more", got[18:20])
+	}
+	sum := new(big.Int)
+	for _, c := range got {
+		sum.Add(sum, c)
+	}
+	if want := CountDecks(60, 15, limit); sum.Cmp(want) != 0 {
+		t.Errorf("CountDecksByDistinct(60, 15, 20 cards at 4) adds up to %v; want %v", sum, want)
+	}
+}
+
+func TestWithParallelism(t *testing.T) {
+	seen := make([]int, 100)
+	parallel(len(seen), 8, func(i int) { seen[i]++ })
+	for i, n := range seen {
+		if n != 1 {
+			t.Errorf("parallel called fn(%d) %d times; want once", i, n)
+		}
+	}
+	classes := map[int]int{1: 30, 4: 500, 7: 1, 75: 5}
+	want := CountDecksByClass(60, 15, classes)
+	saved := defaults
+	defer func() { defaults = saved }()
+	SetDefaults(WithParallelism(4))
+	if got := CountDecksByClass(60, 15, classes); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksByClass with WithParallelism(4)=%v; want %v", got, want)
+	}
+}
+
+func TestCountDecksGeneratingFunction(t *testing.T) {
+	// CountDecksSideLimits, with equal limits, counts the same decks by
+	// recursing over the cards.
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "bench.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := FormatLimits(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"standard", "modern", "legacy", "vintage"} {
+		got := CountDecks(60, 15, limits[f])
+		want, err := CountDecksSideLimits(60, 15, limits[f], limits[f])
+		if err != nil || got.Cmp(want) != 0 {
+			t.Errorf("CountDecks(%s)=%v; want %v", f, got, want)
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		limit := []int{}
+		for j := rng.Intn(8); j >= 0; j-- {
+			limit = append(limit, []int{1, 2, 4, 7, 8, 1000}[rng.Intn(6)])
+		}
+		numMain, numSide := rng.Intn(12), rng.Intn(6)
+		got := CountDecks(numMain, numSide, limit)
+		want, err := CountDecksSideLimits(numMain, numSide, limit, limit)
+		if err != nil || got.Cmp(want) != 0 {
+			t.Errorf("CountDecks(%d, %d, %v)=%v; want %v", numMain, numSide, limit, got, want)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	cases := []struct {
+		numMain, numSide int
+		limit            []int
+	}{
+		{3, 1, []int{1, 2, 3}},
+		{4, 2, []int{1, 1, 2, 4, 4, 75}},
+		{5, 0, []int{4, 4, 4}},
+	}
+	for _, c := range cases {
+		named := []NamedLimit{}
+		for i, lim := range c.limit {
+			named = append(named, NamedLimit{fmt.Sprint("card", i), lim})
+		}
+		seen := map[string]int{}
+		EnumerateDecks(c.numMain, c.numSide, c.limit, func(main, side []int) {
+			seen[fmt.Sprint(main, side)] = 0
+		})
+		sp, err := NewSampler(c.numMain, c.numSide, named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sp.Count(); got.Cmp(big.NewInt(int64(len(seen)))) != 0 {
+			t.Errorf("NewSampler(%d, %d, %v).Count()=%v; want %d", c.numMain, c.numSide, c.limit, got, len(seen))
+		}
+		rng := rand.New(rand.NewSource(1))
+		const perDeck = 300
+		for n := 0; n < perDeck*len(seen); n++ {
+			deck := sp.Sample(rng)
+			main, side := make([]int, len(named)), make([]int, len(named))
+			for i, nl := range named {
+				main[i], side[i] = deck.Main[nl.Name], deck.Side[nl.Name]
+			}
+			key := fmt.Sprint(main, side)
+			if _, ok := seen[key]; !ok {
+				t.Fatalf("Sample(%d, %d, %v)=%v, which CountDecks doesn't count", c.numMain, c.numSide, c.limit, key)
+			}
+			seen[key]++
+		}
+		// Each deck's count is binomial, with a standard deviation under 18.
+		for key, n := range seen {
+			if n < perDeck-100 || n > perDeck+100 {
+				t.Errorf("Sample(%d, %d, %v) drew %s %d times in %d; want about %d", c.numMain, c.numSide, c.limit, key, n, perDeck*len(seen), perDeck)
+			}
+		}
+	}
+	if _, err := NewSampler(10, 0, []NamedLimit{{"Island", 4}}); !errors.Is(err, ErrNoDecks) {
+		t.Errorf("NewSampler(10 cards of 4 Islands) err=%v; want ErrNoDecks", err)
+	}
+}
+
+func TestRankDeck(t *testing.T) {
+	cases := []struct {
+		numMain, numSide int
+		limit            []int
+	}{
+		{3, 1, []int{1, 2, 3}},
+		{4, 2, []int{1, 1, 2, 4, 4, 75}},
+		{2, 2, []int{1, 1, 1, 1, 1}},
+	}
+	for _, c := range cases {
+		named := []NamedLimit{}
+		for i, lim := range c.limit {
+			named = append(named, NamedLimit{fmt.Sprint("card", i), lim})
+		}
+		sp, err := NewSampler(c.numMain, c.numSide, named)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranked := map[int64]bool{}
+		EnumerateDecks(c.numMain, c.numSide, c.limit, func(main, side []int) {
+			deck := Deck{Main: map[string]int{}, Side: map[string]int{}}
+			for i, nl := range named {
+				if main[i] > 0 {
+					deck.Main[nl.Name] = main[i]
+				}
+				if side[i] > 0 {
+					deck.Side[nl.Name] = side[i]
+				}
+			}
+			r, err := sp.RankDeck(deck)
+			if err != nil {
+				t.Fatalf("RankDeck(%v): %v", deck, err)
+			}
+			if r.Sign() < 0 || r.Cmp(sp.Count()) >= 0 || ranked[r.Int64()] {
+				t.Errorf("RankDeck(%v)=%v, out of range or repeated", deck, r)
+			}
+			ranked[r.Int64()] = true
+			if got, err := sp.UnrankDeck(r); err != nil || !reflect.DeepEqual(got, deck) {
+				t.Errorf("UnrankDeck(%v)=%v, %v; want %v", r, got, err, deck)
+			}
+		})
+	}
+	// A pool the size of a format's, drawn from rather than enumerated.
+	named := []NamedLimit{}
+	for i, n := range map[int]int{1: 40, 4: 3000, 1000: 5} {
+		for j := 0; j < n; j++ {
+			named = append(named, NamedLimit{fmt.Sprint(i, "/", j), i})
+		}
+	}
+	sp, err := NewSampler(60, 15, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		deck := sp.Sample(rng)
+		r, err := sp.RankDeck(deck)
+		if err != nil {
+			t.Fatalf("RankDeck(Sample()): %v", err)
+		}
+		if got, err := sp.UnrankDeck(r); err != nil || !reflect.DeepEqual(got, deck) {
+			t.Errorf("UnrankDeck(RankDeck(%v))=%v, %v; want the same deck", deck, got, err)
+		}
+	}
+	errCases := []struct {
+		deck Deck
+		want error
+	}{
+		{Deck{Main: map[string]int{"1/0": 2, "4/0": 58}, Side: map[string]int{"4/1": 15}}, ErrNotCounted},
+		{Deck{Main: map[string]int{"1000/0": 60}, Side: map[string]int{"Black Lotus": 15}}, ErrNotCounted},
+		{Deck{Main: map[string]int{"1000/0": 59}, Side: map[string]int{"1000/1": 15}}, ErrNotCounted},
+	}
+	for _, c := range errCases {
+		if _, err := sp.RankDeck(c.deck); !errors.Is(err, c.want) {
+			t.Errorf("RankDeck(%v) err=%v; want %v", c.deck, err, c.want)
+		}
+	}
+	for _, n := range []*big.Int{big.NewInt(-1), sp.Count()} {
+		if _, err := sp.UnrankDeck(n); !errors.Is(err, ErrRank) {
+			t.Errorf("UnrankDeck(%v) err=%v; want ErrRank", n, err)
+		}
+	}
+}
+
+func TestDeckIterator(t *testing.T) {
+	named := []NamedLimit{{"a", 1}, {"b", 2}, {"c", 3}}
+	sp, err := NewSampler(3, 1, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Deck
+	for it := sp.Decks(); ; {
+		deck, ok := it.Next()
+		if !ok {
+			break
+		}
+		all = append(all, deck)
+	}
+	if int64(len(all)) != sp.Count().Int64() {
+		t.Fatalf("Decks() gave %d decks; want %v", len(all), sp.Count())
+	}
+	for i, deck := range all {
+		if r, err := sp.RankDeck(deck); err != nil || r.Int64() != int64(i) {
+			t.Errorf("deck %d from Decks() has RankDeck()=%v, %v; want %d", i, r, err, i)
+		}
+	}
+	cases := []struct {
+		skips []int64
+		want  int64 // The Rank after the skips, and the deck Next returns, or -1.
+	}{
+		{[]int64{5}, 5},
+		{[]int64{5, -2}, 3},
+		{[]int64{3, -10}, 0},
+		{[]int64{11}, 11},
+		{[]int64{12}, -1},
+		{[]int64{100, -95}, 5},
+	}
+	for _, c := range cases {
+		it := sp.Decks()
+		for _, n := range c.skips {
+			it.Skip(big.NewInt(n))
+		}
+		deck, ok := it.Next()
+		switch {
+		case c.want < 0 && ok:
+			t.Errorf("after Skip(%v), Next()=%v, true; want false", c.skips, deck)
+		case c.want >= 0 && (!ok || !reflect.DeepEqual(deck, all[c.want])):
+			t.Errorf("after Skip(%v), Next()=%v, %v; want deck %d, %v", c.skips, deck, ok, c.want, all[c.want])
+		case c.want >= 0 && it.Rank().Int64() != c.want+1:
+			t.Errorf("after Skip(%v) and Next(), Rank()=%v; want %d", c.skips, it.Rank(), c.want+1)
+		}
+	}
+}
+
+func TestCountSideboards(t *testing.T) {
+	limit := []NamedLimit{{"Black Lotus", 1}, {"Island", 1000}, {"Opt", 4}, {"Time Walk", 1}}
+	cases := []struct {
+		main    map[string]int
+		numSide int
+		want    int64
+	}{
+		// Nothing used: 2 cards from Island, Opt, and two singletons.
+		{map[string]int{}, 2, 8},
+		// Black Lotus is maxed in the main deck, and only one Opt is left:
+		// two of Island, Opt, and Time Walk, or two Islands.
+		{map[string]int{"Black Lotus": 1, "Opt": 3, "Island": 56}, 2, 4},
+		{map[string]int{"Black Lotus": 1, "Opt": 4, "Time Walk": 1}, 3, 1},
+	}
+	for _, c := range cases {
+		got, err := CountSideboards(Deck{Main: c.main}, c.numSide, limit)
+		if err != nil || got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountSideboards(%v, %d)=%v, %v; want %d", c.main, c.numSide, got, err, c.want)
+		}
+	}
+	// An illegal main deck has no sideboards.
+	for _, main := range []map[string]int{{"Opt": 5}, {"Black Lotus": 2}, {"Mox Pearl": 1}} {
+		if _, err := CountSideboards(Deck{Main: main}, 2, limit); !errors.Is(err, ErrBadDecklist) {
+			t.Errorf("CountSideboards(%v) err=%v; want ErrBadDecklist", main, err)
+		}
+	}
+	// Plain vectors, in limit's order.
+	if got, err := CountSideboardLimits([]int{1, 56, 3, 0}, 2, []int{1, 1000, 4, 1}); err != nil || got.Cmp(big.NewInt(4)) != 0 {
+		t.Errorf("CountSideboardLimits()=%v, %v; want 4", got, err)
+	}
+	if _, err := CountSideboardLimits([]int{5}, 2, []int{4}); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("CountSideboardLimits([5], [4]) err=%v; want ErrBadDecklist", err)
+	}
+	if _, err := CountSideboardLimits([]int{1}, 2, []int{4, 4}); !errors.Is(err, ErrBadLimits) {
+		t.Errorf("CountSideboardLimits([1], [4 4]) err=%v; want ErrBadLimits", err)
+	}
+}
+
+func TestAverageCMC(t *testing.T) {
+	data := []byte(`{
+		"Lightning Bolt": {"name": "Lightning Bolt", "type": "Instant", "convertedManaCost": 1.0},
+		"Lightning Helix": {"name": "Lightning Helix", "type": "Instant", "convertedManaCost": 2.0},
+		"Boros Charm": {"name": "Boros Charm", "type": "Instant", "convertedManaCost": 2.0},
+		"Ajani Vengeant": {"name": "Ajani Vengeant", "type": "Legendary Planeswalker — Ajani", "convertedManaCost": 4.0},
+		"Sacred Foundry": {"name": "Sacred Foundry", "type": "Land — Mountain Plains"},
+		"Mountain": {"name": "Mountain", "type": "Basic Land — Mountain"}
+	}`)
+	cards, err := ParseCards(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		main map[string]int
+		want float64
+	}{
+		// (4*1 + 4*2 + 2*2 + 2*4) / 12; lands don't count.
+		{map[string]int{"Lightning Bolt": 4, "Lightning Helix": 4, "Boros Charm": 2, "Ajani Vengeant": 2, "Sacred Foundry": 4, "Mountain": 16}, 2},
+		{map[string]int{"Lightning Bolt": 3, "Ajani Vengeant": 1}, 1.75},
+		{map[string]int{"Mountain": 60}, 0},
+		{map[string]int{}, 0},
+	}
+	for _, c := range cases {
+		if got := AverageCMC(Deck{Main: c.main}, cards); got != c.want {
+			t.Errorf("AverageCMC(%v)=%v; want %v", c.main, got, c.want)
+		}
+	}
+}
+
+func TestCountSealedDecks(t *testing.T) {
+	cards := map[string]Card{
+		"Shock":  {Name: "Shock"},
+		"Opt":    {Name: "Opt"},
+		"Island": {Name: "Island", Type: "Basic Land — Island"},
+	}
+	pool := map[string]int{"Shock": 2, "opt": 1, "Island": 1}
+	// Shock, Opt, and the five basics, Island among them.
+	want := bruteForce(3, []int{2, 1, 3, 3, 3, 3, 3}, func([]int) bool { return true })
+	got, err := CountSealedDecks(3, cards, pool)
+	if err != nil || got.Cmp(big.NewInt(want)) != 0 {
+		t.Errorf("CountSealedDecks(3, %v)=%v, %v; want %d", pool, got, err, want)
+	}
+	if got, err := CountSealedDecks(3, cards, map[string]int{"Black Lotus": 1}); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("CountSealedDecks(unknown card)=%v, %v; want ErrBadDecklist", got, err)
+	}
+}
+
+func TestCountDecksFromCollection(t *testing.T) {
+	cards := map[string]Card{
+		"Lightning Bolt": {Name: "Lightning Bolt", Legalities: map[string]string{"modern": "Legal"}},
+		"Opt":            {Name: "Opt", Legalities: map[string]string{"modern": "Legal"}},
+		"Splinter Twin":  {Name: "Splinter Twin", Legalities: map[string]string{"modern": "Banned"}},
+		"Mountain":       {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: map[string]string{"modern": "Legal"}},
+		"Island":         {Name: "Island", Type: "Basic Land — Island", Legalities: map[string]string{"modern": "Legal"}},
+	}
+	owned, err := ParseCollection(strings.NewReader("2 Lightning Bolt\n4 Splinter Twin\n3 Island\nSideboard\n1 Lightning Bolt\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"Lightning Bolt": 3, "Splinter Twin": 4, "Island": 3}; !reflect.DeepEqual(owned, want) {
+		t.Errorf("ParseCollection=%v; want %v", owned, want)
+	}
+	// Opt isn't owned, Splinter Twin is banned, and Mountains are unlimited.
+	got := CountDecksFromCollection(6, 2, cards, "modern", owned)
+	if want := CountDecks(6, 2, []int{3, 3, 1000}); got.Cmp(want) != 0 {
+		t.Errorf("CountDecksFromCollection=%v; want %v", got, want)
+	}
+	if all := CountDecks(6, 2, []int{4, 4, 1000, 1000}); got.Cmp(all) >= 0 {
+		t.Errorf("CountDecksFromCollection=%v; want fewer than %v", got, all)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	cards := map[string]Card{
+		"Lightning Bolt": {Name: "Lightning Bolt", Legalities: map[string]string{"modern": "Legal"}},
+		"Splinter Twin":  {Name: "Splinter Twin", Legalities: map[string]string{"modern": "Banned"}},
+		"Mountain":       {Name: "Mountain", Type: "Basic Land — Mountain", Legalities: map[string]string{"modern": "Legal"}},
+	}
+	deck := Deck{
+		Main: map[string]int{"Lightning Bolt": 4, "Splinter Twin": 1, "Mountain": 55},
+		Side: map[string]int{"Lightning Bolt": 1},
+	}
+	r := ValidateJSON(deck, cards, "modern")
+	want := []DeckIssue{
+		{Card: "Lightning Bolt", Have: 5, Max: 4, Reason: "too many copies"},
+		{Card: "Splinter Twin", Have: 1, Max: 0, Reason: "banned"},
+	}
+	if !reflect.DeepEqual(r.Issues, want) {
+		t.Errorf("ValidateJSON issues=%+v; want %+v", r.Issues, want)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"format":"modern","legal":false,"issues":[` +
+		`{"card":"Lightning Bolt","have":5,"max":4,"reason":"too many copies"},` +
+		`{"card":"Splinter Twin","have":1,"max":0,"reason":"banned"}]}`
+	if string(data) != wantJSON {
+		t.Errorf("json.Marshal(report)=%s; want %s", data, wantJSON)
+	}
+	// A legal deck has no issues, and a short one has a size issue.
+	deck = Deck{Main: map[string]int{"Lightning Bolt": 4, "Mountain": 56}}
+	if data, _ := json.Marshal(ValidateJSON(deck, cards, "modern")); string(data) != `{"format":"modern","legal":true,"issues":[]}` {
+		t.Errorf("json.Marshal(legal report)=%s", data)
+	}
+	deck = Deck{Main: map[string]int{"Mountain": 40}}
+	want = []DeckIssue{{Have: 40, Max: 60, Reason: "main deck has fewer than 60 cards"}}
+	if r := ValidateJSON(deck, cards, "modern"); !reflect.DeepEqual(r.Issues, want) {
+		t.Errorf("ValidateJSON(40 cards) issues=%+v; want %+v", r.Issues, want)
+	}
+
+	// Restricted cards are allowed a copy.
+	cards["Lightning Bolt"] = Card{Name: "Lightning Bolt", Legalities: map[string]string{"modern": "Restricted"}}
+	deck = Deck{Main: map[string]int{"Lightning Bolt": 2, "Mountain": 58}}
+	want = []DeckIssue{{Card: "Lightning Bolt", Have: 2, Max: 1, Reason: "restricted"}}
+	if r := ValidateJSON(deck, cards, "modern"); !reflect.DeepEqual(r.Issues, want) {
+		t.Errorf("ValidateJSON(restricted) issues=%+v; want %+v", r.Issues, want)
+	}
+	// A rebalanced card is Legal on paper but not outside digital formats.
+	cards["A-Opt"] = Card{Name: "A-Opt", Legalities: map[string]string{"modern": "Legal"}}
+	deck = Deck{Main: map[string]int{"A-Opt": 1, "Mountain": 59}}
+	want = []DeckIssue{{Card: "A-Opt", Have: 1, Max: 0, Reason: "not legal"}}
+	if r := ValidateJSON(deck, cards, "modern"); !reflect.DeepEqual(r.Issues, want) {
+		t.Errorf("ValidateJSON(A-Opt) issues=%+v; want %+v", r.Issues, want)
+	}
+}
+
+func TestValidateCompanion(t *testing.T) {
+	cards := companionPool("Lurrus of the Dream-Den", "Yorion, Sky Nomad", "Umori, the Collector", "Lutri, the Spellchaser")
+	cases := []struct {
+		deck Deck
+		want []DeckIssue
+	}{
+		{
+			Deck{Main: map[string]int{"Island": 52, "Opt": 4, "Ornithopter": 4}, Side: map[string]int{"Lurrus of the Dream-Den": 1}, Companion: "Lurrus of the Dream-Den"},
+			nil,
+		},
+		{
+			Deck{Main: map[string]int{"Island": 52, "Crib Swap": 4, "Yorion, Sky Nomad": 1, "Wild Nacatl": 3}, Side: map[string]int{"Lurrus of the Dream-Den": 1}, Companion: "Lurrus of the Dream-Den"},
+			[]DeckIssue{{Card: "Yorion, Sky Nomad", Have: 1, Max: 0, Reason: "breaks Lurrus of the Dream-Den's restriction"}},
+		},
+		{
+			Deck{Main: map[string]int{"Island": 56, "Opt": 4}, Side: map[string]int{"Yorion, Sky Nomad": 1}, Companion: "Yorion, Sky Nomad"},
+			[]DeckIssue{{Have: 60, Max: 80, Reason: "main deck has fewer than 80 cards"}},
+		},
+		{
+			Deck{Main: map[string]int{"Island": 56, "Opt": 3, "Counterspell": 1}, Side: map[string]int{"Lutri, the Spellchaser": 1}, Companion: "Lutri, the Spellchaser"},
+			[]DeckIssue{{Card: "Opt", Have: 3, Max: 1, Reason: "breaks Lutri, the Spellchaser's restriction"}},
+		},
+		{
+			Deck{Main: map[string]int{"Island": 52, "Opt": 4, "Aether Vial": 4}, Side: map[string]int{"Umori, the Collector": 1}, Companion: "Umori, the Collector"},
+			[]DeckIssue{{Have: 2, Reason: "nonland cards share no card type, breaking Umori, the Collector's restriction"}},
+		},
+		{
+			Deck{Main: map[string]int{"Island": 60}, Companion: "Lurrus of the Dream-Den"},
+			[]DeckIssue{{Card: "Lurrus of the Dream-Den", Max: 1, Reason: "companion isn't in the sideboard"}},
+		},
+		{
+			Deck{Main: map[string]int{"Island": 60}, Side: map[string]int{"Opt": 1}, Companion: "Opt"},
+			[]DeckIssue{{Card: "Opt", Reason: "not a companion"}},
+		},
+	}
+	for _, c := range cases {
+		if r := ValidateJSON(c.deck, cards, "modern"); !reflect.DeepEqual(r.Issues, c.want) {
+			t.Errorf("ValidateJSON(%v) issues=%+v; want %+v", c.deck, r.Issues, c.want)
+		}
+	}
+}
+
+func TestLimitsJSON(t *testing.T) {
+	cards, err := ParseCards([]byte(sampleJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := map[string][]NamedLimit{"modern": NamedLimits(cards, "modern"), "legacy": NamedLimits(cards, "legacy")}
+	var buf bytes.Buffer
+	if err := WriteLimitsJSON(&buf, formats); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLimitsJSON(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("ValidateLimitsJSON(WriteLimitsJSON output): %v", err)
+	}
+	got, err := ReadLimitsJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, formats) {
+		t.Errorf("ReadLimitsJSON(WriteLimitsJSON(%v))=%v", formats, got)
+	}
+
+	bad := []string{
+		`{"version": 2, "formats": {}}`,
+		`{"formats": {}}`,
+		`{"version": 1}`,
+		`{"version": 1, "formats": {"modern": [{"name": "Opt", "limit": 4}, {"name": "Opt", "limit": 1}]}}`,
+		`{"version": 1, "formats": {"modern": [{"name": "Opt", "limit": -1}]}}`,
+		`{"version": 1, "formats": {"modern": [{"limit": 4}]}}`,
+		`{"version": 1, "formats": {"modern": [{"name": "Opt", "limit": 4, "status": "Legal"}]}}`,
+		`[]`,
+	}
+	for _, b := range bad {
+		if err := ValidateLimitsJSON(strings.NewReader(b)); !errors.Is(err, ErrSchema) {
+			t.Errorf("ValidateLimitsJSON(%s)=%v; want ErrSchema", b, err)
+		}
+	}
+	if err := ValidateLimitsJSON(strings.NewReader(`{"version": 1, "formats": {"pauper": []}}`)); err != nil {
+		t.Errorf("ValidateLimitsJSON(empty format): %v", err)
+	}
+}
+
+func TestCommandZonePairs(t *testing.T) {
+	legal := map[string]string{"commander": "Legal"}
+	cards := map[string]Card{
+		"Pir, Imaginative Rascal": {Name: "Pir, Imaginative Rascal", Type: "Legendary Creature — Human",
+			Keywords: []string{"Partner with"}, ColorIdentity: []string{"G"},
+			Text: "Partner with Toothy, Imaginative Friend (When this creature enters the battlefield, target player may put Toothy into their hand from their library, then shuffle.)\nIf one or more counters would be put on a permanent your team controls, that many plus one of each of those kinds of counters are put on that permanent instead."},
+		"Toothy, Imaginative Friend": {Name: "Toothy, Imaginative Friend", Type: "Legendary Creature — Illusion",
+			Keywords: []string{"Partner with"}, ColorIdentity: []string{"U"},
+			Text: "Partner with Pir, Imaginative Rascal\nWhenever you draw a card, put a +1/+1 counter on Toothy, Imaginative Friend."},
+		"Tymna the Weaver": {Name: "Tymna the Weaver", Type: "Legendary Creature — Human Cleric",
+			Keywords: []string{"Lifelink", "Partner"}, ColorIdentity: []string{"W"}},
+		"Kraum, Ludevic's Opus": {Name: "Kraum, Ludevic's Opus", Type: "Legendary Creature — Zombie Horror",
+			Keywords: []string{"Flying", "Haste", "Partner"}, ColorIdentity: []string{"R"}},
+		"Will the Wise": {Name: "Will the Wise", Type: "Legendary Creature — Human Wizard",
+			Keywords: []string{"Friends forever"}, ColorIdentity: []string{"W"}},
+		"Dustin, Gadget Genius": {Name: "Dustin, Gadget Genius", Type: "Legendary Creature — Human Artificer",
+			Keywords: []string{"Friends forever"}, ColorIdentity: []string{"U"}},
+		"Wilson, Refined Grizzly": {Name: "Wilson, Refined Grizzly", Type: "Legendary Creature — Bear Warrior",
+			Keywords: []string{"Choose a Background"}, ColorIdentity: []string{"G"}},
+		"Raised by Giants": {Name: "Raised by Giants", Type: "Legendary Enchantment — Background",
+			ColorIdentity: []string{"G"}},
+		"Opt":    {Name: "Opt", Type: "Instant", ColorIdentity: []string{"U"}},
+		"Island": {Name: "Island", Type: "Basic Land — Island", ColorIdentity: []string{"U"}},
+		"Forest": {Name: "Forest", Type: "Basic Land — Forest", ColorIdentity: []string{"G"}},
+	}
+	for name, c := range cards {
+		c.Legalities = legal
+		cards[name] = c
+	}
+	if got, want := cards["Pir, Imaginative Rascal"].PartnersWith(), "Toothy, Imaginative Friend"; got != want {
+		t.Errorf("PartnersWith()=%q; want %q", got, want)
+	}
+	if got := cards["Tymna the Weaver"].PartnersWith(); got != "" {
+		t.Errorf("Tymna PartnersWith()=%q; want \"\"", got)
+	}
+	got := []string{}
+	for _, pair := range CommandZonePairs(cards, "commander") {
+		got = append(got, pair[0].Name+" + "+pair[1].Name)
+	}
+	want := []string{
+		"Dustin, Gadget Genius + Will the Wise",
+		"Kraum, Ludevic's Opus + Tymna the Weaver",
+		"Pir, Imaginative Rascal + Toothy, Imaginative Friend",
+		"Raised by Giants + Wilson, Refined Grizzly",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CommandZonePairs()=%q; want %q", got, want)
+	}
+
+	cases := []struct {
+		names []string
+		want  int64
+	}{
+		// 98 cards from Opt, Dustin, Wilson, Raised by Giants, Islands, and
+		// Forests: k of the four singletons and 99-k splits of the basics.
+		{[]string{"Toothy, Imaginative Friend", "Pir, Imaginative Rascal"}, 16*99 - 32},
+		// Opt, Tymna, and Toothy or not, plus Islands.
+		{[]string{"Will the Wise", "Dustin, Gadget Genius"}, 8},
+	}
+	for _, c := range cases {
+		got, err := CountDecksForCommander(cards, "commander", c.names...)
+		if err != nil {
+			t.Errorf("CountDecksForCommander(%q): %v", c.names, err)
+		} else if got.Cmp(big.NewInt(c.want)) != 0 {
+			t.Errorf("CountDecksForCommander(%q)=%v; want %d", c.names, got, c.want)
+		}
+	}
+	for _, names := range [][]string{{"Pir, Imaginative Rascal", "Tymna the Weaver"}, {"Will the Wise", "Tymna the Weaver"}, {"Will the Wise", "Will the Wise"}} {
+		if _, err := CountDecksForCommander(cards, "commander", names...); !errors.Is(err, ErrBadDecklist) {
+			t.Errorf("CountDecksForCommander(%q) error %v; want ErrBadDecklist", names, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package deckcount
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"math/rand"
+	"sort"
+)
+
+// Mulligan describes keep or mulligan decisions under the London mulligan
+// rule: draw seven cards and, after m mulligans, put m of them on the bottom
+// of the library.
+type Mulligan struct {
+	Keep         HandQuery // What a hand must meet, after the bottoming, to keep; HandSize is unused.
+	Goal         HandQuery // What the kept hand and later draws must meet by Turn; HandSize is unused.
+	MaxMulligans int       // The hand after this many mulligans is kept whatever it is.
+	Turn         int       // The turn by which to meet Goal, or 0 for the opening hand.
+	OnDraw       bool      // Whether the player draws on turn 1.
+}
+
+// draws returns the number of cards drawn after the opening hand by m's
+// Turn.
+func (m Mulligan) draws() int {
+	switch {
+	case m.Turn <= 0:
+		return 0
+	case m.OnDraw:
+		return m.Turn
+	}
+	return m.Turn - 1
+}
+
+// MulliganResult is what SimulateMulligans saw.
+type MulliganResult struct {
+	Trials int
+	Kept   []int // Kept[m] is the number of trials that kept a hand meeting Keep after m mulligans.
+	Goal   int   // The number of trials that met Goal by Turn.
+}
+
+// GoalChance returns the fraction of r's trials that met the goal, or 0 if
+// there were none.
+func (r MulliganResult) GoalChance() float64 {
+	if r.Trials <= 0 {
+		return 0
+	}
+	return float64(r.Goal) / float64(r.Trials)
+}
+
+// mulliganChunk is the number of trials each of SimulateMulligans' random
+// sources runs.
+const mulliganChunk = 1 << 14
+
+// SimulateMulligans plays trials games' mulligan decisions for deck's main
+// deck under m: mulligan until a hand can keep 7-k cards meeting m.Keep
+// after k mulligans, or until k is m.MaxMulligans, then draw to m.Turn and
+// see whether the kept cards and the draws meet m.Goal.  Of the hands that
+// can keep, the cards put on the bottom are those that meet the fewest of
+// the conditions.  The conditions' cards are found as for conditionMasks.
+//
+// The trials are run in chunks of mulliganChunk, the ith of them with its
+// own random source seeded with seed+i, so the result depends on seed but
+// not on the parallelism in SetDefaults.
+func SimulateMulligans(deck Deck, cards map[string]Card, m Mulligan, trials int, seed int64) (MulliganResult, error) {
+	conds := append(append([]HandCondition{}, m.Keep.Conditions...), m.Goal.Conditions...)
+	if len(conds) > 62 {
+		return MulliganResult{}, fmt.Errorf("%w: %d conditions", ErrBadQuery, len(conds))
+	}
+	byName, err := conditionMasks(deck, cards, conds)
+	if err != nil {
+		return MulliganResult{}, err
+	}
+	names := []string{}
+	for name := range deck.Main {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	library := []int{}
+	for _, name := range names {
+		for i := 0; i < deck.Main[name]; i++ {
+			library = append(library, byName[name])
+		}
+	}
+	if need := openingHand + m.draws(); need > len(library) {
+		return MulliganResult{}, fmt.Errorf("%w: %d cards by turn %d from %d", ErrDeckSize, need, m.Turn, len(library))
+	}
+	if m.MaxMulligans < 0 || m.MaxMulligans > openingHand {
+		return MulliganResult{}, fmt.Errorf("%w: %d mulligans", ErrBadQuery, m.MaxMulligans)
+	}
+	keepBits := 1<<len(m.Keep.Conditions) - 1
+	chunks := (trials + mulliganChunk - 1) / mulliganChunk
+	results := make([]MulliganResult, chunks)
+	parallel(chunks, defaults.workers, func(i int) {
+		rng := rand.New(rand.NewSource(seed + int64(i)))
+		r := MulliganResult{Kept: make([]int, m.MaxMulligans+1)}
+		lib := append([]int{}, library...)
+		for r.Trials < mulliganChunk && i*mulliganChunk+r.Trials < trials {
+			r.Trials++
+			var kept []int
+			for k := 0; ; k++ {
+				shuffleFirst(lib, openingHand+m.draws(), rng)
+				var ok bool
+				kept, ok = keepCards(lib[:openingHand], openingHand-k, m.Keep.Conditions, keepBits)
+				if ok {
+					r.Kept[k]++
+					break
+				}
+				if k == m.MaxMulligans {
+					break
+				}
+			}
+			seen := append(kept, lib[openingHand:openingHand+m.draws()]...)
+			if meets(m.Goal.Conditions, conditionCounts(seen, len(m.Keep.Conditions), len(m.Goal.Conditions))) {
+				r.Goal++
+			}
+		}
+		results[i] = r
+	})
+	total := MulliganResult{Kept: make([]int, m.MaxMulligans+1)}
+	for _, r := range results {
+		total.Trials += r.Trials
+		total.Goal += r.Goal
+		for k, n := range r.Kept {
+			total.Kept[k] += n
+		}
+	}
+	return total, nil
+}
+
+// shuffleFirst puts n cards of lib, chosen uniformly at random by rng, in a
+// uniformly random order at its start.
+func shuffleFirst(lib []int, n int, rng *rand.Rand) {
+	for i := 0; i < n; i++ {
+		j := i + rng.Intn(len(lib)-i)
+		lib[i], lib[j] = lib[j], lib[i]
+	}
+}
+
+// keepCards returns keep of hand's cards, given as the masks of the
+// conditions they meet, that meet conds, the conditions of keepBits, and
+// whether there are any.  It prefers cards that meet more conditions, and if
+// no keep cards meet conds, it returns the keep cards that meet the most.
+func keepCards(hand []int, keep int, conds []HandCondition, keepBits int) ([]int, bool) {
+	sorted := append([]int{}, hand...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := bits.OnesCount(uint(sorted[i])), bits.OnesCount(uint(sorted[j]))
+		return a > b || a == b && sorted[i] > sorted[j]
+	})
+	// The runs of sorted cards with the same mask of keepBits, by those
+	// masks, with their lengths, and each card's run.
+	var masks, counts []int
+	run := make([]int, len(sorted))
+	for j, card := range sorted {
+		mask := card & keepBits
+		if n := len(masks); n == 0 || masks[n-1] != mask {
+			masks, counts = append(masks, mask), append(counts, 0)
+		}
+		run[j] = len(masks) - 1
+		counts[run[j]]++
+	}
+	take := make([]int, len(masks))
+	met := make([]int, len(conds))
+	var search func(i, left int) bool
+	search = func(i, left int) bool {
+		if i == len(masks) {
+			return left == 0 && meets(conds, met)
+		}
+		for n := counts[i]; n >= 0; n-- {
+			if n > left {
+				continue
+			}
+			take[i] = n
+			for k := range conds {
+				if masks[i]&(1<<k) != 0 {
+					met[k] += n
+				}
+			}
+			ok := search(i+1, left-n)
+			for k := range conds {
+				if masks[i]&(1<<k) != 0 {
+					met[k] -= n
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !search(0, keep) {
+		return sorted[:keep], false
+	}
+	kept := []int{}
+	for j, card := range sorted {
+		if take[run[j]] > 0 {
+			take[run[j]]--
+			kept = append(kept, card)
+		}
+	}
+	return kept, true
+}
+
+// conditionCounts returns the number of cards, given as the masks of the
+// conditions they meet, that meet each of n conditions from bit first.
+func conditionCounts(cards []int, first, n int) []int {
+	met := make([]int, n)
+	for _, card := range cards {
+		for k := range met {
+			if card&(1<<(first+k)) != 0 {
+				met[k]++
+			}
+		}
+	}
+	return met
+}
+
+// KeepChances returns, as element k, the exact chance that deck's main deck
+// keeps a hand meeting keep's conditions after exactly k mulligans under the
+// London rule, mulliganing at most maxMulligans times.  A seven-card hand
+// can keep after k mulligans with chance p_k, the hypergeometric sum over
+// the hands with 7-k cards that meet the conditions, so element k is p_k
+// times the chances of mulliganing each time before.
+func KeepChances(deck Deck, cards map[string]Card, keep HandQuery, maxMulligans int) ([]*big.Rat, error) {
+	byName, err := conditionMasks(deck, cards, keep.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	cells := map[int]int{}
+	size := 0
+	for name, copies := range deck.Main {
+		cells[byName[name]] += copies
+		size += copies
+	}
+	if size < openingHand {
+		return nil, fmt.Errorf("%w: a hand of %d from %d cards", ErrDeckSize, openingHand, size)
+	}
+	if maxMulligans < 0 || maxMulligans > openingHand {
+		return nil, fmt.Errorf("%w: %d mulligans", ErrBadQuery, maxMulligans)
+	}
+	hands := new(big.Int).Binomial(int64(size), openingHand)
+	all := 1<<len(keep.Conditions) - 1
+	chances := []*big.Rat{}
+	left := big.NewRat(1, 1) // The chance of getting to each mulligan.
+	for k := 0; k <= maxMulligans; k++ {
+		ways := new(big.Int)
+		forEachHand(cells, openingHand, func(masks, drawn []int, w *big.Int) {
+			hand := []int{}
+			for i, mask := range masks {
+				for j := 0; j < drawn[i]; j++ {
+					hand = append(hand, mask)
+				}
+			}
+			if _, ok := keepCards(hand, openingHand-k, keep.Conditions, all); ok {
+				ways.Add(ways, w)
+			}
+		})
+		p := new(big.Rat).SetFrac(ways, hands)
+		chances = append(chances, new(big.Rat).Mul(left, p))
+		left.Mul(left, p.Sub(big.NewRat(1, 1), p))
+	}
+	return chances, nil
+}
@@ -0,0 +1,122 @@
+package deckcount
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func mulliganDeck() (Deck, map[string]Card) {
+	cards := map[string]Card{
+		"Island":         {Name: "Island", Type: "Basic Land — Island"},
+		"Lightning Bolt": {Name: "Lightning Bolt", Type: "Instant", ConvertedManaCost: 1},
+		"Grizzly Bears":  {Name: "Grizzly Bears", Type: "Creature — Bear", ConvertedManaCost: 2},
+	}
+	return Deck{Main: map[string]int{"Island": 24, "Lightning Bolt": 4, "Grizzly Bears": 32}}, cards
+}
+
+func TestKeepChances(t *testing.T) {
+	deck, cards := mulliganDeck()
+	keep, err := ParseHandQuery("2-5 lands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := KeepChances(deck, cards, keep, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keeping 7-k cards with from 2 to 5 lands needs a seven-card hand with
+	// 2 to 5+k lands and at least 2-k other cards.
+	p := make([]*big.Rat, 3)
+	for k, query := range []string{"2-5 lands", "2-6 lands", "2-7 lands"} {
+		q, _ := ParseHandQuery(query)
+		if p[k], err = HandOdds(deck, cards, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	one := big.NewRat(1, 1)
+	miss := func(p *big.Rat) *big.Rat { return new(big.Rat).Sub(one, p) }
+	want := []*big.Rat{
+		p[0],
+		new(big.Rat).Mul(miss(p[0]), p[1]),
+		new(big.Rat).Mul(new(big.Rat).Mul(miss(p[0]), miss(p[1])), p[2]),
+	}
+	for k := range want {
+		if got[k].Cmp(want[k]) != 0 {
+			t.Errorf("KeepChances()[%d]=%v; want %v", k, got[k], want[k])
+		}
+	}
+	if _, err := KeepChances(deck, cards, keep, -1); !errors.Is(err, ErrBadQuery) {
+		t.Errorf("KeepChances(-1 mulligans) err=%v; want ErrBadQuery", err)
+	}
+}
+
+func TestSimulateMulligans(t *testing.T) {
+	deck, cards := mulliganDeck()
+	keep, _ := ParseHandQuery("2-4 lands and 1 two-drop")
+	m := Mulligan{Keep: keep, Goal: keep, MaxMulligans: 2}
+	const trials = 100000
+	got, err := SimulateMulligans(deck, cards, m, trials, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact, err := KeepChances(deck, cards, keep, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	for k, n := range got.Kept {
+		kept += n
+		want, _ := exact[k].Float64()
+		// Within about five standard deviations.
+		if frac := float64(n) / trials; math.Abs(frac-want) > 5*math.Sqrt(want*(1-want)/trials) {
+			t.Errorf("SimulateMulligans() kept %v after %d mulligans; want about %v", frac, k, want)
+		}
+	}
+	// A hand kept for meeting the goal meets it, and one kept after the last
+	// mulligan without meeting it doesn't.
+	if got.Trials != trials || got.Goal != kept {
+		t.Errorf("SimulateMulligans() met the goal %d times in %d trials; want %d in %d", got.Goal, got.Trials, kept, trials)
+	}
+
+	// The same seed gives the same result, whatever the parallelism.
+	saved := defaults
+	defer func() { defaults = saved }()
+	SetDefaults(WithParallelism(4))
+	if again, err := SimulateMulligans(deck, cards, m, trials, 1); err != nil || !reflect.DeepEqual(again, got) {
+		t.Errorf("SimulateMulligans() with WithParallelism(4)=%v, %v; want %v", again, err, got)
+	}
+
+	// By turn 3 on the draw, 10 cards are seen, so 3 lands are likelier
+	// than in the opening hand.
+	goal, _ := ParseHandQuery("3 lands")
+	opening, _ := SimulateMulligans(deck, cards, Mulligan{Keep: keep, Goal: goal, MaxMulligans: 2}, trials, 1)
+	later, _ := SimulateMulligans(deck, cards, Mulligan{Keep: keep, Goal: goal, MaxMulligans: 2, Turn: 3, OnDraw: true}, trials, 1)
+	if later.Goal <= opening.Goal {
+		t.Errorf("SimulateMulligans() met 3 lands %d times by turn 3, and %d in the opening hand; want more by turn 3", later.Goal, opening.Goal)
+	}
+
+	if got := (MulliganResult{}).GoalChance(); got != 0 {
+		t.Errorf("MulliganResult{}.GoalChance()=%v; want 0", got)
+	}
+	if _, err := SimulateMulligans(deck, cards, Mulligan{Keep: keep, Turn: 60}, 1, 1); !errors.Is(err, ErrDeckSize) {
+		t.Errorf("SimulateMulligans(turn 60) err=%v; want ErrDeckSize", err)
+	}
+}
+
+func TestKeepCards(t *testing.T) {
+	// Bits 0 and 1 are the keep conditions: a land, and a two-drop.
+	conds := []HandCondition{{2, -1, "lands"}, {1, -1, "two-drops"}}
+	land, bear, bolt := 1, 2|4, 0 // The bears also meet a goal condition.
+	hand := []int{bolt, land, bolt, bear, land, land, bolt}
+	got, ok := keepCards(hand, 5, conds, 3)
+	if want := []int{bear, land, land, land, bolt}; !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("keepCards(5)=%v, %v; want %v, true", got, ok, want)
+	}
+	got, ok = keepCards(hand, 2, conds, 3)
+	if want := []int{bear, land}; ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("keepCards(2)=%v, %v; want %v, false", got, ok, want)
+	}
+}
@@ -0,0 +1,342 @@
+package deckcount
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HandCondition asks for from Min to Max (or, if Max is -1, at least Min) of
+// the cards in a hand that What describes: a card type such as "lands",
+// "nonland" cards, "N-drops" (nonland cards of mana value N), or a card's
+// name.
+type HandCondition struct {
+	Min, Max int
+	What     string
+}
+
+// HandQuery asks for a hand of HandSize cards that meets every condition.
+type HandQuery struct {
+	Conditions []HandCondition
+	HandSize   int
+}
+
+// openingHand is the size of an opening hand.
+const openingHand = 7
+
+// drops are the words for the mana values of the "N-drop" conditions.
+var drops = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+
+// ParseHandQuery reads a query like "at least 2 lands and 1 one-drop in
+// opening 7": conditions joined by "and", each a count and what to count,
+// then optionally the hand, as "in opening N", "in opening hand", "in the
+// top N", or "in N cards"; the hand is seven cards otherwise.  A count is
+// "at least N", "at most N", "exactly N", "no", "N or more", "N or fewer",
+// "N-M", or a bare N with the quantifier before it ("at least" for the
+// first).  A card name with "and" or " in " in it needs double quotes.
+// Errors match ErrBadQuery.
+func ParseHandQuery(s string) (HandQuery, error) {
+	q := HandQuery{HandSize: openingHand}
+	body := s
+	if i := lastOutsideQuotes(body, " in "); i >= 0 {
+		hand := strings.Fields(strings.ToLower(body[i+len(" in "):]))
+		body = body[:i]
+		var n string
+		switch {
+		case len(hand) == 2 && hand[0] == "opening" && hand[1] == "hand":
+			n = strconv.Itoa(openingHand)
+		case len(hand) == 2 && hand[0] == "opening", len(hand) == 3 && hand[0] == "the" && hand[1] == "top":
+			n = hand[len(hand)-1]
+		case len(hand) == 2 && (hand[1] == "cards" || hand[1] == "card"), len(hand) == 1:
+			n = hand[0]
+		}
+		size, err := strconv.Atoi(n)
+		if err != nil || size < 0 {
+			return HandQuery{}, fmt.Errorf("%w %q: want a hand like \"in opening 7\" or \"in the top 10\"", ErrBadQuery, s)
+		}
+		q.HandSize = size
+	}
+	quantifier := "at least"
+	for _, clause := range splitOutsideQuotes(body, " and ") {
+		c, err := parseHandCondition(strings.TrimSpace(clause), &quantifier)
+		if err != nil {
+			return HandQuery{}, fmt.Errorf("%w %q: %v", ErrBadQuery, s, err)
+		}
+		q.Conditions = append(q.Conditions, c)
+	}
+	return q, nil
+}
+
+// parseHandCondition reads a condition like "at least 2 lands", with the
+// quantifier (e.g. "at least") of the condition before it, which it updates.
+func parseHandCondition(clause string, quantifier *string) (HandCondition, error) {
+	lower := strings.ToLower(clause)
+	for _, quant := range []string{"at least ", "at most ", "exactly "} {
+		if strings.HasPrefix(lower, quant) {
+			*quantifier = strings.TrimSpace(quant)
+			clause = strings.TrimSpace(clause[len(quant):])
+			lower = lower[len(quant):]
+		}
+	}
+	if strings.HasPrefix(lower, "no ") {
+		return HandCondition{0, 0, unquote(clause[len("no "):])}, nil
+	}
+	fields := strings.SplitN(clause, " ", 2)
+	if len(fields) < 2 {
+		return HandCondition{}, fmt.Errorf("want a count and what to count; got %q", clause)
+	}
+	count, what := fields[0], strings.TrimSpace(fields[1])
+	lo, hi := count, count
+	if i := strings.Index(count, "-"); i > 0 {
+		lo, hi = count[:i], count[i+1:]
+	}
+	min, err1 := strconv.Atoi(lo)
+	max, err2 := strconv.Atoi(hi)
+	if err1 != nil || err2 != nil || min < 0 || max < min {
+		return HandCondition{}, fmt.Errorf("want a count like 2 or 2-3; got %q", count)
+	}
+	quant := *quantifier
+	lowerWhat := strings.ToLower(what)
+	for prefix, q := range map[string]string{"or more ": "at least", "or fewer ": "at most", "or less ": "at most"} {
+		if strings.HasPrefix(lowerWhat, prefix) {
+			quant, what = q, strings.TrimSpace(what[len(prefix):])
+		}
+	}
+	if lo != hi {
+		return HandCondition{min, max, unquote(what)}, nil
+	}
+	switch quant {
+	case "at least":
+		max = -1 // However many the hand has.
+	case "at most":
+		min = 0
+	}
+	return HandCondition{min, max, unquote(what)}, nil
+}
+
+// String returns q in the form ParseHandQuery reads, e.g. "at least 2 lands
+// and at least 1 one-drop in opening 7".
+func (q HandQuery) String() string {
+	parts := []string{}
+	for _, c := range q.Conditions {
+		parts = append(parts, c.String())
+	}
+	return fmt.Sprintf("%s in opening %d", strings.Join(parts, " and "), q.HandSize)
+}
+
+// String returns c as a condition of a query that ParseHandQuery reads, e.g.
+// "at least 2 lands".
+func (c HandCondition) String() string {
+	what := c.What
+	if strings.Contains(strings.ToLower(what), " and ") || strings.Contains(strings.ToLower(what), " in ") {
+		what = `"` + what + `"`
+	}
+	switch {
+	case c.Max < 0:
+		return fmt.Sprintf("at least %d %s", c.Min, what)
+	case c.Min == c.Max:
+		return fmt.Sprintf("exactly %d %s", c.Min, what)
+	case c.Min == 0:
+		return fmt.Sprintf("at most %d %s", c.Max, what)
+	}
+	return fmt.Sprintf("%d-%d %s", c.Min, c.Max, what)
+}
+
+// cardMatcher returns what a condition's What describes, as a test of a
+// card with the given name and data, or nil if What isn't a category and so
+// names a card.
+func cardMatcher(what string) func(name string, c Card) bool {
+	w := strings.ToLower(what)
+	singular := strings.TrimSuffix(w, "s")
+	if strings.HasSuffix(w, "ies") {
+		singular = strings.TrimSuffix(w, "ies") + "y"
+	}
+	switch singular {
+	case "card":
+		return func(string, Card) bool { return true }
+	case "nonland", "spell", "nonland card":
+		return func(_ string, c Card) bool { return !c.IsLand() }
+	case "land", "creature", "artifact", "enchantment", "instant", "sorcery", "planeswalker", "battle":
+		typ := strings.ToUpper(singular[:1]) + singular[1:]
+		return func(_ string, c Card) bool { return c.HasType(typ) }
+	}
+	if drop := strings.TrimSuffix(singular, "-drop"); drop != singular {
+		mv, err := strconv.Atoi(drop)
+		for i, word := range drops {
+			if word == drop {
+				mv, err = i, nil
+			}
+		}
+		if err == nil {
+			return func(_ string, c Card) bool { return !c.IsLand() && c.CMC() == mv }
+		}
+	}
+	return nil
+}
+
+// HandOdds returns the exact chance that a hand of q.HandSize cards drawn
+// from deck's main deck meets q's conditions, with their cards found as for
+// conditionMasks.
+//
+// The main deck's cards fall into cells by which conditions they meet, so
+// the chance is the multivariate hypergeometric sum, over the ways to draw
+// h_i cards from each cell of n_i that meet every condition, of the product
+// of C(n_i, h_i), divided by C(deck size, hand size).
+func HandOdds(deck Deck, cards map[string]Card, q HandQuery) (*big.Rat, error) {
+	byName, err := conditionMasks(deck, cards, q.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	cells := map[int]int{} // Copies by the conditions met, as bits.
+	size := 0
+	for name, copies := range deck.Main {
+		cells[byName[name]] += copies
+		size += copies
+	}
+	if q.HandSize > size {
+		return nil, fmt.Errorf("%w: a hand of %d from %d cards", ErrDeckSize, q.HandSize, size)
+	}
+	met := make([]int, len(q.Conditions))
+	ways := new(big.Int)
+	forEachHand(cells, q.HandSize, func(masks, drawn []int, w *big.Int) {
+		for k := range met {
+			met[k] = 0
+			for i, mask := range masks {
+				if mask&(1<<k) != 0 {
+					met[k] += drawn[i]
+				}
+			}
+		}
+		if meets(q.Conditions, met) {
+			ways.Add(ways, w)
+		}
+	})
+	hands := new(big.Int).Binomial(int64(size), int64(q.HandSize))
+	return new(big.Rat).SetFrac(ways, hands), nil
+}
+
+// conditionMasks returns, for each card in deck's main deck, the conditions
+// of conds it meets, as bits.  A condition's What is looked up in the main
+// deck as a card name, as for FindCard, unless it's a category, which needs
+// each main deck card's data from cards.
+func conditionMasks(deck Deck, cards map[string]Card, conds []HandCondition) (map[string]int, error) {
+	deckCards := map[string]Card{} // The main deck's cards, by name, for FindCard.
+	for name := range deck.Main {
+		deckCards[name] = Card{Name: name}
+	}
+	tests := make([]func(string, Card) bool, len(conds))
+	needData := false
+	for i, cond := range conds {
+		if tests[i] = cardMatcher(cond.What); tests[i] != nil {
+			needData = true
+			continue
+		}
+		c, err := FindCard(deckCards, cond.What)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is neither a category nor in the main deck", ErrBadQuery, cond.What)
+		}
+		tests[i] = func(name string, _ Card) bool { return name == c.Name }
+	}
+	masks := map[string]int{}
+	for name := range deck.Main {
+		c, ok := cards[name]
+		if !ok && needData {
+			return nil, fmt.Errorf("%w: unknown card %q", ErrBadDecklist, name)
+		}
+		for i, test := range tests {
+			if test(name, c) {
+				masks[name] |= 1 << i
+			}
+		}
+	}
+	return masks, nil
+}
+
+// meets reports whether met[k] cards meeting each condition k of conds are
+// within its range.
+func meets(conds []HandCondition, met []int) bool {
+	for k, cond := range conds {
+		if met[k] < cond.Min || cond.Max >= 0 && met[k] > cond.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachHand calls fn for each way to draw n cards from cells, which has
+// the number of cards of each mask: with the masks in order, the number
+// drawn of each, and the number of hands drawing those, the product of the
+// binomials C(cells[masks[i]], drawn[i]).  fn must not retain its slices.
+func forEachHand(cells map[int]int, n int, fn func(masks, drawn []int, ways *big.Int)) {
+	masks := []int{}
+	for mask := range cells {
+		masks = append(masks, mask)
+	}
+	sort.Ints(masks)
+	drawn := make([]int, len(masks))
+	var draw func(i, left int, w *big.Int)
+	draw = func(i, left int, w *big.Int) {
+		if i == len(masks) {
+			if left == 0 {
+				fn(masks, drawn, w)
+			}
+			return
+		}
+		size := cells[masks[i]]
+		for h := 0; h <= size && h <= left; h++ {
+			drawn[i] = h
+			draw(i+1, left-h, new(big.Int).Mul(w, new(big.Int).Binomial(int64(size), int64(h))))
+		}
+		drawn[i] = 0
+	}
+	draw(0, n, big.NewInt(1))
+}
+
+// splitOutsideQuotes splits s around each sep that isn't within double
+// quotes.
+func splitOutsideQuotes(s, sep string) []string {
+	parts := []string{}
+	for {
+		i := indexOutsideQuotes(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+len(sep):]
+	}
+}
+
+// indexOutsideQuotes returns the index of the first sep in s that isn't
+// within double quotes, ignoring case, or -1.
+func indexOutsideQuotes(s, sep string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+		}
+		if !quoted && i+len(sep) <= len(s) && strings.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastOutsideQuotes is like indexOutsideQuotes, but for the last sep.
+func lastOutsideQuotes(s, sep string) int {
+	last := -1
+	for i, off := indexOutsideQuotes(s, sep), 0; i >= 0; i = indexOutsideQuotes(s[off:], sep) {
+		last = off + i
+		off = last + len(sep)
+	}
+	return last
+}
+
+// unquote returns s without the double quotes around it, if any.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
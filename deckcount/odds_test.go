@@ -0,0 +1,111 @@
+package deckcount
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestParseHandQuery(t *testing.T) {
+	cases := []struct {
+		s    string
+		want HandQuery
+	}{
+		{"at least 2 lands and 1 one-drop in opening 7", HandQuery{[]HandCondition{{2, -1, "lands"}, {1, -1, "one-drop"}}, 7}},
+		{`exactly 1 "Fire and Ice" in the top 10`, HandQuery{[]HandCondition{{1, 1, "Fire and Ice"}}, 10}},
+		{"no lands", HandQuery{[]HandCondition{{0, 0, "lands"}}, 7}},
+		{"2-3 lands and at most 1 Lightning Bolt in 8 cards", HandQuery{[]HandCondition{{2, 3, "lands"}, {0, 1, "Lightning Bolt"}}, 8}},
+		{"3 or more creatures and 1 or fewer 4-drops in opening hand", HandQuery{[]HandCondition{{3, -1, "creatures"}, {0, 1, "4-drops"}}, 7}},
+		{"exactly 2 lands and 1 Opt in 7", HandQuery{[]HandCondition{{2, 2, "lands"}, {1, 1, "Opt"}}, 7}},
+	}
+	for _, c := range cases {
+		got, err := ParseHandQuery(c.s)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseHandQuery(%q)=%v, %v; want %v", c.s, got, err, c.want)
+		}
+		if again, err := ParseHandQuery(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("ParseHandQuery(%q)=%v, %v; want %v", got.String(), again, err, got)
+		}
+	}
+	for _, s := range []string{"", "lands", "at least two lands", "2 lands in opening", "3-2 lands"} {
+		if _, err := ParseHandQuery(s); !errors.Is(err, ErrBadQuery) {
+			t.Errorf("ParseHandQuery(%q) err=%v; want ErrBadQuery", s, err)
+		}
+	}
+}
+
+func TestHandOdds(t *testing.T) {
+	cards := map[string]Card{
+		"Island":         {Name: "Island", Type: "Basic Land — Island"},
+		"Lightning Bolt": {Name: "Lightning Bolt", Type: "Instant", ConvertedManaCost: 1},
+		"Grizzly Bears":  {Name: "Grizzly Bears", Type: "Creature — Bear", ConvertedManaCost: 2},
+	}
+	deck := Deck{Main: map[string]int{"Island": 24, "Lightning Bolt": 4, "Grizzly Bears": 32}}
+	binom := func(n, k int64) *big.Int { return new(big.Int).Binomial(n, k) }
+	chance := func(ways *big.Int, hand int64) *big.Rat { return new(big.Rat).SetFrac(ways, binom(60, hand)) }
+	noBolt := chance(binom(56, 7), 7)
+	cases := []struct {
+		query string
+		want  *big.Rat
+	}{
+		{"at least 1 lightning bolt", new(big.Rat).Sub(big.NewRat(1, 1), noBolt)},
+		{"no Lightning Bolt", noBolt},
+		{"exactly 2 lands and 1 one-drop", chance(new(big.Int).Mul(new(big.Int).Mul(binom(24, 2), binom(4, 1)), binom(32, 4)), 7)},
+		// Every two-drop is a nonland card.
+		{"at least 1 nonland and 1 two-drop", new(big.Rat).Sub(big.NewRat(1, 1), chance(binom(28, 7), 7))},
+		{"at least 0 cards in the top 60", big.NewRat(1, 1)},
+		{"8 lands", new(big.Rat)},
+		{"at least 1 land in the top 0", new(big.Rat)},
+	}
+	for _, c := range cases {
+		q, err := ParseHandQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := HandOdds(deck, cards, q)
+		if err != nil || got.Cmp(c.want) != 0 {
+			t.Errorf("HandOdds(%q)=%v, %v; want %v", c.query, got, err, c.want)
+		}
+	}
+
+	// A 2-drop, then lands, by brute force over the hands of a small deck.
+	small := Deck{Main: map[string]int{"Island": 3, "Lightning Bolt": 2, "Grizzly Bears": 2}}
+	q, _ := ParseHandQuery("at least 1 two-drop and 1-2 lands in 3 cards")
+	hands, want := 0, 0
+	for mask := 0; mask < 1<<7; mask++ {
+		bears, lands, n := 0, 0, 0
+		for i := 0; i < 7; i++ {
+			if mask&(1<<i) != 0 {
+				n++
+				switch {
+				case i < 3:
+					lands++
+				case i >= 5:
+					bears++
+				}
+			}
+		}
+		if n != 3 {
+			continue
+		}
+		hands++
+		if bears >= 1 && lands >= 1 && lands <= 2 {
+			want++
+		}
+	}
+	if got, err := HandOdds(small, cards, q); err != nil || got.Cmp(big.NewRat(int64(want), int64(hands))) != 0 {
+		t.Errorf("HandOdds(%v)=%v, %v; want %d/%d", q, got, err, want, hands)
+	}
+
+	for _, query := range []string{"1 Counterspell", "3 lands in the top 61"} {
+		q, _ := ParseHandQuery(query)
+		if _, err := HandOdds(deck, cards, q); err == nil {
+			t.Errorf("HandOdds(%q) succeeded; want an error", query)
+		}
+	}
+	q, _ = ParseHandQuery("2 lands")
+	if _, err := HandOdds(Deck{Main: map[string]int{"Forest": 40, "Black Lotus": 20}}, cards, q); !errors.Is(err, ErrBadDecklist) {
+		t.Errorf("HandOdds(unknown cards) err=%v; want ErrBadDecklist", err)
+	}
+}